@@ -1,8 +1,6 @@
 package common
 
 import (
-	"context"
-	"crypto/tls"
 	"fmt"
 	"log"
 	"os"
@@ -12,14 +10,10 @@ import (
 
 	"github.com/cloudforet-io/cfctl/pkg/configs"
 	"github.com/cloudforet-io/cfctl/pkg/format"
-	"github.com/jhump/protoreflect/grpcreflect"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"gopkg.in/yaml.v3"
 )
 
@@ -88,40 +82,28 @@ func loadShortNames() (map[string]string, error) {
 }
 
 func FetchServiceResources(serviceName, endpoint string, shortNamesMap map[string]string, config *configs.Environments) ([][]string, error) {
-	parts := strings.Split(endpoint, "://")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid endpoint format: %s", endpoint)
-	}
-	scheme := parts[0]
-	hostPort := parts[1]
-
-	var opts []grpc.DialOption
-	if scheme == "grpc+ssl" {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false,
-		}
-		creds := credentials.NewTLS(tlsConfig)
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-	} else if scheme == "grpc" {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	} else {
-		return nil, fmt.Errorf("unsupported scheme: %s", scheme)
+	target, err := configs.ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
 	}
 
-	conn, err := grpc.Dial(hostPort, opts...)
+	conn, err := configs.DialEnvironment(config.Environments[config.Environment], target.HostPort, target.Secure)
 	if err != nil {
 		return nil, fmt.Errorf("connection failed: unable to connect to %s: %v", endpoint, err)
 	}
 	defer conn.Close()
 
-	ctx := metadata.AppendToOutgoingContext(context.Background(), "token", config.Environments[config.Environment].Token)
+	ctx, cancel := rpc.Context()
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "token", config.Environments[config.Environment].Token)
 
-	refClient := grpcreflect.NewClient(ctx, grpc_reflection_v1alpha.NewServerReflectionClient(conn))
-	defer refClient.Reset()
+	cacheDir, _ := rpc.DescriptorCacheDir(config.Environment)
+	refClient := rpc.NewReflector(ctx, conn, cacheDir, serviceName)
+	defer refClient.Close()
 
 	services, err := refClient.ListServices()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list services: %v", err)
+		return nil, fmt.Errorf("failed to list services: %v", rpc.ContextError(ctx, err))
 	}
 
 	// Load short names from setting.yaml
@@ -155,7 +137,8 @@ func FetchServiceResources(serviceName, endpoint string, shortNamesMap map[strin
 		}
 
 		displayServiceName := serviceName
-		if strings.HasPrefix(endpoint, "grpc://") && (strings.Contains(endpoint, "localhost") || strings.Contains(endpoint, "127.0.0.1")) {
+		isLocal := strings.HasPrefix(endpoint, "grpc://") && (strings.Contains(endpoint, "localhost") || strings.Contains(endpoint, "127.0.0.1"))
+		if isLocal || strings.HasPrefix(endpoint, "grpc+unix://") {
 			parts := strings.Split(s, ".")
 			if len(parts) > 2 {
 				serviceDesc, err := refClient.ResolveService(s)
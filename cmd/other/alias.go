@@ -114,6 +114,9 @@ func init() {
 	addAliasCmd.Flags().StringP("service", "s", "", "Service to add alias for")
 	addAliasCmd.Flags().StringP("key", "k", "", "Alias key to add")
 	addAliasCmd.Flags().StringP("value", "v", "", "Command to execute (e.g., \"list User\")")
+	// -v is taken by --value here, so shadow the root --verbosity flag that also claims it
+	addAliasCmd.Flags().Int("verbosity", 0, "")
+	addAliasCmd.Flags().MarkHidden("verbosity")
 	addAliasCmd.MarkFlagRequired("service")
 	addAliasCmd.MarkFlagRequired("key")
 	addAliasCmd.MarkFlagRequired("value")
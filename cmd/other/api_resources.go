@@ -13,6 +13,7 @@ import (
 
 	"github.com/cloudforet-io/cfctl/pkg/configs"
 	"github.com/cloudforet-io/cfctl/pkg/format"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
@@ -22,27 +23,6 @@ import (
 
 var endpoints string
 
-func loadEndpointsFromCache(currentEnv string) (map[string]string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("unable to find home directory: %v", err)
-	}
-
-	// Read from environment-specific cache file
-	cacheFile := filepath.Join(home, ".cfctl", "cache", currentEnv, "endpoints.yaml")
-	data, err := os.ReadFile(cacheFile)
-	if err != nil {
-		return nil, err
-	}
-
-	var endpoints map[string]string
-	if err := yaml.Unmarshal(data, &endpoints); err != nil {
-		return nil, err
-	}
-
-	return endpoints, nil
-}
-
 var ApiResourcesCmd = &cobra.Command{
 	Use:   "api_resources",
 	Short: "Displays supported API resources",
@@ -82,19 +62,21 @@ var ApiResourcesCmd = &cobra.Command{
 			return
 		}
 
-		// Try to load endpoints from cache first
-		endpointsMap, err := loadEndpointsFromCache(currentEnv)
+		endpointName, ok := envConfig["endpoint"].(string)
+		if !ok || endpointName == "" {
+			return
+		}
+		endpointTemplate, _ := envConfig["endpoint_template"].(string)
+
+		// Endpoints come from the cache while it is fresh and from the identity service otherwise
+		env := configs.CurrentEnvironment()
+		env.Endpoint, env.EndpointTemplate = endpointName, endpointTemplate
+		resolver := configs.NewResolver(currentEnv, env)
+		ctx, cancel := rpc.Context()
+		defer cancel()
+		endpointsMap, err := resolver.Endpoints(ctx)
 		if err != nil {
-			// If cache loading fails, fall back to fetching from identity service
-			endpointName, ok := envConfig["endpoint"].(string)
-			if !ok || endpointName == "" {
-				return
-			}
-
-			endpointsMap, err = configs.FetchEndpointsMap(endpointName)
-			if err != nil {
-				log.Fatalf("Failed to fetch endpointsMap from '%s': %v", endpointName, err)
-			}
+			log.Fatalf("Failed to fetch endpointsMap from '%s': %v", endpointName, err)
 		}
 
 		// Load short names configuration
@@ -122,13 +104,13 @@ var ApiResourcesCmd = &cobra.Command{
 			var allData [][]string
 
 			for _, endpointName := range selectedEndpoints {
-				serviceEndpoint, ok := endpointsMap[endpointName]
-				if !ok {
-					log.Printf("No endpoint found for %s", endpointName)
+				target, err := resolver.Resolve(ctx, endpointName)
+				if err != nil {
+					log.Printf("No endpoint found for %s: %v", endpointName, err)
 					continue
 				}
 
-				result, err := format.FetchServiceResources(endpointName, serviceEndpoint, shortNamesMap)
+				result, err := format.FetchServiceResources(currentEnv, endpointName, target.String(), shortNamesMap)
 				if err != nil {
 					log.Printf("Error processing service %s: %v", endpointName, err)
 					continue
@@ -150,17 +132,23 @@ var ApiResourcesCmd = &cobra.Command{
 		dataChan := make(chan [][]string, len(endpointsMap))
 		errorChan := make(chan error, len(endpointsMap))
 
-		for service, endpoint := range endpointsMap {
+		for service := range endpointsMap {
+			target, err := resolver.Resolve(ctx, service)
+			if err != nil {
+				errorChan <- fmt.Errorf("Error processing service %s: %v", service, err)
+				continue
+			}
+
 			wg.Add(1)
 			go func(service, endpoint string) {
 				defer wg.Done()
-				result, err := format.FetchServiceResources(service, endpoint, shortNamesMap)
+				result, err := format.FetchServiceResources(currentEnv, service, endpoint, shortNamesMap)
 				if err != nil {
 					errorChan <- fmt.Errorf("Error processing service %s: %v", service, err)
 					return
 				}
 				dataChan <- result
-			}(service, endpoint)
+			}(service, target.String())
 		}
 
 		wg.Wait()
@@ -64,7 +64,10 @@ var ApplyCmd = &cobra.Command{
         role_id: role-456
 
   # 02. Apply the configuration
-  cfctl apply -f test.yaml`,
+  cfctl apply -f test.yaml
+
+  # 03. Print the ID returned by each step
+  cfctl apply -f test.yaml -q '.workspace_group_id'`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		filename, _ := cmd.Flags().GetString("filename")
 		if filename == "" {
@@ -83,26 +86,59 @@ var ApplyCmd = &cobra.Command{
 			return err
 		}
 
+		// Step responses are only printed when asked for with --query or --output
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		headers, _ := cmd.Flags().GetStringArray("header")
+		token, _ := cmd.Flags().GetString("token")
+		tokenFile, _ := cmd.Flags().GetString("token-file")
+		maxRecvSize, _ := cmd.Flags().GetString("max-recv-size")
+		maxSendSize, _ := cmd.Flags().GetString("max-send-size")
+		compression, _ := cmd.Flags().GetString("compression")
+		authority, _ := cmd.Flags().GetString("authority")
+		query, _ := cmd.Flags().GetString("query")
+		outputFormat := ""
+		if query != "" || cmd.Flags().Changed("output") {
+			outputFormat, _ = cmd.Flags().GetString("output")
+		}
+
 		// Process each resource sequentially
 		var lastResponse map[string]interface{}
 		for i, resource := range resources {
 			pterm.Info.Printf("Applying resource %d/%d: %s/%s\n",
 				i+1, len(resources), resource.Service, resource.Resource)
 
-			// Convert spec to parameters
-			parameters := convertSpecToParameters(resource.Spec, lastResponse)
+			// Convert spec to parameters; a dry run has no responses, so references stay as written
+			parameters := convertSpecToParameters(resource.Spec, lastResponse, dryRun)
 
 			options := &transport.FetchOptions{
-				Parameters: parameters,
+				Parameters:           parameters,
+				OutputFormat:         outputFormat,
+				OutputFormatExplicit: true,
+				Query:                query,
+				DryRun:               dryRun,
+				Headers:              headers,
+				Token:                token,
+				TokenFile:            tokenFile,
+				MaxRecvSize:          maxRecvSize,
+				MaxSendSize:          maxSendSize,
+				Compression:          compression,
+				Authority:            authority,
 			}
 
 			response, err := transport.FetchService(resource.Service, resource.Verb, resource.Resource, options)
 			if err != nil {
-				pterm.Error.Printf("Failed to apply resource %d/%d: %v\n", i+1, len(resources), err)
+				pterm.Error.Printf("Failed to apply resource %d/%d\n", i+1, len(resources))
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				transport.ReportError(err, outputFormat)
 				return err
 			}
 
 			lastResponse = response
+			if dryRun {
+				pterm.Success.Printf("Resource %d/%d checked, nothing was sent\n", i+1, len(resources))
+				continue
+			}
 			pterm.Success.Printf("Resource %d/%d applied successfully\n", i+1, len(resources))
 		}
 
@@ -110,7 +146,7 @@ var ApplyCmd = &cobra.Command{
 	},
 }
 
-func convertSpecToParameters(spec map[string]interface{}, lastResponse map[string]interface{}) []string {
+func convertSpecToParameters(spec map[string]interface{}, lastResponse map[string]interface{}, keepRefs bool) []string {
 	var parameters []string
 
 	for key, value := range spec {
@@ -121,6 +157,8 @@ func convertSpecToParameters(spec map[string]interface{}, lastResponse map[strin
 				refPath := strings.Trim(v, "${}")
 				if val := getValueFromPath(lastResponse, refPath); val != "" {
 					parameters = append(parameters, fmt.Sprintf("%s=%s", key, val))
+				} else if keepRefs {
+					parameters = append(parameters, fmt.Sprintf("%s=%s", key, v))
 				}
 			} else {
 				parameters = append(parameters, fmt.Sprintf("%s=%s", key, v))
@@ -165,5 +203,15 @@ func getValueFromPath(data map[string]interface{}, path string) string {
 
 func init() {
 	ApplyCmd.Flags().StringP("filename", "f", "", "Filename to use to apply the resource")
+	ApplyCmd.Flags().StringP("output", "o", "yaml", "Output format of each step's response (yaml, json, table, csv, template=<text>, custom-columns=<spec>)")
+	ApplyCmd.Flags().StringP("query", "q", "", "jq or JSONPath ($...) expression applied to each step's response")
+	ApplyCmd.Flags().BoolP("dry-run", "", false, "Print each step's endpoint, method and request without sending it")
+	ApplyCmd.Flags().StringArrayP("header", "H", []string{}, "Extra gRPC metadata sent with every call (-H x-request-id=abc -H ...)")
+	ApplyCmd.Flags().StringP("token", "", "", "Token to use instead of the environment's")
+	ApplyCmd.Flags().StringP("token-file", "", "", "File holding the token to use instead of the environment's")
+	ApplyCmd.Flags().StringP("max-recv-size", "", "", "Largest response message to accept, e.g. 32MB (default from the environment's max_recv_size, or 10MB)")
+	ApplyCmd.Flags().StringP("max-send-size", "", "", "Largest request message to send, e.g. 32MB (default from the environment's max_send_size, or 10MB)")
+	ApplyCmd.Flags().StringP("compression", "", "", "Compress messages with gzip, or none to turn the environment's compression off")
+	ApplyCmd.Flags().StringP("authority", "", "", "Host name to present to the server, e.g. when dialing an IP (default from the environment's authority)")
 	ApplyCmd.MarkFlagRequired("filename")
 }
@@ -6,7 +6,6 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -21,6 +20,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/eiannone/keyboard"
 
 	"google.golang.org/grpc/metadata"
@@ -28,15 +28,11 @@ import (
 
 	"github.com/jhump/protoreflect/dynamic"
 
-	"github.com/jhump/protoreflect/grpcreflect"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/zalando/go-keyring"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 )
 
 //const encryptionKey = "spaceone-cfctl-encryption-key-32byte"
@@ -59,7 +55,8 @@ It will prompt you for your User ID, Password, and fetch the Domain ID automatic
 
 // tokenAuth implements grpc.PerRPCCredentials for token-based authentication.
 type tokenAuth struct {
-	token string
+	token  string
+	secure bool // Whether the connection uses TLS; grpc:// endpoints are plaintext
 }
 
 func (t *tokenAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
@@ -69,7 +66,7 @@ func (t *tokenAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[
 }
 
 func (t *tokenAuth) RequireTransportSecurity() bool {
-	return true
+	return t.secure
 }
 
 func executeLogin(cmd *cobra.Command, args []string) {
@@ -442,7 +439,11 @@ func executeUserLogin(currentEnv string) {
 
 	var scope string
 	if !hasIdentityService {
-		client := &http.Client{}
+		client, err := configs.HTTPClient()
+		if err != nil {
+			pterm.Error.Printf("Failed to configure the HTTP client: %v\n", err)
+			exitWithError()
+		}
 
 		// Check for existing user_id in config
 		userID := mainViper.GetString(fmt.Sprintf("environments.%s.user_id", currentEnv))
@@ -483,7 +484,10 @@ func executeUserLogin(currentEnv string) {
 			domainPayload := map[string]string{"name": domainName}
 			jsonPayload, _ := json.Marshal(domainPayload)
 
-			req, err := http.NewRequest("POST", restIdentityEndpoint+"/domain/get-auth-info", bytes.NewBuffer(jsonPayload))
+			ctx, cancel := rpc.Context()
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, "POST", restIdentityEndpoint+"/domain/get-auth-info", bytes.NewBuffer(jsonPayload))
 			if err != nil {
 				pterm.Error.Printf("Failed to create request: %v\n", err)
 				exitWithError()
@@ -492,7 +496,7 @@ func executeUserLogin(currentEnv string) {
 
 			resp, err := client.Do(req)
 			if err != nil {
-				pterm.Error.Printf("Failed to fetch domain info: %v\n", err)
+				pterm.Error.Printf("Failed to fetch domain info: %v\n", rpc.ContextError(ctx, err))
 				exitWithError()
 			}
 			defer resp.Body.Close()
@@ -519,12 +523,12 @@ func executeUserLogin(currentEnv string) {
 			}
 
 			jsonPayload, _ = json.Marshal(tokenPayload)
-			req, _ = http.NewRequest("POST", restIdentityEndpoint+"/token/issue", bytes.NewBuffer(jsonPayload))
+			req, _ = http.NewRequestWithContext(ctx, "POST", restIdentityEndpoint+"/token/issue", bytes.NewBuffer(jsonPayload))
 			req.Header.Set("Content-Type", "application/json")
 
 			resp, err = client.Do(req)
 			if err != nil {
-				pterm.Error.Printf("Failed to issue token: %v\n", err)
+				pterm.Error.Printf("Failed to issue token: %v\n", rpc.ContextError(ctx, err))
 				exitWithError()
 			}
 			defer resp.Body.Close()
@@ -751,7 +755,10 @@ func GetIdentityEndpoint(apiEndpoint string) (string, bool, error) {
 		return "", false, fmt.Errorf("failed to create payload: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", endpointListURL, bytes.NewBuffer(jsonPayload))
+	ctx, cancel := rpc.Context()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpointListURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return "", false, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -759,10 +766,13 @@ func GetIdentityEndpoint(apiEndpoint string) (string, bool, error) {
 	req.Header.Set("accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client, err := configs.HTTPClient()
+	if err != nil {
+		return "", false, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", false, fmt.Errorf("failed to fetch endpoints: %v", err)
+		return "", false, fmt.Errorf("failed to fetch endpoints: %v", rpc.ContextError(ctx, err))
 	}
 	defer resp.Body.Close()
 
@@ -1091,41 +1101,31 @@ func exitWithError() {
 
 func fetchDomainID(baseUrl string, name string) (string, error) {
 	// Parse the endpoint
-	parts := strings.Split(baseUrl, "://")
-	if len(parts) != 2 {
-		return "", fmt.Errorf("invalid endpoint format: %s", baseUrl)
+	target, err := configs.ParseEndpoint(baseUrl)
+	if err != nil {
+		return "", err
 	}
 
-	hostPort := parts[1]
-
 	// Configure gRPC connection
-	var opts []grpc.DialOption
-	if strings.HasPrefix(baseUrl, "grpc+ssl://") {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false,
-		}
-		creds := credentials.NewTLS(tlsConfig)
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	}
-
 	// Establish connection
-	conn, err := grpc.Dial(hostPort, opts...)
+	conn, err := configs.Dial(target.HostPort, target.Secure)
 	if err != nil {
 		return "", fmt.Errorf("failed to connect: %v", err)
 	}
 	defer conn.Close()
 
+	ctx, cancel := rpc.Context()
+	defer cancel()
+
 	// Create reflection client
-	refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+	refClient := rpc.NewReflectionClient(ctx, conn)
 	defer refClient.Reset()
 
 	// Resolve the service
 	serviceName := "spaceone.api.identity.v2.Domain"
 	serviceDesc, err := refClient.ResolveService(serviceName)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
+		return "", fmt.Errorf("failed to resolve service %s: %v", serviceName, rpc.ContextError(ctx, err))
 	}
 
 	// Find the method descriptor
@@ -1142,9 +1142,9 @@ func fetchDomainID(baseUrl string, name string) (string, error) {
 	fullMethod := fmt.Sprintf("/%s/%s", serviceName, "get_auth_info")
 	respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
 
-	err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+	err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 	if err != nil {
-		return "", fmt.Errorf("RPC failed: %v", err)
+		return "", fmt.Errorf("RPC failed: %v", rpc.ContextError(ctx, err))
 	}
 
 	// Extract domain_id from response
@@ -1158,41 +1158,31 @@ func fetchDomainID(baseUrl string, name string) (string, error) {
 
 func issueToken(baseUrl, userID, password, domainID string) (string, string, error) {
 	// Parse the endpoint
-	parts := strings.Split(baseUrl, "://")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid endpoint format: %s", baseUrl)
+	target, err := configs.ParseEndpoint(baseUrl)
+	if err != nil {
+		return "", "", err
 	}
 
-	hostPort := parts[1]
-
 	// Configure gRPC connection
-	var opts []grpc.DialOption
-	if strings.HasPrefix(baseUrl, "grpc+ssl://") {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false,
-		}
-		creds := credentials.NewTLS(tlsConfig)
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	}
-
 	// Establish connection
-	conn, err := grpc.Dial(hostPort, opts...)
+	conn, err := configs.Dial(target.HostPort, target.Secure)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to connect: %v", err)
 	}
 	defer conn.Close()
 
+	ctx, cancel := rpc.Context()
+	defer cancel()
+
 	// Create reflection client
-	refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+	refClient := rpc.NewReflectionClient(ctx, conn)
 	defer refClient.Reset()
 
 	// Resolve the service
 	serviceName := "spaceone.api.identity.v2.Token"
 	serviceDesc, err := refClient.ResolveService(serviceName)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
+		return "", "", fmt.Errorf("failed to resolve service %s: %v", serviceName, rpc.ContextError(ctx, err))
 	}
 
 	// Find the method descriptor
@@ -1231,9 +1221,9 @@ func issueToken(baseUrl, userID, password, domainID string) (string, string, err
 	fullMethod := fmt.Sprintf("/%s/%s", serviceName, "issue")
 	respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
 
-	err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+	err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 	if err != nil {
-		return "", "", fmt.Errorf("RPC failed: %v", err)
+		return "", "", fmt.Errorf("RPC failed: %v", rpc.ContextError(ctx, err))
 	}
 
 	// Extract tokens from response
@@ -1259,7 +1249,10 @@ func fetchWorkspaces(baseUrl string, identityEndpoint string, hasIdentityService
 		}
 
 		getWorkspacesUrl := baseUrl + "/user-profile/get-workspaces"
-		req, err := http.NewRequest("POST", getWorkspacesUrl, bytes.NewBuffer(jsonPayload))
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", getWorkspacesUrl, bytes.NewBuffer(jsonPayload))
 		if err != nil {
 			return nil, err
 		}
@@ -1267,11 +1260,14 @@ func fetchWorkspaces(baseUrl string, identityEndpoint string, hasIdentityService
 		req.Header.Set("accept", "application/json")
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		client, err := configs.HTTPClient()
 		if err != nil {
 			return nil, err
 		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, rpc.ContextError(ctx, err)
+		}
 		defer resp.Body.Close()
 
 		responseBody, err := io.ReadAll(resp.Body)
@@ -1306,53 +1302,37 @@ func fetchWorkspaces(baseUrl string, identityEndpoint string, hasIdentityService
 		return workspaceList, nil
 	} else {
 		// Parse the endpoint
-		parts := strings.Split(identityEndpoint, "://")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid endpoint format: %s", identityEndpoint)
+		target, err := configs.ParseEndpoint(identityEndpoint)
+		if err != nil {
+			return nil, err
 		}
 
-		hostPort := parts[1]
-
 		// Configure gRPC connection
-		var opts []grpc.DialOption
-		if strings.HasPrefix(identityEndpoint, "grpc+ssl://") {
-			tlsConfig := &tls.Config{
-				InsecureSkipVerify: false,
-			}
-			creds := credentials.NewTLS(tlsConfig)
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-		} else if strings.HasPrefix(identityEndpoint, "grpc://") {
-			tlsConfig := &tls.Config{
-				InsecureSkipVerify: true,
-			}
-			creds := credentials.NewTLS(tlsConfig)
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-		} else {
-			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		}
-
 		// Add token credentials
 		creds := &tokenAuth{
-			token: accessToken,
+			token:  accessToken,
+			secure: target.Secure,
 		}
-		opts = append(opts, grpc.WithPerRPCCredentials(creds))
 
 		// Establish connection
-		conn, err := grpc.Dial(hostPort, opts...)
+		conn, err := configs.Dial(target.HostPort, target.Secure, grpc.WithPerRPCCredentials(creds))
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect: %v", err)
 		}
 		defer conn.Close()
 
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
 		// Create reflection client
-		refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+		refClient := rpc.NewReflectionClient(ctx, conn)
 		defer refClient.Reset()
 
 		// Resolve the service
 		serviceName := "spaceone.api.identity.v2.UserProfile"
 		serviceDesc, err := refClient.ResolveService(serviceName)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
+			return nil, fmt.Errorf("failed to resolve service %s: %v", serviceName, rpc.ContextError(ctx, err))
 		}
 
 		// Find the method descriptor
@@ -1368,7 +1348,7 @@ func fetchWorkspaces(baseUrl string, identityEndpoint string, hasIdentityService
 		md := metadata.New(map[string]string{
 			"token": accessToken,
 		})
-		ctx := metadata.NewOutgoingContext(context.Background(), md)
+		ctx = metadata.NewOutgoingContext(ctx, md)
 
 		// Make the gRPC call
 		fullMethod := "/spaceone.api.identity.v2.UserProfile/get_workspaces"
@@ -1376,7 +1356,7 @@ func fetchWorkspaces(baseUrl string, identityEndpoint string, hasIdentityService
 
 		err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 		if err != nil {
-			return nil, fmt.Errorf("RPC failed: %v", err)
+			return nil, fmt.Errorf("RPC failed: %v", rpc.ContextError(ctx, err))
 		}
 
 		// Extract results from response
@@ -1423,7 +1403,10 @@ func fetchDomainIDAndRole(baseUrl string, identityEndpoint string, hasIdentitySe
 		}
 
 		getUserProfileUrl := baseUrl + "/user-profile/get"
-		req, err := http.NewRequest("POST", getUserProfileUrl, bytes.NewBuffer(jsonPayload))
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", getUserProfileUrl, bytes.NewBuffer(jsonPayload))
 		if err != nil {
 			return "", "", err
 		}
@@ -1432,11 +1415,14 @@ func fetchDomainIDAndRole(baseUrl string, identityEndpoint string, hasIdentitySe
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 		req.Header.Set("Content-Type", "application/json")
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		client, err := configs.HTTPClient()
 		if err != nil {
 			return "", "", err
 		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", "", rpc.ContextError(ctx, err)
+		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
@@ -1461,44 +1447,32 @@ func fetchDomainIDAndRole(baseUrl string, identityEndpoint string, hasIdentitySe
 		return domainID, roleType, nil
 	} else {
 		// Parse the endpoint
-		parts := strings.Split(identityEndpoint, "://")
-		if len(parts) != 2 {
-			return "", "", fmt.Errorf("invalid endpoint format: %s", identityEndpoint)
+		target, err := configs.ParseEndpoint(identityEndpoint)
+		if err != nil {
+			return "", "", err
 		}
 
-		hostPort := parts[1]
-
 		// Configure gRPC connection
-		var opts []grpc.DialOption
-		if strings.HasPrefix(identityEndpoint, "grpc+ssl://") {
-			tlsConfig := &tls.Config{
-				InsecureSkipVerify: false,
-			}
-			creds := credentials.NewTLS(tlsConfig)
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-		} else {
-			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		}
-
-		// Add token to metadata
-		opts = append(opts, grpc.WithPerRPCCredentials(&tokenAuth{token: accessToken}))
-
-		// Establish connection
-		conn, err := grpc.Dial(hostPort, opts...)
+		// Establish connection with the token in the metadata
+		conn, err := configs.Dial(target.HostPort, target.Secure,
+			grpc.WithPerRPCCredentials(&tokenAuth{token: accessToken, secure: target.Secure}))
 		if err != nil {
 			return "", "", fmt.Errorf("failed to connect: %v", err)
 		}
 		defer conn.Close()
 
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
 		// Create reflection client
-		refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+		refClient := rpc.NewReflectionClient(ctx, conn)
 		defer refClient.Reset()
 
 		// Resolve the service
 		serviceName := "spaceone.api.identity.v2.UserProfile"
 		serviceDesc, err := refClient.ResolveService(serviceName)
 		if err != nil {
-			return "", "", fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
+			return "", "", fmt.Errorf("failed to resolve service %s: %v", serviceName, rpc.ContextError(ctx, err))
 		}
 
 		// Find the method descriptor
@@ -1514,9 +1488,9 @@ func fetchDomainIDAndRole(baseUrl string, identityEndpoint string, hasIdentitySe
 		fullMethod := fmt.Sprintf("/%s/%s", serviceName, "get")
 		respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
 
-		err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+		err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 		if err != nil {
-			return "", "", fmt.Errorf("RPC failed: %v", err)
+			return "", "", fmt.Errorf("RPC failed: %v", rpc.ContextError(ctx, err))
 		}
 
 		// Extract domain_id and role_type from response
@@ -1569,17 +1543,23 @@ func grantToken(restIdentityEndpoint, identityEndpoint string, hasIdentityServic
 			return "", err
 		}
 
-		req, err := http.NewRequest("POST", restIdentityEndpoint+"/token/grant", bytes.NewBuffer(jsonPayload))
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", restIdentityEndpoint+"/token/grant", bytes.NewBuffer(jsonPayload))
 		if err != nil {
 			return "", err
 		}
 		req.Header.Set("Content-Type", "application/json")
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		client, err := configs.HTTPClient()
 		if err != nil {
 			return "", err
 		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", rpc.ContextError(ctx, err)
+		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
@@ -1599,41 +1579,31 @@ func grantToken(restIdentityEndpoint, identityEndpoint string, hasIdentityServic
 		return accessToken, nil
 	} else {
 		// Parse the endpoint
-		parts := strings.Split(identityEndpoint, "://")
-		if len(parts) != 2 {
-			return "", fmt.Errorf("invalid endpoint format: %s", identityEndpoint)
+		target, err := configs.ParseEndpoint(identityEndpoint)
+		if err != nil {
+			return "", err
 		}
 
-		hostPort := parts[1]
-
 		// Configure gRPC connection
-		var opts []grpc.DialOption
-		if strings.HasPrefix(identityEndpoint, "grpc+ssl://") {
-			tlsConfig := &tls.Config{
-				InsecureSkipVerify: false,
-			}
-			creds := credentials.NewTLS(tlsConfig)
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-		} else {
-			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		}
-
 		// Establish connection
-		conn, err := grpc.Dial(hostPort, opts...)
+		conn, err := configs.Dial(target.HostPort, target.Secure)
 		if err != nil {
 			return "", fmt.Errorf("failed to connect: %v", err)
 		}
 		defer conn.Close()
 
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
 		// Create reflection client
-		refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+		refClient := rpc.NewReflectionClient(ctx, conn)
 		defer refClient.Reset()
 
 		// Resolve the service
 		serviceName := "spaceone.api.identity.v2.Token"
 		serviceDesc, err := refClient.ResolveService(serviceName)
 		if err != nil {
-			return "", fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
+			return "", fmt.Errorf("failed to resolve service %s: %v", serviceName, rpc.ContextError(ctx, err))
 		}
 
 		// Find the method descriptor
@@ -1671,9 +1641,9 @@ func grantToken(restIdentityEndpoint, identityEndpoint string, hasIdentityServic
 		fullMethod := "/spaceone.api.identity.v2.Token/grant"
 		respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
 
-		err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+		err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 		if err != nil {
-			return "", fmt.Errorf("RPC failed: %v", err)
+			return "", fmt.Errorf("RPC failed: %v", rpc.ContextError(ctx, err))
 		}
 
 		// Extract access_token from response
@@ -3,7 +3,6 @@ package other
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,16 +15,13 @@ import (
 	"strings"
 
 	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/cloudforet-io/cfctl/pkg/transport"
 	"gopkg.in/yaml.v3"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 
 	"github.com/jhump/protoreflect/dynamic"
-	"github.com/jhump/protoreflect/grpcreflect"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -67,11 +63,29 @@ var settingInitStaticCmd = &cobra.Command{
 	Use:   "static [endpoint]",
 	Short: "Initialize static connection to a local or service endpoint",
 	Long: `Initialize configuration with a static service endpoint.
-This is useful for development or when connecting directly to specific service endpoints.`,
+This is useful for development or when connecting directly to specific service endpoints.
+Use --authority to present a host name to the server when dialing an IP or a socket.`,
 	Example: `  cfctl setting init static grpc://localhost:50051
-  cfctl setting init static grpc[+ssl]://inventory-`,
+  cfctl setting init static grpc[+ssl]://inventory-
+  cfctl setting init static grpc+unix:///run/cloudforet/identity.sock
+  cfctl setting init static grpc+ssl://10.0.0.5:443 --authority identity.api.example.com`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		authority, _ := cmd.Flags().GetString("authority")
+
+		if configs.IsGRPCEndpoint(args[0]) {
+			if _, err := configs.ParseEndpoint(args[0]); err != nil {
+				pterm.Error.Println(err)
+				return
+			}
+		}
+		if authority != "" {
+			if err := configs.ValidateAuthority(authority); err != nil {
+				pterm.Error.Println(err)
+				return
+			}
+		}
+
 		// Get environment name from user input
 		result, err := pterm.DefaultInteractiveTextInput.
 			WithDefaultText("default").
@@ -146,6 +160,21 @@ This is useful for development or when connecting directly to specific service e
 		}
 
 		updateSetting(envName, endpoint, "", false)
+
+		if authority != "" {
+			v := viper.New()
+			v.SetConfigFile(mainSettingPath)
+			v.SetConfigType("yaml")
+			if err := v.ReadInConfig(); err != nil {
+				pterm.Error.Printf("Failed to read setting file: %v\n", err)
+				return
+			}
+			v.Set(fmt.Sprintf("environments.%s.authority", envName), authority)
+			if err := v.WriteConfig(); err != nil {
+				pterm.Error.Printf("Failed to update authority setting: %v\n", err)
+				return
+			}
+		}
 	},
 }
 
@@ -563,8 +592,13 @@ You can either specify a new endpoint URL directly or use the service-based endp
 		}
 
 		if urlFlag != "" {
-			// Check if the URL starts with grpc:// or grpc+ssl://
-			if strings.HasPrefix(urlFlag, "grpc://") || strings.HasPrefix(urlFlag, "grpc+ssl://") {
+			// Check if the URL starts with grpc://, grpc+ssl:// or grpc+unix://
+			if configs.IsGRPCEndpoint(urlFlag) {
+				if _, err := configs.ParseEndpoint(urlFlag); err != nil {
+					pterm.Error.Println(err)
+					return
+				}
+
 				appV.Set(fmt.Sprintf("environments.%s.endpoint", currentEnv), urlFlag)
 				if err := appV.WriteConfig(); err != nil {
 					pterm.Error.Printf("Failed to update setting.yaml: %v\n", err)
@@ -641,7 +675,7 @@ You can either specify a new endpoint URL directly or use the service-based endp
 
 			isProxy := appV.GetBool(fmt.Sprintf("environments.%s.proxy", currentEnv))
 
-			if strings.HasPrefix(endpointName, "grpc://") || strings.HasPrefix(endpointName, "grpc+ssl://") {
+			if configs.IsGRPCEndpoint(endpointName) {
 				if !isProxy {
 					pterm.Error.Println("Service listing is only available when proxy is enabled.")
 					pterm.DefaultBox.WithTitle("Available Options").
@@ -658,37 +692,25 @@ You can either specify a new endpoint URL directly or use the service-based endp
 				}
 
 				var endpoints map[string]string
-				parts := strings.Split(endpointName, "/")
-				endpointName = strings.Join(parts[:len(parts)-1], "/")
-				parts = strings.Split(endpointName, "://")
-				if len(parts) != 2 {
-					fmt.Errorf("invalid endpoint format: %s", endpointName)
-				}
-
-				scheme := parts[0]
-				hostPort := parts[1]
-
-				// Configure gRPC connection based on scheme
-				var opts []grpc.DialOption
-				if scheme == "grpc+ssl" {
-					tlsConfig := &tls.Config{
-						InsecureSkipVerify: false, // Enable server certificate verification
-					}
-					creds := credentials.NewTLS(tlsConfig)
-					opts = append(opts, grpc.WithTransportCredentials(creds))
-				} else {
-					opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+				target, err := configs.ParseEndpoint(endpointName)
+				if err != nil {
+					pterm.Error.Println(err)
+					return
 				}
 
 				// Establish the connection
-				conn, err := grpc.Dial(hostPort, opts...)
+				conn, err := configs.Dial(target.HostPort, target.Secure)
 				if err != nil {
-					fmt.Errorf("connection failed: unable to connect to %s: %v", endpointName, err)
+					pterm.Error.Printf("connection failed: unable to connect to %s: %v\n", endpointName, err)
+					return
 				}
 				defer conn.Close()
 
+				ctx, cancel := rpc.Context()
+				defer cancel()
+
 				// Use Reflection to discover services
-				refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+				refClient := rpc.NewReflectionClient(ctx, conn)
 				defer refClient.Reset()
 
 				// Resolve the service and method
@@ -697,12 +719,14 @@ You can either specify a new endpoint URL directly or use the service-based endp
 
 				serviceDesc, err := refClient.ResolveService(serviceName)
 				if err != nil {
-					fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
+					pterm.Error.Printf("failed to resolve service %s: %v\n", serviceName, rpc.ContextError(ctx, err))
+					return
 				}
 
 				methodDesc := serviceDesc.FindMethodByName(methodName)
 				if methodDesc == nil {
-					fmt.Errorf("method not found: %s", methodName)
+					pterm.Error.Printf("method not found: %s\n", methodName)
+					return
 				}
 
 				// Dynamically create the request message
@@ -723,16 +747,18 @@ You can either specify a new endpoint URL directly or use the service-based endp
 				fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
 
 				// Invoke the gRPC method
-				err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+				err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 				if err != nil {
-					fmt.Errorf("failed to invoke method %s: %v", fullMethod, err)
+					pterm.Error.Printf("failed to invoke method %s: %v\n", fullMethod, rpc.ContextError(ctx, err))
+					return
 				}
 
 				// Process the response to extract `service` and `endpoint`
 				endpoints = make(map[string]string)
 				resultsField := respMsg.FindFieldDescriptorByName("results")
 				if resultsField == nil {
-					fmt.Errorf("'results' field not found in response")
+					pterm.Error.Printf("'results' field not found in response\n")
+					return
 				}
 
 				results := respMsg.GetField(resultsField).([]interface{})
@@ -875,7 +901,7 @@ You can either specify a new endpoint URL directly or use the service-based endp
 	},
 }
 
-func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string]string, error) {
+func invokeGRPCEndpointList(hostPort string, secure bool) (map[string]string, error) {
 	// Wrap the entire operation in a function that can recover from panic
 	var endpoints = make(map[string]string)
 	var err error
@@ -894,14 +920,17 @@ func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string
 	}()
 
 	// Establish the connection
-	conn, err := grpc.Dial(hostPort, opts...)
+	conn, err := configs.Dial(hostPort, secure)
 	if err != nil {
 		return nil, fmt.Errorf("connection failed: unable to connect to %s: %v", hostPort, err)
 	}
 	defer conn.Close()
 
+	ctx, cancel := rpc.Context()
+	defer cancel()
+
 	// Use Reflection to discover services
-	refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+	refClient := rpc.NewReflectionClient(ctx, conn)
 	defer refClient.Reset()
 
 	serviceName := "spaceone.api.identity.v2.Endpoint"
@@ -909,7 +938,7 @@ func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string
 
 	serviceDesc, err := refClient.ResolveService(serviceName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
+		return nil, fmt.Errorf("failed to resolve service %s: %v", serviceName, rpc.ContextError(ctx, err))
 	}
 
 	methodDesc := serviceDesc.FindMethodByName(methodName)
@@ -921,9 +950,9 @@ func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string
 	respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
 	fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
 
-	err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+	err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to invoke method %s: %v", fullMethod, err)
+		return nil, fmt.Errorf("failed to invoke method %s: %v", fullMethod, rpc.ContextError(ctx, err))
 	}
 
 	resultsField := respMsg.FindFieldDescriptorByName("results")
@@ -991,7 +1020,10 @@ func fetchAvailableServices(identityEndpoint, restIdentityEndpoint string, hasId
 
 	if !hasIdentityEndpoint {
 		// Create HTTP client and request
-		client := &http.Client{}
+		client, err := configs.HTTPClient()
+		if err != nil {
+			return nil, err
+		}
 
 		// Define response structure
 		type EndpointResponse struct {
@@ -1004,7 +1036,10 @@ func fetchAvailableServices(identityEndpoint, restIdentityEndpoint string, hasId
 		}
 
 		// Create and send request
-		req, err := http.NewRequest("POST", restIdentityEndpoint+"/endpoint/list", bytes.NewBuffer([]byte("{}")))
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", restIdentityEndpoint+"/endpoint/list", bytes.NewBuffer([]byte("{}")))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create request: %v", err)
 		}
@@ -1014,7 +1049,7 @@ func fetchAvailableServices(identityEndpoint, restIdentityEndpoint string, hasId
 
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("failed to send request: %v", err)
+			return nil, fmt.Errorf("failed to send request: %v", rpc.ContextError(ctx, err))
 		}
 		defer resp.Body.Close()
 
@@ -1042,42 +1077,37 @@ func fetchAvailableServices(identityEndpoint, restIdentityEndpoint string, hasId
 			port = "443" // Default gRPC port
 		}
 
-		var opts []grpc.DialOption
-
-		// Set up TLS credentials if the scheme is grpc+ssl://
-		if strings.HasPrefix(identityEndpoint, "grpc+ssl://") {
-			tlsSetting := &tls.Config{
-				InsecureSkipVerify: false, // Set to true only if you want to skip TLS verification (not recommended)
-			}
-			creds := credentials.NewTLS(tlsSetting)
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-		} else {
+		// Only grpc+ssl:// endpoints are supported here
+		if !strings.HasPrefix(identityEndpoint, "grpc+ssl://") {
 			return nil, fmt.Errorf("unsupported scheme in endpoint: %s", identityEndpoint)
 		}
 
+		var opts []grpc.DialOption
+
 		// Add token-based authentication if a token is provided
 		if token != "" {
-			opts = append(opts, grpc.WithPerRPCCredentials(&tokenCreds{token}))
+			opts = append(opts, grpc.WithPerRPCCredentials(&tokenCreds{token: token, secure: true}))
 		}
 
 		// Establish a connection to the gRPC server
-		conn, err := grpc.Dial(fmt.Sprintf("%s:%s", host, port), opts...)
+		conn, err := configs.Dial(fmt.Sprintf("%s:%s", host, port), true, opts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to dial gRPC endpoint: %w", err)
 		}
 		defer conn.Close()
 
-		ctx := context.Background()
+		ctx, cancel := rpc.Context()
+		defer cancel()
 
 		// Create a reflection client to discover services and methods
-		refClient := grpcreflect.NewClient(ctx, grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+		refClient := rpc.NewReflectionClient(ctx, conn)
 		defer refClient.Reset()
 
 		// Resolve the service descriptor for "spaceone.api.identity.v2.Endpoint"
 		serviceName := "spaceone.api.identity.v2.Endpoint"
 		svcDesc, err := refClient.ResolveService(serviceName)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve service %s: %w", serviceName, err)
+			return nil, fmt.Errorf("failed to resolve service %s: %w", serviceName, rpc.ContextError(ctx, err))
 		}
 
 		// Resolve the method descriptor for the "List" method
@@ -1108,7 +1138,7 @@ func fetchAvailableServices(identityEndpoint, restIdentityEndpoint string, hasId
 		//err = grpc.Invoke(ctx, fmt.Sprintf("/%s/%s", serviceName, methodName), reqMsg, conn, respMsg)
 		err = conn.Invoke(ctx, fmt.Sprintf("/%s/%s", serviceName, methodName), reqMsg, respMsg)
 		if err != nil {
-			return nil, fmt.Errorf("failed to invoke RPC: %w", err)
+			return nil, fmt.Errorf("failed to invoke RPC: %w", rpc.ContextError(ctx, err))
 		}
 
 		// Extract the 'results' field from the response message
@@ -1175,7 +1205,8 @@ func fetchAvailableServices(identityEndpoint, restIdentityEndpoint string, hasId
 
 // tokenCreds implements grpc.PerRPCCredentials for token-based authentication.
 type tokenCreds struct {
-	token string
+	token  string
+	secure bool // Whether the connection uses TLS
 }
 
 func (t *tokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
@@ -1185,7 +1216,7 @@ func (t *tokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map
 }
 
 func (t *tokenCreds) RequireTransportSecurity() bool {
-	return true
+	return t.secure
 }
 
 // getBaseURL retrieves the base URL for the current environment from the given Viper instance.
@@ -1315,7 +1346,7 @@ func updateGlobalSetting() {
 }
 
 func parseEnvNameFromURL(urlStr string) (string, error) {
-	isGRPC := strings.HasPrefix(urlStr, "grpc://") || strings.HasPrefix(urlStr, "grpc+ssl://")
+	isGRPC := configs.IsGRPCEndpoint(urlStr)
 
 	urlStr = strings.TrimPrefix(urlStr, "https://")
 	urlStr = strings.TrimPrefix(urlStr, "http://")
@@ -1402,7 +1433,7 @@ func updateSetting(envName, endpoint, envSuffix string, internal bool) {
 		} else {
 			v.Set(proxyKey, isProxy)
 		}
-	} else if strings.HasPrefix(endpoint, "grpc://") {
+	} else if strings.HasPrefix(endpoint, "grpc://") || strings.HasPrefix(endpoint, "grpc+unix://") {
 		v.Set(proxyKey, false)
 	} else {
 		v.Set(proxyKey, true)
@@ -1432,8 +1463,10 @@ func getInternalEndpoint(endpoint string) (string, error) {
 		}
 		defer conn.Close()
 
-		client := grpc_reflection_v1alpha.NewServerReflectionClient(conn)
-		refClient := grpcreflect.NewClient(context.Background(), client)
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
+		refClient := rpc.NewReflectionClient(ctx, conn)
 		defer refClient.Reset()
 
 		serviceName := "spaceone.api.identity.v2.Endpoint"
@@ -1441,7 +1474,7 @@ func getInternalEndpoint(endpoint string) (string, error) {
 
 		serviceDesc, err := refClient.ResolveService(serviceName)
 		if err != nil {
-			return "", fmt.Errorf("failed to resolve service: %v", err)
+			return "", fmt.Errorf("failed to resolve service: %v", rpc.ContextError(ctx, err))
 		}
 
 		methodDesc := serviceDesc.FindMethodByName(methodName)
@@ -1457,8 +1490,8 @@ func getInternalEndpoint(endpoint string) (string, error) {
 		respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
 		fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
 
-		if err := conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg); err != nil {
-			return "", fmt.Errorf("failed to invoke method: %v", err)
+		if err := conn.Invoke(ctx, fullMethod, reqMsg, respMsg); err != nil {
+			return "", fmt.Errorf("failed to invoke method: %v", rpc.ContextError(ctx, err))
 		}
 
 		results, err := respMsg.TryGetField(respMsg.GetMessageDescriptor().FindFieldByName("results"))
@@ -1476,7 +1509,10 @@ func getInternalEndpoint(endpoint string) (string, error) {
 	} else {
 		// Handle REST endpoint
 		// 1. First get the console API endpoint from config
-		client := &http.Client{}
+		client, err := configs.HTTPClient()
+		if err != nil {
+			return "", err
+		}
 		configResp, err := client.Get(endpoint + "/config/production.json")
 		if err != nil {
 			return "", fmt.Errorf("failed to get config: %v", err)
@@ -1505,7 +1541,10 @@ func getInternalEndpoint(endpoint string) (string, error) {
 			return "", fmt.Errorf("failed to marshal request body: %v", err)
 		}
 
-		req, err := http.NewRequest("POST", config.ConsoleAPIV2.Endpoint+"/identity/endpoint/list", bytes.NewBuffer(jsonBody))
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", config.ConsoleAPIV2.Endpoint+"/identity/endpoint/list", bytes.NewBuffer(jsonBody))
 		if err != nil {
 			return "", fmt.Errorf("failed to create request: %v", err)
 		}
@@ -1515,7 +1554,7 @@ func getInternalEndpoint(endpoint string) (string, error) {
 
 		resp, err := client.Do(req)
 		if err != nil {
-			return "", fmt.Errorf("failed to send request: %v", err)
+			return "", fmt.Errorf("failed to send request: %v", rpc.ContextError(ctx, err))
 		}
 		defer resp.Body.Close()
 
@@ -1649,6 +1688,8 @@ func init() {
 	settingInitProxyCmd.Flags().Bool("user", false, "Initialize as user-specific configuration")
 	settingInitProxyCmd.Flags().Bool("internal", false, "Use internal endpoint for the environment")
 
+	settingInitStaticCmd.Flags().String("authority", "", "Host name to present to the server, e.g. when dialing an IP")
+
 	envCmd.Flags().StringP("switch", "s", "", "Switch to a different environment")
 	envCmd.Flags().StringP("remove", "r", "", "Remove an environment")
 	envCmd.Flags().BoolP("list", "l", false, "List available environments")
@@ -1,20 +1,20 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cloudforet-io/cfctl/cmd/common"
+	"github.com/cloudforet-io/cfctl/pkg/client"
 	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/cloudforet-io/cfctl/pkg/transport"
-	"github.com/jhump/protoreflect/grpcreflect"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"gopkg.in/yaml.v3"
 
 	"github.com/spf13/viper"
@@ -29,9 +29,10 @@ var cachedEndpointsMap map[string]string
 
 // Config represents the configuration structure
 type Config struct {
-	Environment string
-	Endpoint    string
-	Token       string
+	Environment      string
+	Endpoint         string
+	EndpointTemplate string
+	Token            string
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -42,10 +43,25 @@ var rootCmd = &cobra.Command{
   Find more information at: 
     - https://github.com/cloudforet-io/cfctl
     - https://docs.spaceone.megazone.io/docs/developers/cfctl (English)
-    - https://docs.spaceone.megazone.io/ko/docs/developers/cfctl (Korean)`,
+    - https://docs.spaceone.megazone.io/ko/docs/developers/cfctl (Korean)
+
+  Exit codes:
+    0    success
+    1    any other error, including invalid flags
+    2    missing or invalid setting
+    3    authentication failed or no token
+    4    service, resource, verb or resource ID not found
+    5    invalid or missing parameter
+    6    service unavailable or request timed out
+    130  interrupted with Ctrl+C`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		verbosity, _ := cmd.Flags().GetInt("verbosity")
+		rpc.SetVerbosity(verbosity)
+		return applyTimeout(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -58,9 +74,84 @@ func Execute() {
 		}
 	}
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	rpc.HandleInterrupt()
+
+	err := rootCmd.Execute()
+	client.CloseConnections()
+	if err != nil {
+		os.Exit(transport.ExitCode(err))
+	}
+}
+
+// applyTimeout sets the request time limit from --timeout, falling back to the timeout
+// of the current environment in setting.yaml
+func applyTimeout(cmd *cobra.Command) error {
+	if flag := cmd.Flags().Lookup("timeout"); flag != nil && flag.Changed {
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		rpc.SetTimeout(timeout)
+		return nil
 	}
+
+	// Commands such as login and setting also run before a setting exists
+	v := viper.New()
+	home, _ := os.UserHomeDir()
+	v.SetConfigFile(filepath.Join(home, ".cfctl", "setting.yaml"))
+	if err := v.ReadInConfig(); err != nil {
+		return nil
+	}
+
+	env := v.GetString("environment")
+	value := v.GetString(fmt.Sprintf("environments.%s.timeout", env))
+	if value == "" {
+		return nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		// A bad setting is not a usage mistake, so keep the help text out of it
+		cmd.SilenceUsage = true
+		return fmt.Errorf("invalid timeout '%s' in environment %s: %v", value, env, err)
+	}
+	rpc.SetTimeout(timeout)
+	return nil
+}
+
+// verbosityFromArgs finds -v/--verbosity in args ahead of cobra's parsing; anything it
+// cannot read is left for cobra to report
+func verbosityFromArgs(args []string) int {
+	// alias add takes -v for the aliased command
+	if len(args) > 0 && args[0] == "alias" {
+		return 0
+	}
+
+	level := 0
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		var value string
+		switch {
+		case arg == "-v" || arg == "--verbosity":
+			if i+1 < len(args) {
+				value = args[i+1]
+			}
+		case strings.HasPrefix(arg, "--verbosity="):
+			value = strings.TrimPrefix(arg, "--verbosity=")
+		case strings.HasPrefix(arg, "-v=") || (strings.HasPrefix(arg, "-v") && len(arg) > 2):
+			value = strings.TrimPrefix(strings.TrimPrefix(arg, "-v"), "=")
+		default:
+			continue
+		}
+
+		if n, err := strconv.Atoi(value); err == nil {
+			level = n
+		}
+	}
+	return level
 }
 
 func getAliasCommand(alias string) string {
@@ -83,10 +174,20 @@ func init() {
 	}
 	rootCmd.AddGroup(AvailableCommands)
 
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Time limit for each request, e.g. 30s or 2m (0 for none; defaults to the environment's timeout setting)")
+	rootCmd.PersistentFlags().IntP("verbosity", "v", 0, "Log diagnostics to stderr: 1 for config, endpoints and timings, 2 adds calls and metadata, 3 adds bodies (0 for none)")
+
+	// Service commands are discovered before flags are parsed, so look for the level now
+	rpc.SetVerbosity(verbosityFromArgs(os.Args[1:]))
+
 	done := make(chan bool)
 	go func() {
-		if endpoints, err := loadCachedEndpoints(); err == nil {
+		endpoints, err := loadCachedEndpoints()
+		if err == nil {
 			cachedEndpointsMap = endpoints
+			rpc.Logf(rpc.LevelInfo, "endpoint cache hit: %d services", len(endpoints))
+		} else {
+			rpc.Logf(rpc.LevelInfo, "endpoint cache miss: %v", err)
 		}
 		done <- true
 	}()
@@ -259,15 +360,16 @@ func addDynamicServiceCommands() error {
 
 	// For non-local environments
 	endpointName := config.Endpoint
-	var apiEndpoint string
 
-	// For local environment
-	if strings.Contains(config.Endpoint, ".svc.cluster.local") {
-		apiEndpoint = endpointName
-	} else if strings.HasPrefix(config.Endpoint, "grpc://") {
-		endpoint := strings.TrimPrefix(config.Endpoint, "grpc://")
+	// For local environment, including servers behind a Unix domain socket
+	isLocal := strings.HasPrefix(config.Endpoint, "grpc://") || strings.HasPrefix(config.Endpoint, "grpc+unix://")
+	if !strings.Contains(config.Endpoint, ".svc.cluster.local") && isLocal {
+		target, err := configs.ParseEndpoint(config.Endpoint)
+		if err != nil {
+			return err
+		}
 
-		conn, err := grpc.Dial(endpoint, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Second))
+		conn, err := configs.Dial(target.HostPort, false, grpc.WithBlock(), grpc.WithTimeout(time.Second))
 		if err != nil {
 			pterm.DefaultBox.WithTitle("Local gRPC Server Not Found").
 				WithTitleTopCenter().
@@ -282,8 +384,10 @@ func addDynamicServiceCommands() error {
 			}
 		}(conn)
 
-		ctx := context.Background()
-		refClient := grpcreflect.NewClientV1Alpha(ctx, grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+		ctx, cancel := rpc.Context()
+		defer cancel()
+
+		refClient := rpc.NewReflectionClient(ctx, conn)
 		defer refClient.Reset()
 
 		services, err := refClient.ListServices()
@@ -337,26 +441,11 @@ func addDynamicServiceCommands() error {
 		return nil
 	}
 
-	if strings.HasPrefix(endpointName, "grpc+ssl://") || strings.HasPrefix(endpointName, "grpc://") {
-		apiEndpoint = endpointName
-	} else if strings.HasPrefix(endpointName, "http://") || strings.HasPrefix(endpointName, "https://") {
-		apiEndpoint, err = configs.GetAPIEndpoint(endpointName)
-		if err != nil {
-			return fmt.Errorf("failed to get API endpoint: %v", err)
-		}
-	}
-
 	// Try to use cached endpoints first
 	if cachedEndpointsMap != nil {
 		currentService := ""
 		if strings.HasPrefix(endpointName, "grpc+ssl://") {
-			parts := strings.Split(endpointName, "://")
-			if len(parts) == 2 {
-				hostParts := strings.Split(parts[1], ".")
-				if len(hostParts) > 0 {
-					currentService = hostParts[0]
-				}
-			}
+			currentService = configs.ServiceOfEndpoint(endpointName)
 		}
 
 		if currentService != "identity" && currentService != "" {
@@ -383,30 +472,27 @@ func addDynamicServiceCommands() error {
 		Start()
 
 	progressbar.UpdateTitle("Fetching available service endpoints from the API server")
-	endpointsMap, err := configs.FetchEndpointsMap(apiEndpoint)
+	env := configs.CurrentEnvironment()
+	env.Endpoint, env.EndpointTemplate = config.Endpoint, config.EndpointTemplate
+	resolver := configs.NewResolver(config.Environment, env)
+	ctx, cancel := rpc.Context()
+	endpointsMap, err := resolver.Endpoints(ctx)
+	cancel()
 	if err != nil {
 		return fmt.Errorf("failed to fetch services: %v", err)
 	}
 	progressbar.Increment()
 
+	// The resolver caches the list for the next runs
 	progressbar.UpdateTitle(fmt.Sprintf("Caching endpoints to %s/.cfctl/cache for faster access", os.Getenv("HOME")))
 	cachedEndpointsMap = endpointsMap
-	if err := saveEndpointsCache(endpointsMap); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to cache endpoints: %v\n", err)
-	}
 	progressbar.Increment()
 
 	progressbar.UpdateTitle("Registering available service commands")
 	// Add commands based on the current service
 	currentService := ""
 	if strings.HasPrefix(endpointName, "grpc+ssl://") {
-		parts := strings.Split(endpointName, "://")
-		if len(parts) == 2 {
-			hostParts := strings.Split(parts[1], ".")
-			if len(hostParts) > 0 {
-				currentService = hostParts[0]
-			}
-		}
+		currentService = configs.ServiceOfEndpoint(endpointName)
 	}
 
 	if currentService != "identity" && currentService != "" {
@@ -455,60 +541,7 @@ func loadCachedEndpoints() (map[string]string, error) {
 		return nil, fmt.Errorf("no environment set")
 	}
 
-	cacheFile := filepath.Join(home, ".cfctl", "cache", settings.Environment, "endpoints.yaml")
-	data, err := os.ReadFile(cacheFile)
-	if err != nil {
-		return nil, err
-	}
-
-	cacheInfo, err := os.Stat(cacheFile)
-	if err != nil {
-		return nil, err
-	}
-
-	if time.Since(cacheInfo.ModTime()) > 24*time.Hour {
-		return nil, fmt.Errorf("cache expired")
-	}
-
-	var endpoints map[string]string
-	if err := yaml.Unmarshal(data, &endpoints); err != nil {
-		return nil, err
-	}
-
-	return endpoints, nil
-}
-
-func saveEndpointsCache(endpoints map[string]string) error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-
-	// Get current environment from main setting file
-	mainV := viper.New()
-	mainV.SetConfigFile(filepath.Join(home, ".cfctl", "setting.yaml"))
-	mainV.SetConfigType("yaml")
-	if err := mainV.ReadInConfig(); err != nil {
-		return err
-	}
-
-	currentEnv := mainV.GetString("environment")
-	if currentEnv == "" {
-		return fmt.Errorf("no environment set")
-	}
-
-	// Create environment-specific cache directory
-	envCacheDir := filepath.Join(home, ".cfctl", "cache", currentEnv)
-	if err := os.MkdirAll(envCacheDir, 0755); err != nil {
-		return err
-	}
-
-	data, err := yaml.Marshal(endpoints)
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(filepath.Join(envCacheDir, "endpoints.yaml"), data, 0644)
+	return configs.LoadEndpointsCache(settings.Environment)
 }
 
 // loadConfig loads configuration from both main and cache setting files
@@ -545,8 +578,9 @@ func loadConfig() (*Config, error) {
 	}
 
 	config := &Config{
-		Environment: currentEnv,
-		Endpoint:    endpointName,
+		Environment:      currentEnv,
+		Endpoint:         endpointName,
+		EndpointTemplate: envConfig.GetString("endpoint_template"),
 	}
 
 	if strings.HasSuffix(currentEnv, "-app") {
@@ -585,16 +619,37 @@ func createServiceCommand(serviceName string) *cobra.Command {
 			}
 
 			parameters, _ := cmd.Flags().GetStringArray("parameter")
-			jsonParameter, _ := cmd.Flags().GetString("json-parameter")
+			jsonParameters, _ := cmd.Flags().GetStringArray("json-parameter")
+			jsonParameter := ""
+			if len(jsonParameters) > 0 {
+				jsonParameter = jsonParameters[0]
+			}
 			fileParameter, _ := cmd.Flags().GetString("file-parameter")
 			outputFormat, _ := cmd.Flags().GetString("output")
 			copyToClipboard, _ := cmd.Flags().GetBool("copy")
+			filters, _ := cmd.Flags().GetStringArray("filter")
+			query, _ := cmd.Flags().GetString("query")
+			noInteractive, _ := cmd.Flags().GetBool("no-interactive")
+			delimiter, _ := cmd.Flags().GetString("delimiter")
+			noHeaders, _ := cmd.Flags().GetBool("no-headers")
+			maxAttempts, _ := cmd.Flags().GetInt("max-attempts")
+			forceRetry, _ := cmd.Flags().GetBool("force-retry")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			headers, _ := cmd.Flags().GetStringArray("header")
+			token, _ := cmd.Flags().GetString("token")
+			tokenFile, _ := cmd.Flags().GetString("token-file")
+			maxRecvSize, _ := cmd.Flags().GetString("max-recv-size")
+			maxSendSize, _ := cmd.Flags().GetString("max-send-size")
+			compression, _ := cmd.Flags().GetString("compression")
+			authority, _ := cmd.Flags().GetString("authority")
 
 			sortBy := ""
 			columns := ""
 			rows := 0
 			pageSize := 100
 			noPaging := false
+			allPages := false
+			allPageSize := 0
 
 			if verb == "list" {
 				sortBy, _ = cmd.Flags().GetString("sort")
@@ -602,11 +657,14 @@ func createServiceCommand(serviceName string) *cobra.Command {
 				rows, _ = cmd.Flags().GetInt("rows")
 				pageSize, _ = cmd.Flags().GetInt("rows-per-page")
 				noPaging, _ = cmd.Flags().GetBool("no-paging")
+				allPages, _ = cmd.Flags().GetBool("all")
+				allPageSize, _ = cmd.Flags().GetInt("page-size")
 			}
 
 			options := &transport.FetchOptions{
 				Parameters:           parameters,
 				JSONParameter:        jsonParameter,
+				JSONParameters:       jsonParameters,
 				FileParameter:        fileParameter,
 				OutputFormat:         outputFormat,
 				OutputFormatExplicit: cmd.Flags().Changed("output"),
@@ -617,21 +675,42 @@ func createServiceCommand(serviceName string) *cobra.Command {
 				Rows:                 rows,
 				PageSize:             pageSize,
 				NoPaging:             noPaging,
+				AllPages:             allPages,
+				AllPageSize:          allPageSize,
+				Filters:              filters,
+				Query:                query,
+				NoInteractive:        noInteractive,
+				CSVDelimiter:         delimiter,
+				NoHeaders:            noHeaders,
+				MaxAttempts:          maxAttempts,
+				ForceRetry:           forceRetry,
+				DryRun:               dryRun,
+				Headers:              headers,
+				Token:                token,
+				TokenFile:            tokenFile,
+				MaxRecvSize:          maxRecvSize,
+				MaxSendSize:          maxSendSize,
+				Compression:          compression,
+				Authority:            authority,
 			}
 
 			if verb == "list" && !cmd.Flags().Changed("output") {
 				options.OutputFormat = "table"
 			}
 
+			var err error
 			watch, _ := cmd.Flags().GetBool("watch")
-			if watch && verb == "list" {
-				return transport.WatchResource(serviceName, verb, resource, options)
+			if watch && verb == "list" && !dryRun {
+				err = transport.WatchResource(serviceName, verb, resource, options)
+			} else {
+				_, err = transport.FetchService(serviceName, verb, resource, options)
 			}
-
-			_, err := transport.FetchService(serviceName, verb, resource, options)
 			if err != nil {
-				pterm.Error.Println(err.Error())
-				return nil
+				// The error is shown here; Execute only turns it into the exit code
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				transport.ReportError(err, outputFormat)
+				return err
 			}
 			return nil
 		},
@@ -642,19 +721,36 @@ func createServiceCommand(serviceName string) *cobra.Command {
 
 	// Add list-specific flags
 	cmd.Flags().BoolP("watch", "w", false, "Watch for changes")
-	cmd.Flags().StringP("sort", "s", "", "Sort by field (e.g. 'name', 'created_at')")
+	cmd.Flags().StringP("sort", "s", "", "Sort by fields (e.g. 'name', 'created_at:desc', 'provider,name')")
 	cmd.Flags().BoolP("minimal", "m", false, "Show minimal columns")
 	cmd.Flags().StringP("columns", "c", "", "Specific columns (-c id,name)")
 	cmd.Flags().IntP("rows", "r", 0, "Number of rows")
 	cmd.Flags().IntP("rows-per-page", "n", 15, "Number of rows per page")
 	cmd.Flags().BoolP("no-paging", "", false, "Disable pagination and show all results")
+	cmd.Flags().BoolP("no-interactive", "", false, "Print tables as plain text instead of the interactive pager (default when stdout is not a terminal)")
+	cmd.Flags().BoolP("all", "", false, "Fetch every page of a list until total_count is reached, from the start and limit of query.page if given")
+	cmd.Flags().IntP("page-size", "", client.DefaultPageSize, "Number of items requested per page with --all")
 
 	// Add existing flags
 	cmd.Flags().StringArrayP("parameter", "p", []string{}, "Input Parameter (-p <key>=<value> -p ...)")
-	cmd.Flags().StringP("json-parameter", "j", "", "JSON type parameter")
-	cmd.Flags().StringP("file-parameter", "f", "", "YAML file parameter")
-	cmd.Flags().StringP("output", "o", "yaml", "Output format (yaml, json, table, csv)")
+	cmd.Flags().StringArrayP("json-parameter", "j", []string{}, "JSON type parameter; repeat to send several messages to a streaming method")
+	cmd.Flags().StringArrayP("filter", "", []string{}, "Server-side query filter (--filter state=ACTIVE --filter 'name~prod' --filter 'provider in aws,azure')")
+	cmd.Flags().StringP("file-parameter", "f", "", "YAML file parameter ('-' for stdin); every document is a message for streaming methods")
+	cmd.Flags().StringP("output", "o", "yaml", "Output format (yaml, json, ndjson, table, csv, tsv, template=<text>, template-file=<path>, custom-columns=<HEADER>:<path>,...)")
+	cmd.Flags().StringP("query", "q", "", "jq or JSONPath ($...) expression applied to the response (-q '.results[] | {name, state}')")
 	cmd.Flags().BoolP("copy", "y", false, "Copy the output to the clipboard")
+	cmd.Flags().StringP("delimiter", "", "", "Field delimiter for csv output (default ',' for csv and tab for tsv)")
+	cmd.Flags().BoolP("no-headers", "", false, "Omit the header row from csv and tsv output")
+	cmd.Flags().IntP("max-attempts", "", 0, "Attempts for calls failing with a transient error (default from the environment's retry setting, or 3)")
+	cmd.Flags().BoolP("force-retry", "", false, "Also retry verbs other than list, get, stat and analyze, such as create and delete")
+	cmd.Flags().BoolP("dry-run", "", false, "Print the resolved endpoint, method and request without sending it")
+	cmd.Flags().StringArrayP("header", "H", []string{}, "Extra gRPC metadata sent with the call (-H x-request-id=abc -H ...)")
+	cmd.Flags().StringP("token", "", "", "Token to use for this call instead of the environment's")
+	cmd.Flags().StringP("token-file", "", "", "File holding the token to use for this call instead of the environment's")
+	cmd.Flags().StringP("max-recv-size", "", "", "Largest response message to accept, e.g. 32MB (default from the environment's max_recv_size, or 10MB)")
+	cmd.Flags().StringP("max-send-size", "", "", "Largest request message to send, e.g. 32MB (default from the environment's max_send_size, or 10MB)")
+	cmd.Flags().StringP("compression", "", "", "Compress messages with gzip, or none to turn the environment's compression off")
+	cmd.Flags().StringP("authority", "", "", "Host name to present to the server, e.g. when dialing an IP (default from the environment's authority)")
 
 	return cmd
 }
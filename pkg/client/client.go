@@ -0,0 +1,693 @@
+// Package client provides an embeddable Go API for calling SpaceONE services.
+//
+// Unlike the cobra commands, a Client never prints, prompts or exits the process:
+// every failure is reported as an *Error so that callers can decide how to render it.
+// The only output is the diagnostics written to stderr once rpc.SetVerbosity is called.
+//
+// Connections are shared by every Client of the process and kept open between calls;
+// CloseConnections closes them.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Result is a decoded response message
+type Result map[string]interface{}
+
+// Results returns the "results" list of a list-style response, or nil if there is none
+func (r Result) Results() []interface{} {
+	results, _ := r["results"].([]interface{})
+	return results
+}
+
+// Client calls SpaceONE services of a single environment
+type Client struct {
+	name     string
+	env      configs.Environment
+	cacheDir string
+	retry    RetryPolicy
+	headers  metadata.MD
+	resolver *configs.Resolver
+	messages MessageOptions
+
+	transport    string
+	mu           sync.Mutex // Guards useREST and restEndpoint, set by the first call
+	useREST      bool       // Whether calls go through the console API, decided on first use by auto
+	restEndpoint string     // Console API endpoint, found on the first REST call
+}
+
+// New creates a Client for the named environment
+func New(name string, env configs.Environment) (*Client, error) {
+	if env.Endpoint == "" {
+		return nil, &Error{Kind: KindConfig, Err: fmt.Errorf("endpoint not found in environment %s", name)}
+	}
+
+	retry, err := retryPolicyFromConfig(env.Retry)
+	if err != nil {
+		return nil, &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", name), Err: err}
+	}
+
+	messages, err := messageOptionsFromConfig(env)
+	if err != nil {
+		return nil, &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", name), Err: err}
+	}
+
+	transport, err := transportFromConfig(env.Transport)
+	if err != nil {
+		return nil, &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", name), Err: err}
+	}
+
+	// A missing home directory only disables the descriptor cache
+	cacheDir, _ := rpc.DescriptorCacheDir(name)
+
+	return &Client{name: name, env: env, cacheDir: cacheDir, retry: retry, resolver: configs.NewResolver(name, env), messages: messages,
+		transport: transport, useREST: transport == TransportREST}, nil
+}
+
+// NewFromSetting creates a Client for the current environment of ~/.cfctl/setting.yaml
+func NewFromSetting() (*Client, error) {
+	setting, err := configs.SetSettingFile()
+	if err != nil {
+		return nil, &Error{Kind: KindConfig, Op: "load setting", Err: err}
+	}
+
+	return New(setting.Environment, setting.Environments[setting.Environment])
+}
+
+// Environment returns the name of the environment the client talks to
+func (c *Client) Environment() string {
+	return c.name
+}
+
+// Endpoint returns the configured endpoint of the environment
+func (c *Client) Endpoint() string {
+	return c.env.Endpoint
+}
+
+// RetryPolicy returns the policy used for transient failures, taken from the environment
+func (c *Client) RetryPolicy() RetryPolicy {
+	return c.retry
+}
+
+// SetRetryPolicy replaces the policy used for transient failures
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy
+}
+
+// SetToken replaces the token of the environment for the calls of this client only
+func (c *Client) SetToken(token string) {
+	c.env.Token = token
+}
+
+// SetAuthority replaces the authority setting of the environment for the calls of this
+// client only, e.g. to reach a virtual host or verify its certificate when dialing an IP.
+// Certificates are then verified against it rather than tls.server_name.
+func (c *Client) SetAuthority(authority string) {
+	c.env.Authority = authority
+	c.env.TLS.ServerName = ""
+}
+
+// AddHeader adds a metadata entry, such as a tracing ID or a feature flag, to every call.
+// Keys are case-insensitive; the token is set with SetToken instead.
+func (c *Client) AddHeader(key, value string) error {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if err := validHeaderKey(key); err != nil {
+		return &Error{Kind: KindInvalidArgument, Op: "invalid header", Err: err}
+	}
+
+	if c.headers == nil {
+		c.headers = metadata.MD{}
+	}
+	c.headers.Append(key, value)
+	return nil
+}
+
+// Headers returns the metadata entries added with AddHeader
+func (c *Client) Headers() metadata.MD {
+	return c.headers.Copy()
+}
+
+// validHeaderKey rejects keys gRPC would refuse or that would clash with the token
+func validHeaderKey(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("empty key")
+	case key == "token":
+		return fmt.Errorf("the token can't be set as a header, use --token instead")
+	case strings.HasPrefix(key, "grpc-"):
+		return fmt.Errorf("'%s' uses the reserved grpc- prefix", key)
+	}
+
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("'%s' may only contain letters, digits, '-', '_' and '.'", key)
+		}
+	}
+	return nil
+}
+
+// Invoke calls verb on the resource of the given service with params as the request body.
+// Server-streaming responses are collected into a single Result with a "results" list.
+func (c *Client) Invoke(ctx context.Context, service, resource, verb string, params map[string]interface{}) (Result, error) {
+	sess, err := c.connect(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.close()
+
+	methodDesc, fullMethod, err := sess.resolveMethod(service, resource, verb)
+	if err != nil {
+		return nil, err
+	}
+
+	return sess.call(methodDesc, fullMethod, params)
+}
+
+// MessageHandler receives each decoded response message of Stream
+type MessageHandler func(Result) error
+
+// Stream calls verb like Invoke but hands every response message to handle as soon as it
+// arrives, so long server streams are never buffered. Unary methods call handle once.
+// An error returned by handle stops the stream and is returned as-is.
+func (c *Client) Stream(ctx context.Context, service, resource, verb string, params map[string]interface{}, handle MessageHandler) error {
+	sess, err := c.connect(ctx, service)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	methodDesc, fullMethod, err := sess.resolveMethod(service, resource, verb)
+	if err != nil {
+		return err
+	}
+
+	if sess.rest == nil && methodDesc.IsClientStreaming() {
+		defer rpc.Phase("stream")()
+		return sess.exchange(methodDesc, fullMethod, singleRequest(params), decodeTo(handle))
+	}
+
+	// Calls through the console API are always unary; call rejects streaming methods
+	if sess.rest != nil || !methodDesc.IsServerStreaming() {
+		result, err := sess.call(methodDesc, fullMethod, params)
+		if err != nil {
+			return err
+		}
+		return handle(result)
+	}
+
+	reqMsg, err := newRequestMessage(methodDesc, params)
+	if err != nil {
+		return err
+	}
+
+	// Time spent in handle, such as rendering, is included since it runs as messages arrive
+	defer rpc.Phase("stream")()
+
+	// A stream is only sent again while none of its messages reached handle
+	delivered := false
+	onMessage := decodeTo(func(result Result) error {
+		delivered = true
+		return handle(result)
+	})
+
+	return sess.retry.do(ctx, verb, func() error {
+		err := sess.recvServerStream(methodDesc, fullMethod, reqMsg, onMessage)
+		if err != nil && delivered {
+			return &finalError{err: err}
+		}
+		return err
+	})
+}
+
+// RequestSource returns the next request message of a client stream, or io.EOF once
+// there are no more
+type RequestSource func() (map[string]interface{}, error)
+
+// StreamRequests calls a client-streaming or bidirectional verb. Every request from next
+// is sent on the stream while each response message is handed to handle as it arrives.
+// Methods that do not stream requests are called with the first request only.
+func (c *Client) StreamRequests(ctx context.Context, service, resource, verb string, next RequestSource, handle MessageHandler) error {
+	sess, err := c.connect(ctx, service)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	methodDesc, fullMethod, err := sess.resolveMethod(service, resource, verb)
+	if err != nil {
+		return err
+	}
+
+	if sess.rest != nil || !methodDesc.IsClientStreaming() {
+		params, err := next()
+		if err != nil && err != io.EOF {
+			return &Error{Kind: KindInvalidArgument, Op: "read request", Err: err}
+		}
+		return c.Stream(ctx, service, resource, verb, params, handle)
+	}
+
+	defer rpc.Phase("stream")()
+	return sess.exchange(methodDesc, fullMethod, next, decodeTo(handle))
+}
+
+// singleRequest is a RequestSource yielding params once
+func singleRequest(params map[string]interface{}) RequestSource {
+	sent := false
+	return func() (map[string]interface{}, error) {
+		if sent {
+			return nil, io.EOF
+		}
+		sent = true
+		return params, nil
+	}
+}
+
+// decodeTo adapts a MessageHandler to the JSON encoded messages of a stream
+func decodeTo(handle MessageHandler) func([]byte) error {
+	return func(jsonBytes []byte) error {
+		var result Result
+		if err := json.Unmarshal(jsonBytes, &result); err != nil {
+			return &Error{Kind: KindUnknown, Op: "decode response", Err: err}
+		}
+		return handle(result)
+	}
+}
+
+// ResolveMethod returns the descriptor of verb on the resource of the given service
+func (c *Client) ResolveMethod(ctx context.Context, service, resource, verb string) (*desc.MethodDescriptor, error) {
+	sess, err := c.connect(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.close()
+
+	methodDesc, _, err := sess.resolveMethod(service, resource, verb)
+	if err == nil && methodDesc == nil {
+		return nil, &Error{Kind: KindNotFound, Err: fmt.Errorf("%w of %s.%s, so the rest transport can't describe it", ErrNoDescriptor, service, resource)}
+	}
+	return methodDesc, err
+}
+
+// session bundles a pooled connection and a descriptor reflector for the calls of a single
+// operation on a service
+type session struct {
+	ctx       context.Context
+	conn      *grpc.ClientConn
+	reflector *rpc.Reflector
+	retry     RetryPolicy
+	target    string
+	secure    bool
+	callOpts  []grpc.CallOption
+	rest      *restTarget // Set when calls go through the console API rather than conn
+}
+
+// close releases the reflection stream of the session; the connection stays in the pool
+func (s *session) close() {
+	s.reflector.Close()
+}
+
+func (c *Client) connect(ctx context.Context, service string) (*session, error) {
+	if c.env.Token == "" {
+		return nil, &Error{Kind: KindAuth, Err: ErrNoToken}
+	}
+
+	if c.usesREST() {
+		return c.restSession(ctx, service)
+	}
+
+	hostPort, secure, err := c.hostPort(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	stopDial := rpc.Phase("dial")
+	pc, err := pool.get(c.env, hostPort, secure)
+	stopDial()
+	if errors.Is(err, configs.ErrDialSetting) {
+		return nil, &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", c.name), Err: err}
+	}
+	if err != nil {
+		return nil, &Error{Kind: KindUnavailable, Op: fmt.Sprintf("unable to connect to %s", hostPort), Err: err}
+	}
+
+	// Only a console endpoint has an API to fall back to
+	if c.transport == TransportAuto && isConsoleEndpoint(c.env.Endpoint) && !grpcReachable(ctx, pc.conn) {
+		rpc.Logf(rpc.LevelInfo, "%s is unreachable over gRPC, using the console API", hostPort)
+		c.mu.Lock()
+		c.useREST = true
+		c.mu.Unlock()
+		return c.restSession(ctx, service)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "token", c.env.Token)
+	for key, values := range c.headers {
+		for _, value := range values {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+		}
+	}
+	reflector := pool.reflector(ctx, pc, c.cacheDir, service)
+
+	return &session{ctx: ctx, conn: pc.conn, reflector: reflector, retry: c.retry, target: hostPort, secure: secure,
+		callOpts: c.messages.callOptions()}, nil
+}
+
+// usesREST reports whether calls go through the console API
+func (c *Client) usesREST() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.useREST
+}
+
+// hostPort works out the address of the given service and whether it must be dialed over TLS
+func (c *Client) hostPort(ctx context.Context, service string) (string, bool, error) {
+	target, err := c.resolver.Resolve(ctx, service)
+	switch {
+	case errors.Is(err, configs.ErrInvalidEndpoint):
+		return "", false, &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", c.name), Err: err}
+	case errors.Is(err, configs.ErrUnknownService):
+		return "", false, &Error{Kind: KindNotFound, Err: err}
+	case err != nil:
+		return "", false, &Error{Kind: KindUnavailable, Op: fmt.Sprintf("failed to find the endpoint of %s", service), Err: err}
+	}
+
+	return target.HostPort, target.Secure, nil
+}
+
+// resolveMethod returns the descriptor of verb and the method to call: the full gRPC method
+// name, or the console API path in a REST session, where the descriptor may be nil
+func (s *session) resolveMethod(service, resource, verb string) (*desc.MethodDescriptor, string, error) {
+	if s.rest != nil {
+		return s.resolveRESTMethod(service, resource, verb)
+	}
+	return s.resolveDescriptor(service, resource, verb)
+}
+
+func (s *session) resolveDescriptor(service, resource, verb string) (*desc.MethodDescriptor, string, error) {
+	var fullServiceName string
+	var serviceDesc *desc.ServiceDescriptor
+	defer rpc.Phase("reflection")()
+
+	// Reflection only reads, so it is retried like a list whatever the verb
+	err := s.retry.do(s.ctx, "list", func() error {
+		var err error
+		fullServiceName, err = s.discoverService(service, resource)
+		if err != nil {
+			return err
+		}
+
+		serviceDesc, err = s.reflector.ResolveService(fullServiceName)
+		if err != nil {
+			return &Error{Kind: KindNotFound, Op: fmt.Sprintf("failed to resolve service %s", fullServiceName), Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	methodDesc := serviceDesc.FindMethodByName(verb)
+	if methodDesc == nil {
+		return nil, "", &Error{Kind: KindNotFound, Err: fmt.Errorf("method not found: %s", verb)}
+	}
+
+	return methodDesc, fmt.Sprintf("/%s/%s", fullServiceName, verb), nil
+}
+
+func (s *session) discoverService(service, resource string) (string, error) {
+	services, err := s.reflector.ListServices()
+	if err != nil {
+		return "", &Error{Kind: KindUnavailable, Op: "failed to list services", Err: err}
+	}
+
+	for _, svc := range services {
+		if strings.Contains(svc, ".plugin.") && strings.HasSuffix(svc, resource) {
+			return svc, nil
+		}
+	}
+
+	for _, svc := range services {
+		if strings.Contains(svc, fmt.Sprintf("spaceone.api.%s", service)) && strings.HasSuffix(svc, resource) {
+			return svc, nil
+		}
+	}
+
+	return "", &Error{Kind: KindNotFound, Err: fmt.Errorf("service not found for %s.%s", service, resource)}
+}
+
+// call sends params to the resolved method and decodes the response
+func (s *session) call(methodDesc *desc.MethodDescriptor, fullMethod string, params map[string]interface{}) (Result, error) {
+	if s.rest != nil {
+		return s.callREST(methodDesc, fullMethod, params)
+	}
+
+	reqMsg, err := newRequestMessage(methodDesc, params)
+	if err != nil {
+		return nil, err
+	}
+
+	stopInvoke := rpc.Phase("invoke")
+	var jsonBytes []byte
+	err = s.retry.do(s.ctx, verbOf(fullMethod), func() error {
+		var err error
+		switch {
+		case methodDesc.IsClientStreaming():
+			jsonBytes, err = s.invokeClientStream(methodDesc, fullMethod, params)
+		case methodDesc.IsServerStreaming():
+			jsonBytes, err = s.invokeServerStream(methodDesc, fullMethod, reqMsg)
+		default:
+			jsonBytes, err = s.invokeUnary(methodDesc, fullMethod, reqMsg)
+		}
+		return err
+	})
+	stopInvoke()
+	if err != nil {
+		return nil, err
+	}
+
+	var result Result
+	if err := json.Unmarshal(jsonBytes, &result); err != nil {
+		return nil, &Error{Kind: KindUnknown, Op: "decode response", Err: err}
+	}
+
+	return result, nil
+}
+
+// newRequestMessage builds the request message of methodDesc from params
+func newRequestMessage(methodDesc *desc.MethodDescriptor, params map[string]interface{}) (*dynamic.Message, error) {
+	reqMsg := dynamic.NewMessage(methodDesc.GetInputType())
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	jsonBytes, err := json.Marshal(params)
+	if err != nil {
+		return nil, &Error{Kind: KindInvalidArgument, Op: "failed to marshal input parameters to JSON", Err: err}
+	}
+
+	if err := reqMsg.UnmarshalJSON(jsonBytes); err != nil {
+		return nil, &Error{Kind: KindInvalidArgument, Op: "failed to unmarshal JSON into request message", Err: err}
+	}
+
+	return reqMsg, nil
+}
+
+func (s *session) invokeUnary(methodDesc *desc.MethodDescriptor, fullMethod string, reqMsg *dynamic.Message) ([]byte, error) {
+	respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
+	if err := s.conn.Invoke(s.ctx, fullMethod, reqMsg, respMsg, s.callOpts...); err != nil {
+		return nil, newRPCError(fullMethod, err)
+	}
+
+	return respMsg.MarshalJSON()
+}
+
+func (s *session) invokeServerStream(methodDesc *desc.MethodDescriptor, fullMethod string, reqMsg *dynamic.Message) ([]byte, error) {
+	var allResponses []string
+	err := s.recvServerStream(methodDesc, fullMethod, reqMsg, func(jsonBytes []byte) error {
+		allResponses = append(allResponses, string(jsonBytes))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allResponses) == 1 {
+		return []byte(allResponses[0]), nil
+	}
+
+	return []byte(fmt.Sprintf("{\"results\": [%s]}", strings.Join(allResponses, ","))), nil
+}
+
+// recvServerStream sends reqMsg and passes every response message, encoded as JSON, to
+// onMessage until the server ends the stream
+func (s *session) recvServerStream(methodDesc *desc.MethodDescriptor, fullMethod string, reqMsg *dynamic.Message, onMessage func([]byte) error) error {
+	streamDesc := &grpc.StreamDesc{
+		StreamName:    methodDesc.GetName(),
+		ServerStreams: true,
+		ClientStreams: false,
+	}
+
+	stream, err := s.conn.NewStream(s.ctx, streamDesc, fullMethod, s.callOpts...)
+	if err != nil {
+		return newRPCError(fullMethod, err)
+	}
+
+	if err := stream.SendMsg(reqMsg); err != nil {
+		return newRPCError(fullMethod, err)
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return newRPCError(fullMethod, err)
+	}
+
+	for {
+		respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
+		err := stream.RecvMsg(respMsg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return newRPCError(fullMethod, err)
+		}
+
+		jsonBytes, err := respMsg.MarshalJSON()
+		if err != nil {
+			return &Error{Kind: KindUnknown, Op: "failed to marshal response", Err: err}
+		}
+
+		if err := onMessage(jsonBytes); err != nil {
+			return err
+		}
+	}
+}
+
+// invokeClientStream sends params as the only message of a client stream and collects
+// the responses like invokeServerStream
+func (s *session) invokeClientStream(methodDesc *desc.MethodDescriptor, fullMethod string, params map[string]interface{}) ([]byte, error) {
+	var allResponses []string
+	err := s.exchange(methodDesc, fullMethod, singleRequest(params), func(jsonBytes []byte) error {
+		allResponses = append(allResponses, string(jsonBytes))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allResponses) == 1 {
+		return []byte(allResponses[0]), nil
+	}
+
+	return []byte(fmt.Sprintf("{\"results\": [%s]}", strings.Join(allResponses, ","))), nil
+}
+
+// exchange runs a client-streaming or bidirectional call. Requests from next are sent in
+// the background while responses, encoded as JSON, are passed to onMessage as they arrive.
+func (s *session) exchange(methodDesc *desc.MethodDescriptor, fullMethod string, next RequestSource, onMessage func([]byte) error) error {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	streamDesc := &grpc.StreamDesc{
+		StreamName:    methodDesc.GetName(),
+		ServerStreams: methodDesc.IsServerStreaming(),
+		ClientStreams: true,
+	}
+
+	stream, err := s.conn.NewStream(ctx, streamDesc, fullMethod, s.callOpts...)
+	if err != nil {
+		return newRPCError(fullMethod, err)
+	}
+
+	// The sender reports its error before cancelling, so a failed request is never
+	// mistaken for the cancellation it causes on the receiving side
+	sendDone := make(chan error, 1)
+	go func() {
+		err := sendRequests(stream, methodDesc, fullMethod, next)
+		sendDone <- err
+		if err != nil {
+			cancel()
+		}
+	}()
+
+	recvErr := func() error {
+		for {
+			respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
+			err := stream.RecvMsg(respMsg)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return newRPCError(fullMethod, err)
+			}
+
+			jsonBytes, err := respMsg.MarshalJSON()
+			if err != nil {
+				return &Error{Kind: KindUnknown, Op: "failed to marshal response", Err: err}
+			}
+
+			if err := onMessage(jsonBytes); err != nil {
+				return err
+			}
+
+			// A client stream has a single response
+			if !methodDesc.IsServerStreaming() {
+				return nil
+			}
+		}
+	}()
+
+	// The sender may still be waiting for input once the server has finished
+	select {
+	case err := <-sendDone:
+		if err != nil {
+			return err
+		}
+	default:
+	}
+
+	return recvErr
+}
+
+// sendRequests sends every request from next and half-closes the stream
+func sendRequests(stream grpc.ClientStream, methodDesc *desc.MethodDescriptor, fullMethod string, next RequestSource) error {
+	for {
+		params, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &Error{Kind: KindInvalidArgument, Op: "read request", Err: err}
+		}
+
+		reqMsg, err := newRequestMessage(methodDesc, params)
+		if err != nil {
+			return err
+		}
+
+		if err := stream.SendMsg(reqMsg); err != nil {
+			// io.EOF means the server ended the call; its status is reported by RecvMsg
+			if err == io.EOF {
+				return nil
+			}
+			return newRPCError(fullMethod, err)
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return newRPCError(fullMethod, err)
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// fakeHandler answers a call of the fake server, with messages as JSON objects using the
+// field names of the proto files. For server-streaming methods every item of the
+// response's "messages" is sent on its own, followed by the error if there is one.
+type fakeHandler func(method string, req map[string]interface{}) (map[string]interface{}, error)
+
+// serverService describes spaceone.api.inventory.v1.Server with a list verb taking the
+// standard query and a watch verb streaming servers back
+func serverService(t *testing.T) *desc.ServiceDescriptor {
+	t.Helper()
+
+	server := builder.NewMessage("ServerInfo").
+		AddField(builder.NewField("server_id", builder.FieldTypeString())).
+		AddField(builder.NewField("name", builder.FieldTypeString()))
+	request := builder.NewMessage("ServerSearchQuery").
+		AddField(builder.NewField("query", builder.FieldTypeImportedMessage(StandardQueryType())))
+	response := builder.NewMessage("ServersInfo").
+		AddField(builder.NewField("results", builder.FieldTypeMessage(server)).SetRepeated()).
+		AddField(builder.NewField("total_count", builder.FieldTypeInt32()))
+	service := builder.NewService("Server").
+		AddMethod(builder.NewMethod("list", builder.RpcTypeMessage(request, false), builder.RpcTypeMessage(response, false))).
+		AddMethod(builder.NewMethod("watch", builder.RpcTypeMessage(request, false), builder.RpcTypeMessage(server, true)))
+
+	file, err := builder.NewFile("spaceone/api/inventory/v1/server.proto").SetPackageName("spaceone.api.inventory.v1").
+		AddMessage(server).AddMessage(request).AddMessage(response).AddService(service).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.FindService("spaceone.api.inventory.v1.Server")
+}
+
+// serviceList lists the services the fake reflection server advertises
+type serviceList map[string]grpc.ServiceInfo
+
+func (l serviceList) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return l
+}
+
+// startFakeServer serves the methods of service through handle, along with reflection, and
+// returns a client for it. HOME is moved to a temporary directory for the caches.
+func startFakeServer(t *testing.T, service *desc.ServiceDescriptor, handle fakeHandler, opts ...grpc.ServerOption) *Client {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	files := &protoregistry.Files{}
+	for _, fd := range append(service.GetFile().GetDependencies(), service.GetFile()) {
+		if err := files.RegisterFile(fd.UnwrapFile()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts = append(opts, grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		fullMethod, _ := grpc.MethodFromServerStream(stream)
+		methodDesc := service.FindMethodByName(verbOf(fullMethod))
+		if methodDesc == nil {
+			return status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+		}
+
+		reqMsg := dynamicpb.NewMessage(methodDesc.GetInputType().UnwrapMessage())
+		if err := stream.RecvMsg(reqMsg); err != nil {
+			return err
+		}
+		resp, err := handle(fullMethod, fakeToMap(t, reqMsg))
+		if !methodDesc.IsServerStreaming() {
+			if err != nil {
+				return err
+			}
+			return stream.SendMsg(fakeFromMap(t, methodDesc.GetOutputType().UnwrapMessage(), resp))
+		}
+
+		messages, _ := resp["messages"].([]interface{})
+		for _, m := range messages {
+			msg, _ := m.(map[string]interface{})
+			if sendErr := stream.SendMsg(fakeFromMap(t, methodDesc.GetOutputType().UnwrapMessage(), msg)); sendErr != nil {
+				return sendErr
+			}
+		}
+		return err
+	}))
+
+	srv := grpc.NewServer(opts...)
+	reflectionOpts := reflection.ServerOptions{
+		Services:           serviceList{service.GetFullyQualifiedName(): {}},
+		DescriptorResolver: files,
+	}
+	reflectionv1.RegisterServerReflectionServer(srv, reflection.NewServerV1(reflectionOpts))
+	reflectionv1alpha.RegisterServerReflectionServer(srv, reflection.NewServer(reflectionOpts))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := New("test", configs.Environment{Endpoint: "grpc://" + lis.Addr().String(), Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := c.RetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+	c.SetRetryPolicy(policy)
+	return c
+}
+
+func fakeToMap(t *testing.T, msg *dynamicpb.Message) map[string]interface{} {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		t.Error(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Error(err)
+	}
+	return m
+}
+
+func fakeFromMap(t *testing.T, md protoreflect.MessageDescriptor, m map[string]interface{}) *dynamicpb.Message {
+	msg := dynamicpb.NewMessage(md)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		t.Error(err)
+	}
+	return msg
+}
+
+// grpcreflect sends a failed request three times itself, over v1 and then v1alpha, before
+// the reflector gives up
+const reflectionSends = 3
+
+// failListServices fails the first n attempts of the reflector to list the services with
+// UNAVAILABLE. The probe of the reflection version lists no services and is let through.
+func failListServices(n int32) grpc.ServerOption {
+	var failed atomic.Int32
+	return grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !strings.HasSuffix(info.FullMethod, "/ServerReflectionInfo") {
+			return handler(srv, ss)
+		}
+		return handler(srv, &failingStream{ServerStream: ss, fail: func() bool {
+			return failed.Add(1) <= n*reflectionSends
+		}})
+	})
+}
+
+type failingStream struct {
+	grpc.ServerStream
+	fail func() bool
+}
+
+func (s *failingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	req, ok := m.(interface{ GetListServices() string })
+	if ok && req.GetListServices() == "*" && s.fail() {
+		return status.Error(codes.Unavailable, "reflection is restarting")
+	}
+	return nil
+}
+
+func TestInvokeRetriesReflection(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		wantErr  bool
+		retries  int
+	}{
+		{name: "succeeds first", failures: 0, retries: 0},
+		{name: "fails once", failures: 1, retries: 1},
+		{name: "fails every attempt", failures: 3, retries: 2, wantErr: true},
+	}
+
+	service := serverService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startFakeServer(t, service, func(method string, req map[string]interface{}) (map[string]interface{}, error) {
+				return map[string]interface{}{"results": []interface{}{map[string]interface{}{"server_id": "server-1"}}, "total_count": 1}, nil
+			}, failListServices(tt.failures))
+
+			var retries int
+			policy := c.RetryPolicy()
+			policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+				retries++
+			}
+			c.SetRetryPolicy(policy)
+
+			result, err := c.Invoke(context.Background(), "inventory", "Server", "list", nil)
+			if tt.wantErr {
+				if status.Code(err) != codes.Unavailable {
+					t.Errorf("Invoke() error = %v, want UNAVAILABLE", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Invoke() error = %v", err)
+			} else if len(result.Results()) != 1 {
+				t.Errorf("Invoke() = %v, want one result", result)
+			}
+			if retries != tt.retries {
+				t.Errorf("reflection was retried %d times, want %d", retries, tt.retries)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	errStop := errors.New("stop")
+	servers := func(ids ...string) []interface{} {
+		messages := make([]interface{}, len(ids))
+		for i, id := range ids {
+			messages[i] = map[string]interface{}{"server_id": id}
+		}
+		return messages
+	}
+
+	tests := []struct {
+		name      string
+		verb      string
+		responses []fakeResponse // One per call of the server
+		stopAfter int            // handle fails with errStop on this message when set
+		want      []string
+		wantErr   error
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		{
+			name:      "unary",
+			verb:      "list",
+			responses: []fakeResponse{{resp: map[string]interface{}{"results": servers("server-1", "server-2")}}},
+			want:      []string{"server-1,server-2"},
+			wantCalls: 1,
+		},
+		{
+			name:      "server stream",
+			verb:      "watch",
+			responses: []fakeResponse{{resp: map[string]interface{}{"messages": servers("server-1", "server-2", "server-3")}}},
+			want:      []string{"server-1", "server-2", "server-3"},
+			wantCalls: 1,
+		},
+		{
+			name:      "handle stops the stream",
+			verb:      "watch",
+			responses: []fakeResponse{{resp: map[string]interface{}{"messages": servers("server-1", "server-2", "server-3")}}},
+			stopAfter: 2,
+			want:      []string{"server-1", "server-2"},
+			wantErr:   errStop,
+			wantCalls: 1,
+		},
+		{
+			name: "retried before the first message",
+			verb: "watch",
+			responses: []fakeResponse{
+				{err: status.Error(codes.Unavailable, "restarting")},
+				{resp: map[string]interface{}{"messages": servers("server-1", "server-2")}},
+			},
+			want:      []string{"server-1", "server-2"},
+			wantCalls: 2,
+		},
+		{
+			name: "not retried once a message arrived",
+			verb: "watch",
+			responses: []fakeResponse{
+				{resp: map[string]interface{}{"messages": servers("server-1")}, err: status.Error(codes.Unavailable, "restarting")},
+				{resp: map[string]interface{}{"messages": servers("server-1", "server-2")}},
+			},
+			want:      []string{"server-1"},
+			wantCode:  codes.Unavailable,
+			wantCalls: 1,
+		},
+	}
+
+	service := serverService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			c := startFakeServer(t, service, func(method string, req map[string]interface{}) (map[string]interface{}, error) {
+				r := tt.responses[int(calls.Add(1))-1]
+				return r.resp, r.err
+			})
+			policy := c.RetryPolicy()
+			policy.Force = true
+			c.SetRetryPolicy(policy)
+
+			var got []string
+			err := c.Stream(context.Background(), "inventory", "Server", tt.verb, nil, func(msg Result) error {
+				if results := msg.Results(); results != nil {
+					var ids []string
+					for _, item := range results {
+						m, _ := item.(map[string]interface{})
+						id, _ := m["serverId"].(string)
+						ids = append(ids, id)
+					}
+					got = append(got, strings.Join(ids, ","))
+				} else {
+					id, _ := msg["serverId"].(string)
+					got = append(got, id)
+				}
+				if len(got) == tt.stopAfter {
+					return errStop
+				}
+				return nil
+			})
+
+			switch {
+			case tt.wantErr != nil:
+				if err != tt.wantErr {
+					t.Errorf("Stream() error = %v, want %v as-is", err, tt.wantErr)
+				}
+			case tt.wantCode != codes.OK:
+				if status.Code(err) != tt.wantCode {
+					t.Errorf("Stream() error = %v, want %v", err, tt.wantCode)
+				}
+			case err != nil:
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stream() handed %v, want %v", got, tt.want)
+			}
+			if n := int(calls.Load()); n != tt.wantCalls {
+				t.Errorf("the server was called %d times, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// fakeResponse is what a fakeHandler returns for one call
+type fakeResponse struct {
+	resp map[string]interface{}
+	err  error
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNoToken is returned when the environment has no token to authenticate with.
+var ErrNoToken = errors.New("no token found for authentication")
+
+// ErrNoDescriptor is returned by ResolveMethod for a method called through the console API
+// whose descriptor was never cached by a gRPC call.
+var ErrNoDescriptor = errors.New("no cached descriptor")
+
+// Kind classifies the errors returned by a Client.
+type Kind int
+
+const (
+	// KindUnknown is used for errors that do not fit any other kind.
+	KindUnknown Kind = iota
+	// KindConfig means the environment configuration is incomplete or invalid.
+	KindConfig
+	// KindAuth means the token is missing, invalid or expired.
+	KindAuth
+	// KindNotFound means the service, resource or verb does not exist.
+	KindNotFound
+	// KindInvalidArgument means the request could not be built or was rejected by the server.
+	KindInvalidArgument
+	// KindUnavailable means the endpoint could not be reached.
+	KindUnavailable
+)
+
+// Exit codes of the cfctl process for each kind of failure. Anything that is not a client
+// Error, such as a bad flag, exits with ExitUnknown; an interrupted command exits with 130.
+const (
+	ExitOK              = 0
+	ExitUnknown         = 1
+	ExitConfig          = 2
+	ExitAuth            = 3
+	ExitNotFound        = 4
+	ExitInvalidArgument = 5
+	ExitUnavailable     = 6
+)
+
+// ExitCode returns the process exit code for errors of the kind
+func (k Kind) ExitCode() int {
+	switch k {
+	case KindConfig:
+		return ExitConfig
+	case KindAuth:
+		return ExitAuth
+	case KindNotFound:
+		return ExitNotFound
+	case KindInvalidArgument:
+		return ExitInvalidArgument
+	case KindUnavailable:
+		return ExitUnavailable
+	default:
+		return ExitUnknown
+	}
+}
+
+// String returns a short, human readable name for the kind
+func (k Kind) String() string {
+	switch k {
+	case KindConfig:
+		return "config"
+	case KindAuth:
+		return "auth"
+	case KindNotFound:
+		return "not found"
+	case KindInvalidArgument:
+		return "invalid argument"
+	case KindUnavailable:
+		return "unavailable"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is the error type returned by every Client method.
+type Error struct {
+	Kind Kind
+	// Op describes what the client was doing, e.g. "resolve endpoint" or a full gRPC method name.
+	Op string
+	// Code is the gRPC status code of a failed call, or OK if no call was made.
+	Code codes.Code
+	// ErrorCode is the SpaceONE error code sent by the server, e.g. ERROR_NOT_FOUND.
+	ErrorCode string
+	// Message is the server's description of the error, without the error code.
+	Message string
+	// Params holds the key parameters named by the message, e.g. {"key": "domain_id"}.
+	Params map[string]string
+	// Param holds the parameter name for ERROR_REQUIRED_PARAMETER responses.
+	Param string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Param != "" {
+		return fmt.Sprintf("missing required parameter: %s", e.Param)
+	}
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the process exit code for err: ExitOK for nil, the code of the kind for
+// a client Error and ExitUnknown for anything else
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var clientErr *Error
+	if errors.As(err, &clientErr) {
+		return clientErr.Kind.ExitCode()
+	}
+	return ExitUnknown
+}
+
+// IsKind reports whether err is a client Error of the given kind
+func IsKind(err error, kind Kind) bool {
+	var clientErr *Error
+	if errors.As(err, &clientErr) {
+		return clientErr.Kind == kind
+	}
+	return false
+}
+
+// spaceoneError matches the error code and message that SpaceONE services put in the
+// status message, e.g. "ERROR_REQUIRED_PARAMETER: Required parameter. (key = domain_id)"
+var spaceoneError = regexp.MustCompile(`(?s)\b(ERROR_[A-Z0-9_]+)\b:?\s*(.*)`)
+
+// errorParams matches the trailing "(key = value, ...)" of a SpaceONE error message
+var errorParams = regexp.MustCompile(`\(([^()]*=[^()]*)\)\s*$`)
+
+// newRPCError converts an error returned by a gRPC call into a client Error
+func newRPCError(fullMethod string, err error) *Error {
+	clientErr := &Error{Kind: KindUnknown, Op: fmt.Sprintf("failed to invoke method %s", fullMethod), Err: err}
+
+	st := status.Convert(err)
+	clientErr.Code = st.Code()
+	clientErr.describe(st.Message())
+
+	// Messages over the size limit fail before reaching the server or cfctl
+	if clientErr.Code == codes.ResourceExhausted && strings.Contains(st.Message(), "larger than max") {
+		switch {
+		case strings.Contains(st.Message(), "trying to send message"):
+			clientErr.Err = fmt.Errorf("%v; raise max_send_size of the environment or use --max-send-size", err)
+		case strings.Contains(st.Message(), "received message"):
+			clientErr.Err = fmt.Errorf("%v; raise max_recv_size of the environment or use --max-recv-size", err)
+		}
+	}
+
+	return clientErr
+}
+
+// describe fills in what the server said about a failed call from its message, such as
+// "ERROR_NOT_FOUND: Resource not found. (key = user_id)", and classifies the error
+func (e *Error) describe(message string) {
+	e.Message = message
+	if m := spaceoneError.FindStringSubmatch(message); m != nil {
+		e.ErrorCode = m[1]
+		e.Message = strings.TrimSpace(m[2])
+	}
+	e.Params = parseErrorParams(e.Message)
+
+	e.Kind = kindOf(e.Code, e.ErrorCode, e.Message)
+	if e.ErrorCode == "ERROR_REQUIRED_PARAMETER" {
+		e.Param = e.Params["key"]
+	}
+}
+
+// kindOf classifies a failed call, preferring the SpaceONE error code over the status code
+func kindOf(code codes.Code, errorCode, message string) Kind {
+	switch {
+	case errorCode == "ERROR_AUTHENTICATE_FAILURE", errorCode == "ERROR_PERMISSION_DENIED",
+		strings.Contains(message, "Token is invalid or expired"):
+		return KindAuth
+	case strings.HasSuffix(errorCode, "_NOT_FOUND"):
+		return KindNotFound
+	case strings.HasPrefix(errorCode, "ERROR_REQUIRED_"), strings.HasPrefix(errorCode, "ERROR_INVALID_"),
+		strings.Contains(errorCode, "PARAMETER"):
+		return KindInvalidArgument
+	}
+
+	switch code {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return KindAuth
+	case codes.NotFound, codes.Unimplemented:
+		return KindNotFound
+	case codes.InvalidArgument:
+		return KindInvalidArgument
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return KindUnavailable
+	}
+	return KindUnknown
+}
+
+// parseErrorParams reads the key parameters at the end of a SpaceONE error message,
+// such as "(key = domain_id)" or "(resource_type = User, resource_id = u-123)"
+func parseErrorParams(message string) map[string]string {
+	m := errorParams.FindStringSubmatch(message)
+	if m == nil {
+		return nil
+	}
+
+	params := make(map[string]string)
+	for _, pair := range strings.Split(m[1], ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		params[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return params
+}
+
+// CodeName returns the canonical name of a status code, e.g. NOT_FOUND
+func CodeName(code codes.Code) string {
+	var sb strings.Builder
+	name := code.String()
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(rune(name[i-1])) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewRPCError(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          codes.Code
+		message       string
+		wantKind      Kind
+		wantExit      int
+		wantErrorCode string
+		wantParams    map[string]string
+		wantParam     string
+	}{
+		{name: "unauthenticated", code: codes.Unauthenticated, message: "no token", wantKind: KindAuth, wantExit: ExitAuth},
+		{name: "permission denied", code: codes.PermissionDenied, message: "denied", wantKind: KindAuth, wantExit: ExitAuth},
+		{name: "not found", code: codes.NotFound, message: "no such thing", wantKind: KindNotFound, wantExit: ExitNotFound},
+		{name: "unimplemented", code: codes.Unimplemented, message: "unknown method", wantKind: KindNotFound, wantExit: ExitNotFound},
+		{name: "invalid argument", code: codes.InvalidArgument, message: "bad", wantKind: KindInvalidArgument, wantExit: ExitInvalidArgument},
+		{name: "unavailable", code: codes.Unavailable, message: "connection refused", wantKind: KindUnavailable, wantExit: ExitUnavailable},
+		{name: "deadline exceeded", code: codes.DeadlineExceeded, message: "too slow", wantKind: KindUnavailable, wantExit: ExitUnavailable},
+		{name: "internal", code: codes.Internal, message: "boom", wantKind: KindUnknown, wantExit: ExitUnknown},
+		{
+			name: "authenticate failure", code: codes.Unknown, message: "ERROR_AUTHENTICATE_FAILURE: Authenticate failure. (message = expired)",
+			wantKind: KindAuth, wantExit: ExitAuth, wantErrorCode: "ERROR_AUTHENTICATE_FAILURE", wantParams: map[string]string{"message": "expired"},
+		},
+		{
+			name: "spaceone permission denied", code: codes.Internal, message: "ERROR_PERMISSION_DENIED: Permission denied.",
+			wantKind: KindAuth, wantExit: ExitAuth, wantErrorCode: "ERROR_PERMISSION_DENIED",
+		},
+		{
+			name: "expired token", code: codes.Internal, message: "Token is invalid or expired.",
+			wantKind: KindAuth, wantExit: ExitAuth,
+		},
+		{
+			name: "spaceone not found", code: codes.Internal, message: "ERROR_NOT_FOUND: Resource not found. (key = user_id, value = u-123)",
+			wantKind: KindNotFound, wantExit: ExitNotFound, wantErrorCode: "ERROR_NOT_FOUND", wantParams: map[string]string{"key": "user_id", "value": "u-123"},
+		},
+		{
+			name: "spaceone service not found", code: codes.Unknown, message: "ERROR_SERVICE_NOT_FOUND: Service not found.",
+			wantKind: KindNotFound, wantExit: ExitNotFound, wantErrorCode: "ERROR_SERVICE_NOT_FOUND",
+		},
+		{
+			name: "required parameter", code: codes.InvalidArgument, message: "ERROR_REQUIRED_PARAMETER: Required parameter. (key = domain_id)",
+			wantKind: KindInvalidArgument, wantExit: ExitInvalidArgument, wantErrorCode: "ERROR_REQUIRED_PARAMETER", wantParams: map[string]string{"key": "domain_id"}, wantParam: "domain_id",
+		},
+		{
+			name: "invalid parameter", code: codes.Internal, message: "ERROR_INVALID_PARAMETER_TYPE: Parameter type is invalid. (key = limit, type = int)",
+			wantKind: KindInvalidArgument, wantExit: ExitInvalidArgument, wantErrorCode: "ERROR_INVALID_PARAMETER_TYPE", wantParams: map[string]string{"key": "limit", "type": "int"},
+		},
+		{
+			name: "error code beats the status", code: codes.Unavailable, message: "ERROR_NOT_FOUND: Resource not found.",
+			wantKind: KindNotFound, wantExit: ExitNotFound, wantErrorCode: "ERROR_NOT_FOUND",
+		},
+		{
+			name: "unclassified error code falls back to the status", code: codes.Unavailable, message: "ERROR_DB_QUERY: Database error.",
+			wantKind: KindUnavailable, wantExit: ExitUnavailable, wantErrorCode: "ERROR_DB_QUERY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newRPCError("/spaceone.api.identity.v2.User/get", status.Error(tt.code, tt.message))
+
+			if err.Kind != tt.wantKind {
+				t.Errorf("Kind = %v, want %v", err.Kind, tt.wantKind)
+			}
+			if err.Code != tt.code {
+				t.Errorf("Code = %v, want %v", err.Code, tt.code)
+			}
+			if err.ErrorCode != tt.wantErrorCode {
+				t.Errorf("ErrorCode = %q, want %q", err.ErrorCode, tt.wantErrorCode)
+			}
+			if !reflect.DeepEqual(err.Params, tt.wantParams) {
+				t.Errorf("Params = %v, want %v", err.Params, tt.wantParams)
+			}
+			if err.Param != tt.wantParam {
+				t.Errorf("Param = %q, want %q", err.Param, tt.wantParam)
+			}
+			if got := ExitCode(fmt.Errorf("list users: %w", err)); got != tt.wantExit {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: ExitOK},
+		{name: "plain error", err: errors.New("unknown flag"), want: ExitUnknown},
+		{name: "config", err: &Error{Kind: KindConfig, Err: errors.New("no endpoint")}, want: ExitConfig},
+		{name: "no token", err: &Error{Kind: KindAuth, Err: ErrNoToken}, want: ExitAuth},
+		{name: "wrapped", err: fmt.Errorf("call: %w", &Error{Kind: KindNotFound, Err: errors.New("x")}), want: ExitNotFound},
+		{name: "unknown kind", err: &Error{Kind: KindUnknown, Err: errors.New("x")}, want: ExitUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // Registers the gzip compressor
+)
+
+// DefaultMaxMessageSize is the largest message sent or received unless the environment or
+// the caller sets another limit
+const DefaultMaxMessageSize = 10 * 1024 * 1024
+
+// MessageOptions are the message size limits and compression of the calls of a Client
+type MessageOptions struct {
+	MaxRecvSize int    // Largest response message accepted, in bytes
+	MaxSendSize int    // Largest request message sent, in bytes
+	Compression string // Name of a registered compressor such as gzip, or "" for none
+}
+
+// messageOptionsFromConfig applies the message setting of an environment to the defaults
+func messageOptionsFromConfig(env configs.Environment) (MessageOptions, error) {
+	options := MessageOptions{MaxRecvSize: DefaultMaxMessageSize, MaxSendSize: DefaultMaxMessageSize}
+
+	if env.MaxRecvSize != "" {
+		size, err := configs.ParseByteSize(env.MaxRecvSize)
+		if err != nil {
+			return options, fmt.Errorf("invalid max_recv_size: %v", err)
+		}
+		options.MaxRecvSize = size
+	}
+
+	if env.MaxSendSize != "" {
+		size, err := configs.ParseByteSize(env.MaxSendSize)
+		if err != nil {
+			return options, fmt.Errorf("invalid max_send_size: %v", err)
+		}
+		options.MaxSendSize = size
+	}
+
+	if env.Compression != "none" {
+		if err := checkCompression(env.Compression); err != nil {
+			return options, fmt.Errorf("invalid compression: %v", err)
+		}
+		options.Compression = env.Compression
+	}
+
+	return options, nil
+}
+
+// checkCompression makes sure name is a compressor registered with gRPC, or empty for none
+func checkCompression(name string) error {
+	if name != "" && encoding.GetCompressor(name) == nil {
+		return fmt.Errorf("unknown compressor '%s'; gzip is supported", name)
+	}
+	return nil
+}
+
+// callOptions turns the options into the options of each call
+func (o MessageOptions) callOptions() []grpc.CallOption {
+	opts := []grpc.CallOption{
+		grpc.MaxCallRecvMsgSize(o.MaxRecvSize),
+		grpc.MaxCallSendMsgSize(o.MaxSendSize),
+	}
+	if o.Compression != "" {
+		opts = append(opts, grpc.UseCompressor(o.Compression))
+	}
+	return opts
+}
+
+// MessageOptions returns the message size limits and compression, taken from the environment
+func (c *Client) MessageOptions() MessageOptions {
+	return c.messages
+}
+
+// SetMessageOptions replaces the message size limits and compression of later calls
+func (c *Client) SetMessageOptions(options MessageOptions) error {
+	if options.MaxRecvSize <= 0 || options.MaxSendSize <= 0 {
+		return &Error{Kind: KindInvalidArgument, Err: fmt.Errorf("message size limits must be positive")}
+	}
+	if err := checkCompression(options.Compression); err != nil {
+		return &Error{Kind: KindInvalidArgument, Err: err}
+	}
+
+	c.messages = options
+	return nil
+}
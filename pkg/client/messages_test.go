@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+)
+
+func TestMessageOptionsFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     configs.Environment
+		want    MessageOptions
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: MessageOptions{MaxRecvSize: DefaultMaxMessageSize, MaxSendSize: DefaultMaxMessageSize},
+		},
+		{
+			name: "sizes",
+			env:  configs.Environment{MaxRecvSize: "64MB", MaxSendSize: "512KiB"},
+			want: MessageOptions{MaxRecvSize: 64 << 20, MaxSendSize: 512 << 10},
+		},
+		{
+			name: "gzip",
+			env:  configs.Environment{Compression: "gzip"},
+			want: MessageOptions{MaxRecvSize: DefaultMaxMessageSize, MaxSendSize: DefaultMaxMessageSize, Compression: "gzip"},
+		},
+		{
+			name: "no compression",
+			env:  configs.Environment{Compression: "none"},
+			want: MessageOptions{MaxRecvSize: DefaultMaxMessageSize, MaxSendSize: DefaultMaxMessageSize},
+		},
+		{name: "bad recv size", env: configs.Environment{MaxRecvSize: "lots"}, wantErr: "invalid max_recv_size"},
+		{name: "bad send size", env: configs.Environment{MaxSendSize: "0"}, wantErr: "invalid max_send_size"},
+		{name: "unknown compressor", env: configs.Environment{Compression: "zstd"}, wantErr: "unknown compressor 'zstd'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := messageOptionsFromConfig(tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("messageOptionsFromConfig() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("messageOptionsFromConfig() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("messageOptionsFromConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMessageOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options MessageOptions
+		wantErr bool
+	}{
+		{name: "valid", options: MessageOptions{MaxRecvSize: 1, MaxSendSize: 1, Compression: "gzip"}},
+		{name: "zero size", options: MessageOptions{MaxRecvSize: 0, MaxSendSize: 1}, wantErr: true},
+		{name: "unknown compressor", options: MessageOptions{MaxRecvSize: 1, MaxSendSize: 1, Compression: "zstd"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{}
+			err := c.SetMessageOptions(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetMessageOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !IsKind(err, KindInvalidArgument) {
+				t.Errorf("SetMessageOptions() error = %v, want an invalid argument", err)
+			}
+			if !tt.wantErr && c.MessageOptions() != tt.options {
+				t.Errorf("MessageOptions() = %+v, want %+v", c.MessageOptions(), tt.options)
+			}
+		})
+	}
+}
+
+// recordEncoding keeps the compression of the last request to the Server service
+func recordEncoding(encoding *atomic.Value) grpc.ServerOption {
+	return grpc.StatsHandler(encodingStats{encoding: encoding})
+}
+
+type encodingStats struct {
+	encoding *atomic.Value
+}
+
+func (s encodingStats) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	if h, ok := rs.(*stats.InHeader); ok && strings.HasPrefix(h.FullMethod, "/spaceone.") {
+		s.encoding.Store(h.Compression)
+	}
+}
+
+func (encodingStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (encodingStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (encodingStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestInvokeMessageOptions(t *testing.T) {
+	servers := make([]interface{}, 100)
+	for i := range servers {
+		servers[i] = map[string]interface{}{"server_id": "server-0000000000", "name": strings.Repeat("n", 10)}
+	}
+	largeRequest := map[string]interface{}{"query": map[string]interface{}{"only": []interface{}{strings.Repeat("n", 4096)}}}
+
+	tests := []struct {
+		name         string
+		options      MessageOptions
+		params       map[string]interface{}
+		wantErr      string
+		wantEncoding string
+	}{
+		{
+			name:    "within the limits",
+			options: MessageOptions{MaxRecvSize: DefaultMaxMessageSize, MaxSendSize: DefaultMaxMessageSize},
+			params:  largeRequest,
+		},
+		{
+			name:    "response over max recv size",
+			options: MessageOptions{MaxRecvSize: 1024, MaxSendSize: DefaultMaxMessageSize},
+			wantErr: "raise max_recv_size of the environment or use --max-recv-size",
+		},
+		{
+			name:    "request over max send size",
+			options: MessageOptions{MaxRecvSize: DefaultMaxMessageSize, MaxSendSize: 1024},
+			params:  largeRequest,
+			wantErr: "raise max_send_size of the environment or use --max-send-size",
+		},
+		{
+			name:         "gzip",
+			options:      MessageOptions{MaxRecvSize: DefaultMaxMessageSize, MaxSendSize: DefaultMaxMessageSize, Compression: "gzip"},
+			wantEncoding: "gzip",
+		},
+	}
+
+	service := serverService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var encoding atomic.Value
+			encoding.Store("")
+			c := startFakeServer(t, service, func(method string, req map[string]interface{}) (map[string]interface{}, error) {
+				return map[string]interface{}{"results": servers, "total_count": len(servers)}, nil
+			}, recordEncoding(&encoding))
+			if err := c.SetMessageOptions(tt.options); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := c.Invoke(context.Background(), "inventory", "Server", "list", tt.params)
+			if tt.wantErr != "" {
+				var clientErr *Error
+				if !errors.As(err, &clientErr) || clientErr.Code != codes.ResourceExhausted || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Invoke() error = %v, want RESOURCE_EXHAUSTED with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Invoke() error = %v", err)
+			}
+			if len(result.Results()) != len(servers) {
+				t.Errorf("Invoke() returned %d results, want %d", len(result.Results()), len(servers))
+			}
+			if got := encoding.Load().(string); got != tt.wantEncoding {
+				t.Errorf("the server saw grpc-encoding %q, want %q", got, tt.wantEncoding)
+			}
+		})
+	}
+}
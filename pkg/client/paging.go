@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// DefaultPageSize is the number of items requested per page by InvokeAll
+const DefaultPageSize = 100
+
+// PageProgress is called after every page with the number of items fetched so far
+// and the total_count reported by the server, or -1 if the server reports none
+type PageProgress func(fetched, total int)
+
+// InvokeAll calls a list-style verb page by page through query.page until total_count
+// items have been fetched, and returns them merged into a single Result.
+// A query.page in params sets the first item to fetch and the page size.
+// Methods whose request has no query.page field are invoked once, like Invoke.
+func (c *Client) InvokeAll(ctx context.Context, service, resource, verb string, params map[string]interface{}, pageSize int, progress PageProgress) (Result, error) {
+	sess, err := c.connect(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.close()
+
+	methodDesc, fullMethod, err := sess.resolveMethod(service, resource, verb)
+	if err != nil {
+		return nil, err
+	}
+
+	// Calls through the console API may lack a descriptor; list is then assumed to page
+	paged := hasPagedQuery(methodDesc)
+	if methodDesc == nil {
+		paged = verb == "list"
+	}
+	if !paged {
+		return sess.call(methodDesc, fullMethod, params)
+	}
+
+	// Copy the request and its query so the caller's params are left untouched
+	pageParams := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		pageParams[k] = v
+	}
+	query := make(map[string]interface{})
+	if existing, ok := params["query"].(map[string]interface{}); ok {
+		for k, v := range existing {
+			query[k] = v
+		}
+	}
+	pageParams["query"] = query
+
+	start := 1
+	if page, ok := query["page"].(map[string]interface{}); ok {
+		if n, ok := pageNumber(page["start"]); ok && n > 0 {
+			start = n
+		}
+		if n, ok := pageNumber(page["limit"]); ok && n > 0 {
+			pageSize = n
+		}
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	// Items before the first one fetched count towards total_count
+	skipped := start - 1
+
+	var all []interface{}
+	total := -1
+	totalKey := "totalCount" // As both transports name it, should the server not say
+
+	for {
+		query["page"] = map[string]interface{}{"start": start, "limit": pageSize}
+
+		result, err := sess.call(methodDesc, fullMethod, pageParams)
+		if err != nil {
+			return nil, err
+		}
+
+		items := result.Results()
+		all = append(all, items...)
+
+		if key, count, ok := totalCount(result); ok {
+			totalKey, total = key, count
+		}
+
+		if progress != nil {
+			if total >= 0 {
+				progress(len(all), max(total-skipped, 0))
+			} else {
+				progress(len(all), -1)
+			}
+		}
+
+		if len(items) == 0 {
+			break
+		}
+		if total >= 0 && skipped+len(all) >= total {
+			break
+		}
+		if total < 0 && len(items) < pageSize {
+			break
+		}
+
+		// Advance by what was actually returned, in case the server caps the limit
+		start += len(items)
+	}
+
+	if total < 0 {
+		total = len(all)
+	}
+	if all == nil {
+		all = []interface{}{}
+	}
+
+	return Result{"results": all, totalKey: total}, nil
+}
+
+// hasPagedQuery reports whether the request of methodDesc takes a query with a page field
+func hasPagedQuery(methodDesc *desc.MethodDescriptor) bool {
+	if methodDesc == nil {
+		return false
+	}
+	queryType := QueryType(methodDesc)
+	return queryType != nil && queryType.FindFieldByName("page") != nil
+}
+
+// pageNumber reads query.page.start or limit, a number from JSON or an int from Go callers
+func pageNumber(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// totalCount reads total_count under whichever key the response used. The value is
+// a number for int32 fields and a string for int64 ones.
+func totalCount(result Result) (string, int, bool) {
+	for _, key := range []string{"total_count", "totalCount"} {
+		switch v := result[key].(type) {
+		case float64:
+			return key, int(v), true
+		case string:
+			if n, err := strconv.Atoi(v); err == nil {
+				return key, n, true
+			}
+		}
+	}
+
+	return "", 0, false
+}
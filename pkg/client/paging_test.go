@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// pagedServers answers list with servers server-1 to server-<count> a page at a time,
+// never more than maxLimit of them when it is set
+type pagedServers struct {
+	count     int
+	maxLimit  int
+	noTotal   bool
+	mu        sync.Mutex
+	requested [][2]int // start and limit of every call
+}
+
+func (p *pagedServers) handle(method string, req map[string]interface{}) (map[string]interface{}, error) {
+	query, _ := req["query"].(map[string]interface{})
+	page, _ := query["page"].(map[string]interface{})
+	start, _ := pageNumber(page["start"])
+	limit, _ := pageNumber(page["limit"])
+
+	p.mu.Lock()
+	p.requested = append(p.requested, [2]int{start, limit})
+	p.mu.Unlock()
+
+	if p.maxLimit > 0 && limit > p.maxLimit {
+		limit = p.maxLimit
+	}
+	results := []interface{}{}
+	for i := start; i < start+limit && i <= p.count; i++ {
+		results = append(results, map[string]interface{}{"server_id": fmt.Sprintf("server-%d", i)})
+	}
+
+	resp := map[string]interface{}{"results": results}
+	if !p.noTotal {
+		resp["total_count"] = p.count
+	}
+	return resp, nil
+}
+
+func serverIDs(from, to int) []string {
+	var ids []string
+	for i := from; i <= to; i++ {
+		ids = append(ids, fmt.Sprintf("server-%d", i))
+	}
+	return ids
+}
+
+func TestInvokeAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    *pagedServers
+		params    map[string]interface{}
+		pageSize  int
+		want      []string
+		wantTotal int
+		wantPages [][2]int
+	}{
+		{
+			name:      "stops at total_count",
+			server:    &pagedServers{count: 5},
+			pageSize:  2,
+			want:      serverIDs(1, 5),
+			wantTotal: 5,
+			wantPages: [][2]int{{1, 2}, {3, 2}, {5, 2}},
+		},
+		{
+			name:      "empty last page",
+			server:    &pagedServers{count: 4, noTotal: true},
+			pageSize:  2,
+			want:      serverIDs(1, 4),
+			wantTotal: 4,
+			wantPages: [][2]int{{1, 2}, {3, 2}, {5, 2}},
+		},
+		{
+			name:      "short last page",
+			server:    &pagedServers{count: 3, noTotal: true},
+			pageSize:  2,
+			want:      serverIDs(1, 3),
+			wantTotal: 3,
+			wantPages: [][2]int{{1, 2}, {3, 2}},
+		},
+		{
+			name:      "server caps the limit",
+			server:    &pagedServers{count: 7, maxLimit: 3},
+			pageSize:  5,
+			want:      serverIDs(1, 7),
+			wantTotal: 7,
+			wantPages: [][2]int{{1, 5}, {4, 5}, {7, 5}},
+		},
+		{
+			name:      "no items",
+			server:    &pagedServers{count: 0},
+			pageSize:  2,
+			want:      nil,
+			wantTotal: 0,
+			wantPages: [][2]int{{1, 2}},
+		},
+		{
+			name:   "starts from the query page",
+			server: &pagedServers{count: 6},
+			params: map[string]interface{}{
+				"query": map[string]interface{}{"page": map[string]interface{}{"start": float64(3), "limit": float64(2)}},
+			},
+			pageSize:  100,
+			want:      serverIDs(3, 6),
+			wantTotal: 6,
+			wantPages: [][2]int{{3, 2}, {5, 2}},
+		},
+	}
+
+	service := serverService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startFakeServer(t, service, tt.server.handle)
+
+			var lastFetched, lastTotal int
+			result, err := c.InvokeAll(context.Background(), "inventory", "Server", "list", tt.params, tt.pageSize, func(fetched, total int) {
+				lastFetched, lastTotal = fetched, total
+			})
+			if err != nil {
+				t.Fatalf("InvokeAll() error = %v", err)
+			}
+
+			var got []string
+			for _, item := range result.Results() {
+				m, _ := item.(map[string]interface{})
+				id, _ := m["serverId"].(string)
+				got = append(got, id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InvokeAll() results = %v, want %v", got, tt.want)
+			}
+			if total := result["totalCount"]; total != tt.wantTotal {
+				t.Errorf("InvokeAll() totalCount = %v, want %d", total, tt.wantTotal)
+			}
+			if !reflect.DeepEqual(tt.server.requested, tt.wantPages) {
+				t.Errorf("pages requested = %v, want %v", tt.server.requested, tt.wantPages)
+			}
+			if lastFetched != len(tt.want) {
+				t.Errorf("progress reported %d items fetched, want %d", lastFetched, len(tt.want))
+			}
+			if !tt.server.noTotal && lastTotal != len(tt.want) {
+				t.Errorf("progress reported %d items in total, want %d", lastTotal, len(tt.want))
+			}
+		})
+	}
+
+	t.Run("params untouched", func(t *testing.T) {
+		server := pagedServers{count: 3}
+		c := startFakeServer(t, service, server.handle)
+
+		params := map[string]interface{}{"query": map[string]interface{}{"only": []interface{}{"server_id"}}}
+		if _, err := c.InvokeAll(context.Background(), "inventory", "Server", "list", params, 2, nil); err != nil {
+			t.Fatalf("InvokeAll() error = %v", err)
+		}
+		if _, ok := params["query"].(map[string]interface{})["page"]; ok {
+			t.Errorf("InvokeAll() added query.page to the caller's params: %v", params)
+		}
+	})
+}
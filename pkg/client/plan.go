@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Plan describes the call Invoke would make, worked out without sending the request
+type Plan struct {
+	Environment string                   `json:"environment" yaml:"environment"`
+	Endpoint    string                   `json:"endpoint" yaml:"endpoint"`
+	Target      string                   `json:"target" yaml:"target"`
+	TLS         bool                     `json:"tls" yaml:"tls"`
+	Authority   string                   `json:"authority,omitempty" yaml:"authority,omitempty"`
+	Transport   string                   `json:"transport" yaml:"transport"`
+	Method      string                   `json:"method" yaml:"method"`
+	InputType   string                   `json:"input_type,omitempty" yaml:"input_type,omitempty"`
+	Streaming   string                   `json:"streaming,omitempty" yaml:"streaming,omitempty"`
+	Metadata    map[string]string        `json:"metadata" yaml:"metadata"`
+	Request     map[string]interface{}   `json:"request,omitempty" yaml:"request,omitempty"`
+	Requests    []map[string]interface{} `json:"requests,omitempty" yaml:"requests,omitempty"`
+}
+
+// Plan resolves the endpoint and method of verb and checks params against its input
+// message, returning what would be sent. Only reflection talks to the server.
+func (c *Client) Plan(ctx context.Context, service, resource, verb string, params map[string]interface{}) (*Plan, error) {
+	return c.plan(ctx, service, resource, verb, singleRequest(params))
+}
+
+// PlanRequests is Plan for client-streaming verbs: every request from next is checked
+// and listed in the order it would be sent
+func (c *Client) PlanRequests(ctx context.Context, service, resource, verb string, next RequestSource) (*Plan, error) {
+	return c.plan(ctx, service, resource, verb, next)
+}
+
+func (c *Client) plan(ctx context.Context, service, resource, verb string, next RequestSource) (*Plan, error) {
+	sess, err := c.connect(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.close()
+
+	methodDesc, fullMethod, err := sess.resolveMethod(service, resource, verb)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Environment: c.name,
+		Endpoint:    c.env.Endpoint,
+		Target:      sess.target,
+		TLS:         sess.secure,
+		Authority:   c.env.Authority,
+		Transport:   TransportGRPC,
+		Method:      fullMethod,
+		Metadata:    map[string]string{"token": rpc.Redacted},
+	}
+	if sess.rest != nil {
+		plan.Transport = TransportREST
+	}
+
+	// Calls through the console API may have no cached descriptor to describe them
+	if methodDesc != nil {
+		plan.InputType = methodDesc.GetInputType().GetFullyQualifiedName()
+		plan.Streaming = streamingKind(methodDesc)
+	}
+
+	for key, values := range c.headers {
+		plan.Metadata[key] = strings.Join(values, ",")
+		if rpc.IsSecretKey(key) {
+			plan.Metadata[key] = rpc.Redacted
+		}
+	}
+
+	for {
+		params, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &Error{Kind: KindInvalidArgument, Op: "read request", Err: err}
+		}
+
+		request, err := normalizeRequest(methodDesc, params)
+		if err != nil {
+			return nil, err
+		}
+		plan.Requests = append(plan.Requests, request)
+	}
+
+	// Only streams of requests are shown as a list
+	if (methodDesc == nil || !methodDesc.IsClientStreaming()) && len(plan.Requests) > 0 {
+		plan.Request, plan.Requests = plan.Requests[0], nil
+	}
+
+	return plan, nil
+}
+
+// normalizeRequest builds the request message from params, which fails on unknown fields
+// and mistyped values, and returns it as it would be encoded, with secrets redacted.
+// Without a descriptor params are sent as given, so they are only copied.
+func normalizeRequest(methodDesc *desc.MethodDescriptor, params map[string]interface{}) (map[string]interface{}, error) {
+	var jsonBytes []byte
+	var err error
+	if methodDesc == nil {
+		jsonBytes, err = json.Marshal(params)
+	} else {
+		var reqMsg *dynamic.Message
+		if reqMsg, err = newRequestMessage(methodDesc, params); err != nil {
+			return nil, err
+		}
+		jsonBytes, err = reqMsg.MarshalJSONPB(&jsonpb.Marshaler{OrigName: true})
+	}
+	if err != nil {
+		return nil, &Error{Kind: KindInvalidArgument, Op: "encode request", Err: err}
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal(jsonBytes, &request); err != nil {
+		return nil, &Error{Kind: KindUnknown, Op: "decode request", Err: err}
+	}
+
+	rpc.RedactSecrets(request)
+	return request, nil
+}
+
+func streamingKind(methodDesc *desc.MethodDescriptor) string {
+	switch {
+	case methodDesc.IsClientStreaming() && methodDesc.IsServerStreaming():
+		return "bidirectional"
+	case methodDesc.IsClientStreaming():
+		return "client"
+	case methodDesc.IsServerStreaming():
+		return "server"
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Keepalive pings keep a pooled connection known to be alive while calls are in flight.
+// Servers refuse pings more frequent than every 5 minutes by default.
+const (
+	keepaliveTime    = 5 * time.Minute
+	keepaliveTimeout = 20 * time.Second
+)
+
+// connPool shares connections and descriptors across the calls and Clients of a process, so
+// that the steps of apply or the polls of a watch reuse what the previous call set up
+type connPool struct {
+	mu    sync.Mutex
+	conns map[string]*pooledConn
+}
+
+// pooledConn is a shared connection and the descriptor reflector of each service behind it
+type pooledConn struct {
+	conn       *grpc.ClientConn
+	reflectors map[string]*rpc.Reflector
+}
+
+var pool = &connPool{conns: make(map[string]*pooledConn)}
+
+// poolKey identifies connections that can be shared: the same target reached with the same
+// TLS, proxy and authority setting. Tokens and headers are sent per call, so they don't matter.
+func poolKey(env configs.Environment, target string, secure bool) string {
+	return fmt.Sprintf("%s|%v|%+v|%s|%s", target, secure, env.TLS, env.NetworkProxy, env.Authority)
+}
+
+// get returns the pooled connection to target, dialing it on first use
+func (p *connPool) get(env configs.Environment, target string, secure bool) (*pooledConn, error) {
+	key := poolKey(env, target, secure)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pc, ok := p.conns[key]; ok {
+		rpc.Logf(rpc.LevelInfo, "reusing the connection to %s", target)
+		return pc, nil
+	}
+
+	// Message limits and compression are set per call, so the connection suits any Client
+	conn, err := configs.DialEnvironment(env, target, secure,
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    keepaliveTime,
+			Timeout: keepaliveTimeout,
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &pooledConn{conn: conn, reflectors: make(map[string]*rpc.Reflector)}
+	p.conns[key] = pc
+	return pc, nil
+}
+
+// reflector returns a reflector for service that asks the server within ctx and shares the
+// descriptors learned by earlier calls
+func (p *connPool) reflector(ctx context.Context, pc *pooledConn, cacheDir, service string) *rpc.Reflector {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := cacheDir + "|" + service
+	shared, ok := pc.reflectors[key]
+	if !ok {
+		shared = rpc.NewReflector(context.Background(), pc.conn, cacheDir, service)
+		pc.reflectors[key] = shared
+	}
+	return shared.With(ctx)
+}
+
+// CloseConnections closes the connections shared by the Clients of the process. Later calls
+// dial again. cfctl calls it before exiting; programs embedding Client may do the same.
+func CloseConnections() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for key, pc := range pool.conns {
+		_ = pc.conn.Close()
+		delete(pool.conns, key)
+	}
+}
@@ -0,0 +1,303 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+)
+
+// Operators lists the filter operators understood by SpaceONE query filters
+var Operators = []string{
+	"eq", "not", "lt", "lte", "gt", "gte", "exists",
+	"contain", "not_contain", "in", "not_in", "contain_in", "not_contain_in",
+	"like", "regex", "regex_in",
+	"datetime_lt", "datetime_lte", "datetime_gt", "datetime_gte",
+	"timediff_lt", "timediff_lte", "timediff_gt", "timediff_gte",
+}
+
+// listOperators take a comma separated list of values
+var listOperators = map[string]bool{
+	"in": true, "not_in": true, "contain_in": true, "not_contain_in": true, "regex_in": true,
+}
+
+// symbolOperators maps the shorthand operators to SpaceONE operators, longest first
+var symbolOperators = []struct {
+	symbol   string
+	operator string
+}{
+	{"!=", "not"},
+	{"!~", "not_contain"},
+	{">=", "gte"},
+	{"<=", "lte"},
+	{"=", "eq"},
+	{"~", "contain"},
+	{">", "gt"},
+	{"<", "lt"},
+}
+
+var (
+	filterKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+	datePattern      = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+)
+
+// Condition is a single SpaceONE query filter condition
+type Condition struct {
+	Key      string
+	Value    interface{}
+	Operator string
+}
+
+// ParseFilter compiles a filter expression into a Condition. Expressions use either a
+// shorthand operator, as in 'state=ACTIVE', 'name~prod' or 'created_at>2024-01-01', or a
+// SpaceONE operator surrounded by spaces, as in 'provider in aws,azure'.
+//
+// Comparisons against a date are sent as datetime_* operators, and numeric values of
+// <, <=, > and >= are sent as numbers.
+func ParseFilter(expr string) (Condition, error) {
+	// Values may contain spaces, as in 'name=web server prod', so a word is only taken as the
+	// operator after a valid key
+	fields := strings.SplitN(strings.TrimSpace(expr), " ", 3)
+	wordForm := len(fields) == 3 && filterKeyPattern.MatchString(fields[0]) && isWordOperator(fields[1])
+	if wordForm && isOperator(fields[1]) {
+		return newCondition(expr, fields[0], fields[1], strings.TrimSpace(fields[2]))
+	}
+
+	idx := strings.IndexAny(expr, "=!~<>")
+	if idx < 0 {
+		if wordForm {
+			return newCondition(expr, fields[0], fields[1], strings.TrimSpace(fields[2]))
+		}
+		return Condition{}, fmt.Errorf("invalid filter '%s': expected <key><operator><value>, e.g. state=ACTIVE", expr)
+	}
+
+	for _, op := range symbolOperators {
+		if strings.HasPrefix(expr[idx:], op.symbol) {
+			return newCondition(expr, strings.TrimSpace(expr[:idx]), op.operator, strings.TrimSpace(expr[idx+len(op.symbol):]))
+		}
+	}
+
+	return Condition{}, fmt.Errorf("invalid operator in filter '%s': use =, !=, ~, !~, >, >=, <, <= or one of %s",
+		expr, strings.Join(Operators, ", "))
+}
+
+func isWordOperator(word string) bool {
+	for _, r := range word {
+		if (r < 'a' || r > 'z') && r != '_' {
+			return false
+		}
+	}
+	return word != ""
+}
+
+func newCondition(expr, key, operator, value string) (Condition, error) {
+	if !filterKeyPattern.MatchString(key) {
+		return Condition{}, fmt.Errorf("invalid key in filter '%s'", expr)
+	}
+
+	if !isOperator(operator) {
+		return Condition{}, fmt.Errorf("unknown operator '%s' in filter '%s': valid operators are %s",
+			operator, expr, strings.Join(Operators, ", "))
+	}
+
+	cond := Condition{Key: key, Operator: operator, Value: value}
+
+	switch {
+	case listOperators[operator]:
+		values := []interface{}{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		cond.Value = values
+
+	case operator == "exists":
+		exists, err := strconv.ParseBool(value)
+		if err != nil {
+			return Condition{}, fmt.Errorf("filter '%s' expects true or false", expr)
+		}
+		cond.Value = exists
+
+	case operator == "lt" || operator == "lte" || operator == "gt" || operator == "gte":
+		if datePattern.MatchString(value) {
+			cond.Operator = "datetime_" + operator
+		} else if number, err := strconv.ParseFloat(value, 64); err == nil {
+			cond.Value = number
+		}
+	}
+
+	return cond, nil
+}
+
+func isOperator(operator string) bool {
+	for _, op := range Operators {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryType returns the message type of the query field of the method's request,
+// or nil if the method does not take a query or is not described
+func QueryType(methodDesc *desc.MethodDescriptor) *desc.MessageDescriptor {
+	if methodDesc == nil {
+		return nil
+	}
+	queryField := methodDesc.GetInputType().FindFieldByName("query")
+	if queryField == nil {
+		return nil
+	}
+	return queryField.GetMessageType()
+}
+
+// StandardQueryType describes the query of SpaceONE v2 list methods, with a filter list,
+// a repeated sort, only and page. It stands in for the query of methods called through
+// the console API without a cached descriptor.
+var StandardQueryType = sync.OnceValue(func() *desc.MessageDescriptor {
+	filter := builder.NewMessage("Filter").
+		AddField(builder.NewField("k", builder.FieldTypeString())).
+		AddField(builder.NewField("v", builder.FieldTypeString())).
+		AddField(builder.NewField("o", builder.FieldTypeString()))
+	sort := builder.NewMessage("Sort").
+		AddField(builder.NewField("key", builder.FieldTypeString())).
+		AddField(builder.NewField("desc", builder.FieldTypeBool()))
+	page := builder.NewMessage("Page").
+		AddField(builder.NewField("start", builder.FieldTypeInt32())).
+		AddField(builder.NewField("limit", builder.FieldTypeInt32()))
+	query := builder.NewMessage("Query").
+		AddField(builder.NewField("filter", builder.FieldTypeMessage(filter)).SetRepeated()).
+		AddField(builder.NewField("sort", builder.FieldTypeMessage(sort)).SetRepeated()).
+		AddField(builder.NewField("page", builder.FieldTypeMessage(page))).
+		AddField(builder.NewField("only", builder.FieldTypeString()).SetRepeated())
+
+	file, err := builder.NewFile("cfctl/standard_query.proto").SetPackageName("cfctl").
+		AddMessage(filter).AddMessage(sort).AddMessage(page).AddMessage(query).Build()
+	if err != nil {
+		panic(fmt.Sprintf("standard query: %v", err))
+	}
+	return file.FindMessage("cfctl.Query")
+})
+
+// AddFilter appends conditions to the query.filter list of params
+func AddFilter(params map[string]interface{}, conditions []Condition) {
+	if len(conditions) == 0 {
+		return
+	}
+
+	query := queryParams(params)
+	filter, _ := query["filter"].([]interface{})
+	for _, cond := range conditions {
+		filter = append(filter, map[string]interface{}{
+			"k": cond.Key,
+			"v": cond.Value,
+			"o": cond.Operator,
+		})
+	}
+	query["filter"] = filter
+}
+
+// queryParams returns the query map of params, creating it if needed
+func queryParams(params map[string]interface{}) map[string]interface{} {
+	query, ok := params["query"].(map[string]interface{})
+	if !ok {
+		query = make(map[string]interface{})
+		params["query"] = query
+	}
+	return query
+}
+
+// SortKey is a single key of a SpaceONE query sort
+type SortKey struct {
+	Key  string
+	Desc bool
+}
+
+// ParseSort parses a comma separated sort expression such as 'name' or 'provider,created_at:desc'
+func ParseSort(expr string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key := SortKey{Key: part}
+		if idx := strings.LastIndex(part, ":"); idx >= 0 {
+			key.Key = part[:idx]
+			switch strings.ToLower(part[idx+1:]) {
+			case "desc":
+				key.Desc = true
+			case "asc":
+			default:
+				return nil, fmt.Errorf("invalid sort order in '%s': use asc or desc", part)
+			}
+		}
+
+		if !filterKeyPattern.MatchString(key.Key) {
+			return nil, fmt.Errorf("invalid sort key '%s'", key.Key)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// SetSort sets query.sort of params. Queries with a repeated sort take every key, while
+// older ones with a single sort take only one; it returns false if the keys do not fit.
+func SetSort(params map[string]interface{}, queryType *desc.MessageDescriptor, keys []SortKey) bool {
+	if queryType == nil || len(keys) == 0 {
+		return false
+	}
+
+	sortField := queryType.FindFieldByName("sort")
+	if sortField == nil || sortField.GetMessageType() == nil || sortField.GetMessageType().FindFieldByName("key") == nil {
+		return false
+	}
+
+	sorts := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		sorts = append(sorts, map[string]interface{}{"key": key.Key, "desc": key.Desc})
+	}
+
+	if sortField.IsRepeated() {
+		queryParams(params)["sort"] = sorts
+		return true
+	}
+
+	if len(keys) > 1 {
+		return false
+	}
+	queryParams(params)["sort"] = sorts[0]
+	return true
+}
+
+// SetOnly sets query.only of params; it returns false if the query has no only field
+func SetOnly(params map[string]interface{}, queryType *desc.MessageDescriptor, fields []string) bool {
+	if queryType == nil || queryType.FindFieldByName("only") == nil || len(fields) == 0 {
+		return false
+	}
+
+	only := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		only = append(only, field)
+	}
+	queryParams(params)["only"] = only
+	return true
+}
+
+// SetLimit requests the first limit items through query.page; it returns false if the
+// query has no page field
+func SetLimit(params map[string]interface{}, queryType *desc.MessageDescriptor, limit int) bool {
+	if queryType == nil || queryType.FindFieldByName("page") == nil || limit <= 0 {
+		return false
+	}
+
+	queryParams(params)["page"] = map[string]interface{}{"start": 1, "limit": limit}
+	return true
+}
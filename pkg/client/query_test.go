@@ -0,0 +1,126 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    Condition
+		wantErr string
+	}{
+		{expr: "state=ACTIVE", want: Condition{Key: "state", Operator: "eq", Value: "ACTIVE"}},
+		{expr: "state != DELETED", want: Condition{Key: "state", Operator: "not", Value: "DELETED"}},
+		{expr: "name~prod", want: Condition{Key: "name", Operator: "contain", Value: "prod"}},
+		{expr: "name!~test", want: Condition{Key: "name", Operator: "not_contain", Value: "test"}},
+		{expr: "size>=10", want: Condition{Key: "size", Operator: "gte", Value: float64(10)}},
+		{expr: "size<2.5", want: Condition{Key: "size", Operator: "lt", Value: 2.5}},
+		{expr: "size>big", want: Condition{Key: "size", Operator: "gt", Value: "big"}},
+		{expr: "created_at>2024-01-01", want: Condition{Key: "created_at", Operator: "datetime_gt", Value: "2024-01-01"}},
+		{expr: "data.spec.cpu<=4", want: Condition{Key: "data.spec.cpu", Operator: "lte", Value: float64(4)}},
+		{expr: "name=web server prod", want: Condition{Key: "name", Operator: "eq", Value: "web server prod"}},
+		{expr: "name~in use", want: Condition{Key: "name", Operator: "contain", Value: "in use"}},
+		{expr: "provider in aws, azure", want: Condition{Key: "provider", Operator: "in", Value: []interface{}{"aws", "azure"}}},
+		{expr: "provider not_in aws", want: Condition{Key: "provider", Operator: "not_in", Value: []interface{}{"aws"}}},
+		{expr: "name like web server", want: Condition{Key: "name", Operator: "like", Value: "web server"}},
+		{expr: "tags exists true", want: Condition{Key: "tags", Operator: "exists", Value: true}},
+		{expr: "created_at datetime_gte 2024-01-01", want: Condition{Key: "created_at", Operator: "datetime_gte", Value: "2024-01-01"}},
+		{expr: "state", wantErr: "expected <key><operator><value>"},
+		{expr: "provider inn aws", wantErr: "unknown operator 'inn'"},
+		{expr: "tags exists maybe", wantErr: "expects true or false"},
+		{expr: "na me=x", wantErr: "invalid key"},
+		{expr: "=x", wantErr: "invalid key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ParseFilter(tt.expr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFilter(%q) error = %v, want one containing %q", tt.expr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilter(%q) error = %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilter(%q) = %#v, want %#v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []SortKey
+		wantErr string
+	}{
+		{expr: "name", want: []SortKey{{Key: "name"}}},
+		{expr: "created_at:desc", want: []SortKey{{Key: "created_at", Desc: true}}},
+		{expr: "provider, name:ASC ,created_at:DESC", want: []SortKey{{Key: "provider"}, {Key: "name"}, {Key: "created_at", Desc: true}}},
+		{expr: "data.size:desc", want: []SortKey{{Key: "data.size", Desc: true}}},
+		{expr: "name,,", want: []SortKey{{Key: "name"}}},
+		{expr: "", want: nil},
+		{expr: "name:down", wantErr: "invalid sort order"},
+		{expr: "na-me", wantErr: "invalid sort key"},
+		{expr: ":desc", wantErr: "invalid sort key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ParseSort(tt.expr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSort(%q) error = %v, want one containing %q", tt.expr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSort(%q) error = %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSort(%q) = %#v, want %#v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStandardQueryType(t *testing.T) {
+	queryType := StandardQueryType()
+	keys := []SortKey{{Key: "provider"}, {Key: "created_at", Desc: true}}
+
+	params := map[string]interface{}{}
+	if !SetSort(params, queryType, keys) {
+		t.Fatal("SetSort() = false, want every key to fit the repeated sort")
+	}
+	if !SetOnly(params, queryType, []string{"name"}) {
+		t.Error("SetOnly() = false, want true")
+	}
+	if !SetLimit(params, queryType, 5) {
+		t.Error("SetLimit() = false, want true")
+	}
+
+	want := map[string]interface{}{
+		"sort": []interface{}{
+			map[string]interface{}{"key": "provider", "desc": false},
+			map[string]interface{}{"key": "created_at", "desc": true},
+		},
+		"only": []interface{}{"name"},
+		"page": map[string]interface{}{"start": 1, "limit": 5},
+	}
+	if !reflect.DeepEqual(params["query"], want) {
+		t.Errorf("query = %#v, want %#v", params["query"], want)
+	}
+
+	if queryType.FindFieldByName("filter") == nil {
+		t.Error("the standard query has no filter field")
+	}
+	if QueryType(nil) != nil {
+		t.Error("QueryType(nil) != nil")
+	}
+}
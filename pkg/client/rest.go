@@ -0,0 +1,429 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Transports an environment can call services over
+const (
+	// TransportGRPC calls every service directly over gRPC
+	TransportGRPC = "grpc"
+	// TransportREST posts every call to the console API, for networks where gRPC is blocked
+	TransportREST = "rest"
+	// TransportAuto uses gRPC and falls back to REST when the service can't be reached
+	TransportAuto = "auto"
+)
+
+// autoConnectTimeout is how long the auto transport waits for a gRPC connection before
+// falling back to REST
+const autoConnectTimeout = 5 * time.Second
+
+// transportFromConfig checks the transport setting of an environment
+func transportFromConfig(value string) (string, error) {
+	switch value {
+	case "":
+		return TransportGRPC, nil
+	case TransportGRPC, TransportREST, TransportAuto:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid transport '%s': expected grpc, rest or auto", value)
+}
+
+// restTarget is where the calls of a REST session are posted, and how
+type restTarget struct {
+	baseURL string
+	client  *http.Client
+	header  http.Header
+	maxRecv int
+}
+
+// restSession returns a session that calls service through the console API. Descriptors
+// cached by earlier gRPC calls are used to check requests and shape responses; without one,
+// responses are only shaped on a best effort basis, see camelCaseKeys.
+func (c *Client) restSession(ctx context.Context, service string) (*session, error) {
+	baseURL, err := c.restBaseURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := c.restHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", "Bearer "+c.env.Token)
+	for key, values := range c.headers {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	return &session{
+		ctx:       ctx,
+		reflector: rpc.NewCachedReflector(c.cacheDir, service),
+		retry:     c.retry,
+		target:    baseURL,
+		secure:    strings.HasPrefix(baseURL, "https://"),
+		rest:      &restTarget{baseURL: baseURL, client: httpClient, header: header, maxRecv: c.messages.MaxRecvSize},
+	}, nil
+}
+
+// restBaseURL returns the console API endpoint of the environment, found once per client
+func (c *Client) restBaseURL(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	endpoint := c.restEndpoint
+	c.mu.Unlock()
+	if endpoint != "" {
+		return endpoint, nil
+	}
+
+	if !isConsoleEndpoint(c.env.Endpoint) {
+		return "", &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", c.name),
+			Err: fmt.Errorf("the rest transport needs a console endpoint such as https://console.example.com, not %s", c.env.Endpoint)}
+	}
+
+	apiEndpoint, err := configs.GetAPIEndpointEnvironment(ctx, c.env, c.env.Endpoint)
+	if errors.Is(err, configs.ErrDialSetting) {
+		return "", &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", c.name), Err: err}
+	}
+	if err != nil {
+		return "", &Error{Kind: KindUnavailable, Op: "failed to find the console API", Err: err}
+	}
+
+	endpoint = strings.TrimSuffix(apiEndpoint, "/")
+	c.mu.Lock()
+	c.restEndpoint = endpoint
+	c.mu.Unlock()
+	return endpoint, nil
+}
+
+// restHTTPClient returns the HTTP client of REST calls, with the tls setting of the
+// environment and its network_proxy, or HTTPS_PROXY without one
+func (c *Client) restHTTPClient() (*http.Client, error) {
+	httpClient, err := configs.HTTPClientEnvironment(c.env)
+	if err != nil {
+		return nil, &Error{Kind: KindConfig, Op: fmt.Sprintf("environment %s", c.name), Err: err}
+	}
+	return httpClient, nil
+}
+
+// isConsoleEndpoint reports whether endpoint is a console URL, which has a console API
+func isConsoleEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "https://") || strings.HasPrefix(endpoint, "http://")
+}
+
+// grpcReachable waits for conn to connect, reporting false once it fails or takes longer
+// than autoConnectTimeout
+func grpcReachable(ctx context.Context, conn *grpc.ClientConn) bool {
+	ctx, cancel := context.WithTimeout(ctx, autoConnectTimeout)
+	defer cancel()
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return true
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return false
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return false
+		}
+	}
+}
+
+// restPath returns the console API path of a call, e.g. /inventory/cloud-service/list for
+// list on the CloudService resource of inventory
+func restPath(service, resource, verb string) string {
+	return fmt.Sprintf("/%s/%s/%s", kebabCase(service), kebabCase(resource), kebabCase(verb))
+}
+
+// kebabCase turns CloudService, get_auth_info or APIKey into cloud-service, get-auth-info
+// and api-key
+func kebabCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			b.WriteRune('-')
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// resolveRESTMethod returns the console API path of verb and its descriptor when it is
+// cached. Without one, requests are sent unchecked and the keys of responses are renamed
+// as gRPC would name them.
+func (s *session) resolveRESTMethod(service, resource, verb string) (*desc.MethodDescriptor, string, error) {
+	path := restPath(service, resource, verb)
+
+	methodDesc, _, err := s.resolveDescriptor(service, resource, verb)
+	if errors.Is(err, rpc.ErrNotCached) {
+		rpc.Logf(rpc.LevelInfo, "%s: no cached descriptor of %s.%s, so the request is sent unchecked", path, service, resource)
+		return nil, path, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return methodDesc, path, nil
+}
+
+// callREST posts params to the console API. With the descriptor of the method, the
+// response is decoded into its message and encoded again, so it has the very shape a gRPC
+// call would have returned.
+func (s *session) callREST(methodDesc *desc.MethodDescriptor, path string, params map[string]interface{}) (Result, error) {
+	if methodDesc != nil && (methodDesc.IsClientStreaming() || methodDesc.IsServerStreaming()) {
+		return nil, &Error{Kind: KindInvalidArgument, Err: fmt.Errorf("%s streams messages, which the rest transport can't carry; use transport grpc", path)}
+	}
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if methodDesc != nil {
+		// Only to catch mistakes before sending; the console API takes the params as given
+		if _, err := newRequestMessage(methodDesc, params); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, &Error{Kind: KindInvalidArgument, Op: "failed to marshal input parameters to JSON", Err: err}
+	}
+
+	stopInvoke := rpc.Phase("invoke")
+	var respBody []byte
+	verb := strings.ReplaceAll(verbOf(path), "-", "_")
+	err = s.retry.do(s.ctx, verb, func() error {
+		var err error
+		respBody, err = s.rest.post(s.ctx, path, body)
+		return err
+	})
+	stopInvoke()
+	if err != nil {
+		return nil, err
+	}
+
+	jsonBytes := respBody
+	if methodDesc != nil {
+		respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
+		if err := respMsg.UnmarshalJSONPB(&jsonpb.Unmarshaler{AllowUnknownFields: true}, respBody); err != nil {
+			return nil, &Error{Kind: KindUnknown, Op: "decode response", Err: err}
+		}
+		if jsonBytes, err = respMsg.MarshalJSON(); err != nil {
+			return nil, &Error{Kind: KindUnknown, Op: "failed to marshal response", Err: err}
+		}
+	}
+
+	var result Result
+	if err := json.Unmarshal(jsonBytes, &result); err != nil {
+		return nil, &Error{Kind: KindUnknown, Op: "decode response", Err: err}
+	}
+	if methodDesc == nil {
+		result = camelCaseKeys(result)
+	}
+	return result, nil
+}
+
+// freeFormKeys name the google.protobuf.Struct fields of SpaceONE resources. gRPC returns
+// the keys inside them as they were stored, so they are left alone.
+var freeFormKeys = map[string]bool{
+	"data":     true,
+	"tags":     true,
+	"metadata": true,
+	"options":  true,
+	"labels":   true,
+}
+
+// camelCaseKeys renames the snake_case keys of a response decoded without a descriptor to
+// the lowerCamelCase JSON names a gRPC call returns, e.g. total_count to totalCount. It is
+// a best effort: free-form fields are guessed by name, and int64 values, which gRPC prints
+// as strings, are left as numbers since nothing tells them apart.
+func camelCaseKeys(value map[string]interface{}) map[string]interface{} {
+	renamed := make(map[string]interface{}, len(value))
+	for key, item := range value {
+		if !freeFormKeys[key] {
+			item = camelCaseValue(item)
+		}
+		renamed[jsonName(key)] = item
+	}
+	return renamed
+}
+
+func camelCaseValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return camelCaseKeys(v)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = camelCaseValue(item)
+		}
+	}
+	return value
+}
+
+// jsonName converts a proto field name to its JSON name the way protoc does: every
+// underscore is dropped and the letter after it capitalized
+func jsonName(name string) string {
+	if !strings.Contains(name, "_") {
+		return name
+	}
+
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// post sends body to path and returns the response body of a successful call
+func (t *restTarget) post(ctx context.Context, path string, body []byte) ([]byte, error) {
+	url := t.baseURL + path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, &Error{Kind: KindConfig, Op: fmt.Sprintf("failed to invoke %s", url), Err: err}
+	}
+	req.Header = t.header.Clone()
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, rpc.ContextError(ctx, err)
+		}
+		return nil, &Error{Kind: KindUnavailable, Code: codes.Unavailable, Op: fmt.Sprintf("unable to reach %s", url), Err: err}
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the limit to tell a response of the maximum size from a larger one
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, int64(t.maxRecv)+1))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, rpc.ContextError(ctx, err)
+		}
+		return nil, &Error{Kind: KindUnavailable, Code: codes.Unavailable, Op: fmt.Sprintf("failed to read the response of %s", url), Err: err}
+	}
+	if len(respBody) > t.maxRecv {
+		return nil, &Error{Kind: KindUnknown, Code: codes.ResourceExhausted, Op: fmt.Sprintf("failed to invoke %s", url),
+			Err: fmt.Errorf("received message larger than max (%d); raise max_recv_size of the environment or use --max-recv-size", t.maxRecv)}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newRESTError(url, resp.StatusCode, respBody)
+	}
+	return respBody, nil
+}
+
+// newRESTError converts a failed console API call into a client Error, filled in like the
+// error of the same gRPC call
+func newRESTError(url string, statusCode int, body []byte) *Error {
+	clientErr := &Error{Op: fmt.Sprintf("failed to invoke %s", url), Code: httpStatusCode(statusCode)}
+
+	message := restErrorMessage(body)
+	clientErr.describe(message)
+	clientErr.Err = fmt.Errorf("%d %s: %s", statusCode, http.StatusText(statusCode), message)
+
+	return clientErr
+}
+
+// restErrorMessage reads the error code and message out of an error response, which the
+// console API sends as {"code": ..., "message": ...}, possibly under "detail" or "error"
+func restErrorMessage(body []byte) string {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	for _, key := range []string{"detail", "error"} {
+		switch nested := payload[key].(type) {
+		case map[string]interface{}:
+			payload = nested
+		case string:
+			return nested
+		}
+	}
+
+	message, _ := payload["message"].(string)
+	code, _ := payload["error_code"].(string)
+	if code == "" {
+		code, _ = payload["code"].(string)
+	}
+
+	switch {
+	case strings.HasPrefix(code, "ERROR_") && message != "":
+		return code + ": " + message
+	case message != "":
+		return message
+	case code != "":
+		return code
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// httpStatusCode maps the status of a console API response to the gRPC code of the same
+// failure, so REST errors are classified and retried like gRPC ones
+func httpStatusCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
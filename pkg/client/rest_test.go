@@ -0,0 +1,81 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"name", "name"},
+		{"total_count", "totalCount"},
+		{"cloud_service_id", "cloudServiceId"},
+		{"ipv4_address", "ipv4Address"},
+		{"region_2", "region2"},
+		{"_private", "Private"},
+		{"trailing_", "trailing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonName(tt.name); got != tt.want {
+				t.Errorf("jsonName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCamelCaseKeys(t *testing.T) {
+	var response map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"results": [
+			{"cloud_service_id": "cs-1", "data": {"region_code": "us-east-1"}, "tags": {"cost_center": "a"},
+			 "reference": {"resource_id": "i-1"}, "collection_info": [{"service_account_id": "sa-1"}]}
+		],
+		"total_count": 1
+	}`), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want map[string]interface{}
+	err = json.Unmarshal([]byte(`{
+		"results": [
+			{"cloudServiceId": "cs-1", "data": {"region_code": "us-east-1"}, "tags": {"cost_center": "a"},
+			 "reference": {"resourceId": "i-1"}, "collectionInfo": [{"serviceAccountId": "sa-1"}]}
+		],
+		"totalCount": 1
+	}`), &want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := camelCaseKeys(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("camelCaseKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestKebabCase(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"CloudService", "cloud-service"},
+		{"get_auth_info", "get-auth-info"},
+		{"APIKey", "api-key"},
+		{"list", "list"},
+		{"Region", "region"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kebabCase(tt.name); got != tt.want {
+				t.Errorf("kebabCase(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy decides whether a failed call is sent again and how long to wait first.
+// The wait doubles after every attempt, up to MaxBackoff, and is randomized so that
+// many clients failing together do not retry in lockstep.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first; 1 disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Codes lists the gRPC status codes worth retrying.
+	Codes []codes.Code
+	// Force also retries verbs other than list, get, stat and analyze, such as create
+	// and delete, which are not always safe to repeat.
+	Force bool
+	// OnRetry, when set, is called before each retry with the number of the failed attempt.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// DefaultRetryPolicy retries UNAVAILABLE and DEADLINE_EXCEEDED up to three attempts
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Codes:          []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+	}
+}
+
+// readVerbs only read data, so sending them again after a failure is harmless. Any other
+// verb may have taken effect even though the call failed, and is only retried with Force.
+var readVerbs = map[string]bool{
+	"list":    true,
+	"get":     true,
+	"stat":    true,
+	"analyze": true,
+}
+
+// IsIdempotent reports whether verb can safely be sent again after a failure
+func IsIdempotent(verb string) bool {
+	return readVerbs[verb]
+}
+
+// ParseCodes converts status code names such as UNAVAILABLE or resource_exhausted
+func ParseCodes(names []string) ([]codes.Code, error) {
+	result := make([]codes.Code, 0, len(names))
+	for _, name := range names {
+		var code codes.Code
+		quoted := strconv.Quote(strings.ToUpper(strings.TrimSpace(name)))
+		if err := code.UnmarshalJSON([]byte(quoted)); err != nil {
+			return nil, fmt.Errorf("unknown status code '%s'", name)
+		}
+		result = append(result, code)
+	}
+	return result, nil
+}
+
+// retryPolicyFromConfig applies the retry setting of an environment to the default policy
+func retryPolicyFromConfig(cfg configs.RetryConfig) (RetryPolicy, error) {
+	policy := DefaultRetryPolicy()
+
+	if cfg.MaxAttempts > 0 {
+		policy.MaxAttempts = cfg.MaxAttempts
+	}
+
+	if cfg.InitialBackoff != "" {
+		d, err := time.ParseDuration(cfg.InitialBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("invalid retry.initial_backoff: %v", err)
+		}
+		policy.InitialBackoff = d
+	}
+
+	if cfg.MaxBackoff != "" {
+		d, err := time.ParseDuration(cfg.MaxBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("invalid retry.max_backoff: %v", err)
+		}
+		policy.MaxBackoff = d
+	}
+
+	if len(cfg.Codes) > 0 {
+		parsed, err := ParseCodes(cfg.Codes)
+		if err != nil {
+			return policy, fmt.Errorf("invalid retry.codes: %v", err)
+		}
+		policy.Codes = parsed
+	}
+
+	return policy, nil
+}
+
+// backoff returns how long to wait after the given failed attempt, counting from 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Wait somewhere between half and all of the delay
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryable reports whether err, returned by verb, is worth another attempt
+func (p RetryPolicy) retryable(verb string, err error) bool {
+	var stop *finalError
+	if errors.As(err, &stop) {
+		return false
+	}
+	if !p.Force && !IsIdempotent(verb) {
+		return false
+	}
+
+	// Calls over REST carry the status code in the Error rather than a gRPC status
+	code := status.Code(err)
+	var clientErr *Error
+	if errors.As(err, &clientErr) && clientErr.Code != codes.OK {
+		code = clientErr.Code
+	}
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// do runs attempt until it succeeds, fails with an error that is not worth retrying or
+// runs out of attempts. Waiting between attempts stops early when ctx is done.
+func (p RetryPolicy) do(ctx context.Context, verb string, attempt func() error) error {
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(verb, err) {
+			return unwrapFinal(err)
+		}
+
+		delay := p.backoff(n)
+		if p.OnRetry != nil {
+			p.OnRetry(n, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// finalError marks an error that must not be retried, e.g. a stream that failed after
+// some of its messages were already handed to the caller
+type finalError struct {
+	err error
+}
+
+func (e *finalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *finalError) Unwrap() error {
+	return e.err
+}
+
+func unwrapFinal(err error) error {
+	var stop *finalError
+	if errors.As(err, &stop) {
+		return stop.err
+	}
+	return err
+}
+
+// verbOf returns the method name of a full method such as /pkg.Service/list
+func verbOf(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
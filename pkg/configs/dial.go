@@ -0,0 +1,207 @@
+package configs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
+	"golang.org/x/net/http/httpproxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ErrDialSetting is returned by Dial when the tls, network_proxy or authority setting of the
+// environment can't be used
+var ErrDialSetting = errors.New("invalid connection setting")
+
+// TLSConfig holds the TLS setting of an environment for grpc+ssl:// endpoints and the console
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`              // PEM bundle trusted in addition to the system roots
+	CertFile           string `yaml:"cert_file"`            // Client certificate for mutual TLS
+	KeyFile            string `yaml:"key_file"`             // Private key of the client certificate
+	ServerName         string `yaml:"server_name"`          // Name expected in the server certificate, if not the host
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // Accept any server certificate; for testing only
+}
+
+// ClientConfig builds the tls.Config described by the setting
+func (t TLSConfig) ClientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(expandHome(t.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls.ca_file: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in tls.ca_file %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(expandHome(t.CertFile), expandHome(t.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Dial connects to target with the TLS and proxy setting of the current environment.
+// secure selects TLS, as for grpc+ssl:// endpoints; grpc:// endpoints are dialed in plaintext.
+func Dial(target string, secure bool, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return DialEnvironment(CurrentEnvironment(), target, secure, opts...)
+}
+
+// DialEnvironment is Dial with the setting of env. Every gRPC connection of cfctl is made
+// here, so that the TLS and proxy setting and call tracing apply to all of them.
+func DialEnvironment(env Environment, target string, secure bool, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if secure {
+		config, err := env.TLS.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDialSetting, err)
+		}
+		creds = credentials.NewTLS(config)
+	}
+
+	if env.Authority != "" {
+		if err := checkAuthority(env.Authority, env.TLS.ServerName, secure); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDialSetting, err)
+		}
+		rpc.Logf(rpc.LevelInfo, "dialing %s as %s (tls: %v)", target, env.Authority, secure)
+		opts = append(opts, grpc.WithAuthority(env.Authority))
+	} else {
+		rpc.Logf(rpc.LevelInfo, "dialing %s (tls: %v)", target, secure)
+	}
+
+	proxyOption, err := proxyDialOption(env.NetworkProxy, target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDialSetting, err)
+	}
+	if proxyOption != nil {
+		opts = append(opts, proxyOption)
+	}
+
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)
+	return grpc.Dial(target, append(opts, rpc.TraceDialOptions()...)...)
+}
+
+// HTTPClient returns an HTTP client with the TLS and proxy setting of the current
+// environment, for the console config and the console API
+func HTTPClient() (*http.Client, error) {
+	return HTTPClientEnvironment(CurrentEnvironment())
+}
+
+// HTTPClientEnvironment is HTTPClient with the setting of env. The CA, client certificate
+// and insecure_skip_verify of tls apply; server_name names the gRPC server, so it doesn't.
+func HTTPClientEnvironment(env Environment) (*http.Client, error) {
+	config, err := env.TLS.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDialSetting, err)
+	}
+	config.ServerName = ""
+
+	// Like gRPC connections, read HTTPS_PROXY, HTTP_PROXY and NO_PROXY on every request
+	proxyFunc := func(req *http.Request) (*url.URL, error) {
+		return httpproxy.FromEnvironment().ProxyFunc()(req.URL)
+	}
+	if env.NetworkProxy != "" {
+		proxyURL, err := ParseNetworkProxy(env.NetworkProxy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDialSetting, err)
+		}
+		proxyFunc = http.ProxyURL(proxyURL)
+	}
+
+	// The defaults of http.DefaultTransport, with the setting of env
+	transport := &http.Transport{
+		Proxy:                 proxyFunc,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:       config,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{Transport: rpc.TraceTransport(transport)}, nil
+}
+
+// CurrentEnvironment reads the connection setting of the current environment. Without a
+// setting file, e.g. before 'cfctl setting init', the defaults apply.
+func CurrentEnvironment() Environment {
+	settingPath, err := GetSettingFilePath()
+	if err != nil {
+		return Environment{}
+	}
+
+	v, err := setViperWithSetting(settingPath)
+	if err != nil {
+		return Environment{}
+	}
+
+	env := v.GetString("environment")
+	return Environment{
+		NetworkProxy: v.GetString(fmt.Sprintf("environments.%s.network_proxy", env)),
+		TLS:          tlsConfigOf(env, v),
+		Authority:    v.GetString(fmt.Sprintf("environments.%s.authority", env)),
+	}
+}
+
+// ValidateAuthority makes sure an authority override is a host name, with an optional port
+func ValidateAuthority(authority string) error {
+	if authority == "" || strings.ContainsAny(authority, "/ \t@") {
+		return fmt.Errorf("invalid authority '%s': expected a host name such as identity.api.example.com", authority)
+	}
+	return nil
+}
+
+// checkAuthority validates the authority setting. Over TLS the server certificate is
+// verified against the authority, so it can't differ from tls.server_name.
+func checkAuthority(authority, serverName string, secure bool) error {
+	if err := ValidateAuthority(authority); err != nil {
+		return err
+	}
+	if secure && serverName != "" && serverName != authority {
+		return fmt.Errorf("authority %s and tls.server_name %s must match; set only one of them", authority, serverName)
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
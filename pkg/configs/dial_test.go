@@ -0,0 +1,195 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValidateAuthority(t *testing.T) {
+	tests := []struct {
+		authority string
+		wantErr   bool
+	}{
+		{authority: "identity.api.example.com"},
+		{authority: "identity.api.example.com:443"},
+		{authority: "localhost"},
+		{authority: "[::1]:50051"},
+		{authority: "", wantErr: true},
+		{authority: "grpc://identity.api.example.com", wantErr: true},
+		{authority: "user@identity.api.example.com", wantErr: true},
+		{authority: "identity api", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.authority, func(t *testing.T) {
+			err := ValidateAuthority(tt.authority)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAuthority(%q) error = %v, wantErr %v", tt.authority, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckAuthority(t *testing.T) {
+	tests := []struct {
+		name       string
+		authority  string
+		serverName string
+		secure     bool
+		wantErr    string
+	}{
+		{name: "plaintext", authority: "identity.api.example.com"},
+		{name: "plaintext ignores server name", authority: "identity.api.example.com", serverName: "other.example.com"},
+		{name: "tls without server name", authority: "identity.api.example.com", secure: true},
+		{name: "tls with the same server name", authority: "identity.api.example.com", serverName: "identity.api.example.com", secure: true},
+		{name: "tls with another server name", authority: "identity.api.example.com", serverName: "other.example.com", secure: true, wantErr: "must match"},
+		{name: "malformed", authority: "https://identity", wantErr: "expected a host name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAuthority(tt.authority, tt.serverName, tt.secure)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkAuthority() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkAuthority() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// authorityBackend serves the gRPC health service and records the :authority of each call
+type authorityBackend struct {
+	mu          sync.Mutex
+	authorities []string
+}
+
+func (b *authorityBackend) last() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.authorities) == 0 {
+		return ""
+	}
+	return b.authorities[len(b.authorities)-1]
+}
+
+func (b *authorityBackend) serve(t *testing.T, lis net.Listener) {
+	t.Helper()
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		b.mu.Lock()
+		b.authorities = append(b.authorities, strings.Join(md.Get(":authority"), ","))
+		b.mu.Unlock()
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+}
+
+// listenUnix listens on a socket in a new directory. The directory is kept short, as socket
+// paths are limited to about a hundred bytes.
+func listenUnix(t *testing.T) (net.Listener, string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "cfctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "api.sock")
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lis, path
+}
+
+func TestDialEnvironmentAuthority(t *testing.T) {
+	tests := []struct {
+		name          string
+		unix          bool
+		env           Environment
+		wantAuthority string // "" for the address dialed
+	}{
+		{name: "tcp"},
+		{name: "tcp with authority", env: Environment{Authority: "identity.api.example.com"}, wantAuthority: "identity.api.example.com"},
+		{name: "socket", unix: true, wantAuthority: "localhost"},
+		{name: "socket with authority", unix: true, env: Environment{Authority: "identity.api.example.com:443"}, wantAuthority: "identity.api.example.com:443"},
+		{name: "socket is never proxied", unix: true, env: Environment{NetworkProxy: "socks5://127.0.0.1:1"}, wantAuthority: "localhost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lis net.Listener
+			var target string
+			if tt.unix {
+				var path string
+				lis, path = listenUnix(t)
+				endpoint, err := ParseEndpoint("grpc+unix://" + path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				target = endpoint.HostPort
+			} else {
+				var err error
+				if lis, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+					t.Fatal(err)
+				}
+				target = lis.Addr().String()
+			}
+
+			backend := &authorityBackend{}
+			backend.serve(t, lis)
+
+			if err := checkHealth(t, tt.env, target); err != nil {
+				t.Fatalf("Check() over %s error = %v", target, err)
+			}
+
+			want := tt.wantAuthority
+			if want == "" {
+				want = target
+			}
+			if got := backend.last(); got != want {
+				t.Errorf("the server saw authority %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDialEnvironmentRejectsAuthority(t *testing.T) {
+	tests := []struct {
+		name string
+		env  Environment
+	}{
+		{name: "malformed", env: Environment{Authority: "grpc://identity.api.example.com"}},
+		{name: "server name mismatch", env: Environment{Authority: "identity.api.example.com", TLS: TLSConfig{ServerName: "other.example.com"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := DialEnvironment(tt.env, "127.0.0.1:443", true)
+			if err == nil {
+				conn.Close()
+			}
+			if !errors.Is(err, ErrDialSetting) {
+				t.Errorf("DialEnvironment() error = %v, want ErrDialSetting", err)
+			}
+		})
+	}
+}
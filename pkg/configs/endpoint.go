@@ -3,29 +3,32 @@ package configs
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/jhump/protoreflect/dynamic"
-	"github.com/jhump/protoreflect/grpcreflect"
-	"github.com/pterm/pterm"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 )
 
 // GetAPIEndpoint fetches the actual API endpoint from the config endpoint
 func GetAPIEndpoint(endpoint string) (string, error) {
-	// Handle gRPC+SSL protocol
-	if strings.HasPrefix(endpoint, "grpc+ssl://") || strings.HasPrefix(endpoint, "grpc://") {
+	ctx, cancel := rpc.Context()
+	defer cancel()
+	return GetAPIEndpointEnvironment(ctx, CurrentEnvironment(), endpoint)
+}
+
+// GetAPIEndpointEnvironment is GetAPIEndpoint with the TLS and proxy setting of env,
+// bounded by ctx
+func GetAPIEndpointEnvironment(ctx context.Context, env Environment, endpoint string) (string, error) {
+	// Handle gRPC protocols
+	if IsGRPCEndpoint(endpoint) {
 		// For gRPC+SSL endpoints, return as is since it's already in the correct format
+		rpc.Logf(rpc.LevelInfo, "API endpoint of %s is the endpoint itself", endpoint)
 		return endpoint, nil
 	}
+	defer rpc.Phase("API endpoint discovery")()
 
 	// Remove protocol prefix if exists
 	endpoint = strings.TrimPrefix(endpoint, "https://")
@@ -34,11 +37,23 @@ func GetAPIEndpoint(endpoint string) (string, error) {
 	// Construct config endpoint
 	configURL := fmt.Sprintf("https://%s/config/production.json", endpoint)
 
-	// Make HTTP request
-	resp, err := http.Get(configURL)
+	client, err := HTTPClientEnvironment(env)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, configURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch config: %v", err)
 	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", rpc.ContextError(ctx, err)
+		}
+		return "", fmt.Errorf("failed to fetch config: %v", err)
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
@@ -60,23 +75,33 @@ func GetAPIEndpoint(endpoint string) (string, error) {
 		return "", fmt.Errorf("no API endpoint found in config")
 	}
 
-	return strings.TrimSuffix(config.ConsoleAPIV2.Endpoint, "/"), nil
+	apiEndpoint := strings.TrimSuffix(config.ConsoleAPIV2.Endpoint, "/")
+	rpc.Logf(rpc.LevelInfo, "API endpoint of %s is %s", endpoint, apiEndpoint)
+	return apiEndpoint, nil
 }
 
 // GetIdentityEndpoint fetches the identity service endpoint from the API endpoint
 func GetIdentityEndpoint(apiEndpoint string) (string, bool, error) {
-	// If the endpoint is already gRPC+SSL
-	if strings.HasPrefix(apiEndpoint, "grpc+ssl://") || strings.HasPrefix(apiEndpoint, "grpc://") {
+	ctx, cancel := rpc.Context()
+	defer cancel()
+	return GetIdentityEndpointEnvironment(ctx, CurrentEnvironment(), apiEndpoint)
+}
+
+// GetIdentityEndpointEnvironment is GetIdentityEndpoint with the TLS and proxy setting of
+// env, bounded by ctx
+func GetIdentityEndpointEnvironment(ctx context.Context, env Environment, apiEndpoint string) (string, bool, error) {
+	// If the endpoint is already a gRPC endpoint
+	if IsGRPCEndpoint(apiEndpoint) {
 		// Check if it contains 'identity'
 		containsIdentity := strings.Contains(apiEndpoint, "identity")
 
-		// Remove /v1 suffix if present
-		if idx := strings.Index(apiEndpoint, "/v"); idx != -1 {
-			apiEndpoint = apiEndpoint[:idx]
-		}
+		// Remove the /v1 path if present
+		apiEndpoint = stripPath(apiEndpoint)
 
+		rpc.Logf(rpc.LevelInfo, "identity endpoint is %s (identity service: %v)", apiEndpoint, containsIdentity)
 		return apiEndpoint, containsIdentity, nil
 	}
+	defer rpc.Phase("identity endpoint discovery")()
 
 	// Original HTTP/HTTPS handling logic
 	endpointListURL := fmt.Sprintf("%s/identity/endpoint/list", apiEndpoint)
@@ -87,7 +112,7 @@ func GetIdentityEndpoint(apiEndpoint string) (string, bool, error) {
 		return "", false, fmt.Errorf("failed to create payload: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", endpointListURL, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpointListURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return "", false, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -95,9 +120,15 @@ func GetIdentityEndpoint(apiEndpoint string) (string, bool, error) {
 	req.Header.Set("accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client, err := HTTPClientEnvironment(env)
+	if err != nil {
+		return "", false, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return "", false, rpc.ContextError(ctx, err)
+		}
 		return "", false, fmt.Errorf("failed to fetch endpoints: %v", err)
 	}
 	defer resp.Body.Close()
@@ -115,113 +146,80 @@ func GetIdentityEndpoint(apiEndpoint string) (string, bool, error) {
 
 	for _, service := range result.Results {
 		if service.Service == "identity" {
-			endpoint := service.Endpoint
-			if idx := strings.Index(endpoint, "/v"); idx != -1 {
-				endpoint = endpoint[:idx]
-			}
+			endpoint := stripPath(service.Endpoint)
+			rpc.Logf(rpc.LevelInfo, "identity endpoint from %s is %s", endpointListURL, endpoint)
 			return endpoint, true, nil
 		}
 	}
 
+	rpc.Logf(rpc.LevelInfo, "%s lists no identity endpoint", endpointListURL)
 	return "", false, nil
 }
 
+// GetServiceEndpoint returns the endpoint of serviceName in the current environment, such
+// as grpc+ssl://inventory.api.example.com:443
 func GetServiceEndpoint(config *Environments, serviceName string) (string, error) {
 	envConfig := config.Environments[config.Environment]
 	if envConfig.Endpoint == "" {
 		return "", fmt.Errorf("endpoint not found in environment config")
 	}
 
-	if strings.HasPrefix(envConfig.Endpoint, "grpc://") {
-		// Allow both localhost and cluster-internal addresses
-		if strings.Contains(envConfig.Endpoint, "localhost") || strings.Contains(envConfig.Endpoint, ".svc.cluster.local") {
-			return envConfig.Endpoint, nil
-		}
-	}
-
-	// Get console API endpoint
-	apiEndpoint, err := GetAPIEndpoint(envConfig.Endpoint)
-	if err != nil {
-		pterm.Error.Printf("Failed to get API endpoint: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Get identity endpoint
-	identityEndpoint, _, err := GetIdentityEndpoint(apiEndpoint)
+	ctx, cancel := rpc.Context()
+	defer cancel()
 
-	// Fetch endpoints map
-	endpointsMap, err := FetchEndpointsMap(identityEndpoint)
+	target, err := NewResolver(config.Environment, envConfig).Resolve(ctx, serviceName)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch endpoints map: %v", err)
-	}
-
-	// Get endpoint for the requested service
-	endpoint, exists := endpointsMap[serviceName]
-	if !exists {
-		return "", fmt.Errorf("no endpoint found for service: %s", serviceName)
+		return "", err
 	}
-
-	// Remove /v1 suffix if present
-	if idx := strings.Index(endpoint, "/v"); idx != -1 {
-		endpoint = endpoint[:idx]
-	}
-
-	return endpoint, nil
+	return target.String(), nil
 }
 
+// FetchEndpointsMap asks the identity service for the endpoint of every service. endpoint is
+// a console API endpoint or the gRPC endpoint of identity or of any other service.
 func FetchEndpointsMap(endpoint string) (map[string]string, error) {
-	if strings.HasPrefix(endpoint, "grpc://localhost") {
+	ctx, cancel := rpc.Context()
+	defer cancel()
+	return FetchEndpointsMapEnvironment(ctx, CurrentEnvironment(), endpoint)
+}
+
+// FetchEndpointsMapEnvironment is FetchEndpointsMap with the TLS and proxy setting of env,
+// bounded by ctx
+func FetchEndpointsMapEnvironment(ctx context.Context, env Environment, endpoint string) (map[string]string, error) {
+	if strings.HasPrefix(endpoint, "grpc://localhost") || strings.HasPrefix(endpoint, "grpc+unix://") {
 		endpointsMap := make(map[string]string)
 		endpointsMap["static"] = endpoint
 		return endpointsMap, nil
 	}
 
 	// Get identity service endpoint
-	identityEndpoint, hasIdentityService, err := GetIdentityEndpoint(endpoint)
-	listEndpointsUrl := endpoint + "/identity/endpoint/list"
-
+	identityEndpoint, hasIdentityService, err := GetIdentityEndpointEnvironment(ctx, env, endpoint)
 	if err != nil {
-		pterm.Error.Printf("Failed to get identity endpoint: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to get identity endpoint: %v", err)
 	}
+	listEndpointsUrl := endpoint + "/identity/endpoint/list"
 
 	if !hasIdentityService {
-		// Handle gRPC+SSL protocol directly
-		if strings.HasPrefix(endpoint, "grpc+ssl://") || strings.HasPrefix(endpoint, "grpc://") {
-			protocol := "grpc+ssl://"
-			if strings.HasPrefix(endpoint, "grpc://") {
-				protocol = "grpc://"
-			}
-
-			// Parse the endpoint
-			hostPart := strings.TrimPrefix(endpoint, protocol)
-			hostPart = strings.TrimSuffix(hostPart, "/")
-
-			hostParts := strings.Split(hostPart, ".")
-			if len(hostParts) == 0 {
-				return nil, fmt.Errorf("invalid endpoint format: %s", endpoint)
+		// Handle gRPC protocols directly
+		if IsGRPCEndpoint(endpoint) {
+			// Ask the identity service next to the endpoint. IPs and single-label hosts have
+			// no name to derive it from, so the endpoint itself is asked.
+			identityEndpoint := endpoint
+			if ServiceOfEndpoint(endpoint) != "" {
+				identityEndpoint, err = SiblingEndpoint(endpoint, "identity")
+				if err != nil {
+					return nil, err
+				}
 			}
 
-			svc := hostParts[0]
-			baseDomain := strings.Join(hostParts[1:], ".")
-
-			// Configure TLS
-			tlsConfig := &tls.Config{
-				InsecureSkipVerify: false,
-			}
-			opts := []grpc.DialOption{
-				grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+			target, err := ParseEndpoint(identityEndpoint)
+			if err != nil {
+				return nil, err
 			}
-
-			//If current service is not identity, modify hostPort to use identity service
-			if svc != "identity" {
-				hostPort := fmt.Sprintf("identity.%s", baseDomain)
-				endpoints, err := invokeGRPCEndpointList(hostPort, opts)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get endpoints from gRPC: %v", err)
-				}
-				return endpoints, nil
+			endpoints, err := invokeGRPCEndpointList(ctx, env, target.HostPort, target.Secure)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get endpoints from gRPC: %v", err)
 			}
+			return endpoints, nil
 		}
 
 		payload := map[string]string{}
@@ -230,7 +228,7 @@ func FetchEndpointsMap(endpoint string) (map[string]string, error) {
 			return nil, err
 		}
 
-		req, err := http.NewRequest("POST", listEndpointsUrl, bytes.NewBuffer(jsonPayload))
+		req, err := http.NewRequestWithContext(ctx, "POST", listEndpointsUrl, bytes.NewBuffer(jsonPayload))
 		if err != nil {
 			return nil, err
 		}
@@ -238,11 +236,14 @@ func FetchEndpointsMap(endpoint string) (map[string]string, error) {
 		req.Header.Set("accept", "application/json")
 		req.Header.Set("Content-Type", "application/json")
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		client, err := HTTPClientEnvironment(env)
 		if err != nil {
 			return nil, err
 		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, rpc.ContextError(ctx, err)
+		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
@@ -268,36 +269,20 @@ func FetchEndpointsMap(endpoint string) (map[string]string, error) {
 
 		return endpointsMap, nil
 	} else {
-		// Parse the endpoint
-		parts := strings.Split(identityEndpoint, "://")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid endpoint format: %s", identityEndpoint)
-		}
-
-		scheme := parts[0]
-		hostPort := parts[1]
-
-		// Configure gRPC connection based on scheme
-		var opts []grpc.DialOption
-		if scheme == "grpc+ssl" {
-			tlsConfig := &tls.Config{
-				InsecureSkipVerify: false, // Enable server certificate verification
-			}
-			creds := credentials.NewTLS(tlsConfig)
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-		} else {
-			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		target, err := ParseEndpoint(identityEndpoint)
+		if err != nil {
+			return nil, err
 		}
 
-		// Establish the connection
-		conn, err := grpc.Dial(hostPort, opts...)
+		// Establish the connection, over TLS for grpc+ssl://
+		conn, err := DialEnvironment(env, target.HostPort, target.Secure)
 		if err != nil {
 			return nil, fmt.Errorf("connection failed: unable to connect to %s: %v", identityEndpoint, err)
 		}
 		defer conn.Close()
 
 		// Use Reflection to discover services
-		refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+		refClient := rpc.NewReflectionClient(ctx, conn)
 		defer refClient.Reset()
 
 		// Resolve the service and method
@@ -306,6 +291,9 @@ func FetchEndpointsMap(endpoint string) (map[string]string, error) {
 
 		serviceDesc, err := refClient.ResolveService(serviceName)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, rpc.ContextError(ctx, err)
+			}
 			return nil, fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
 		}
 
@@ -332,8 +320,11 @@ func FetchEndpointsMap(endpoint string) (map[string]string, error) {
 		fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
 
 		// Invoke the gRPC method
-		err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+		err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, rpc.ContextError(ctx, err)
+			}
 			return nil, fmt.Errorf("failed to invoke method %s: %v", fullMethod, err)
 		}
 
@@ -356,7 +347,7 @@ func FetchEndpointsMap(endpoint string) (map[string]string, error) {
 	}
 }
 
-func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string]string, error) {
+func invokeGRPCEndpointList(ctx context.Context, env Environment, hostPort string, secure bool) (map[string]string, error) {
 	// Wrap the entire operation in a function that can recover from panic
 	var endpoints = make(map[string]string)
 	var err error
@@ -375,14 +366,14 @@ func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string
 	}()
 
 	// Establish the connection
-	conn, err := grpc.Dial(hostPort, opts...)
+	conn, err := DialEnvironment(env, hostPort, secure)
 	if err != nil {
 		return nil, fmt.Errorf("connection failed: unable to connect to %s: %v", hostPort, err)
 	}
 	defer conn.Close()
 
 	// Use Reflection to discover services
-	refClient := grpcreflect.NewClient(context.Background(), grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+	refClient := rpc.NewReflectionClient(ctx, conn)
 	defer refClient.Reset()
 
 	serviceName := "spaceone.api.identity.v2.Endpoint"
@@ -390,6 +381,9 @@ func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string
 
 	serviceDesc, err := refClient.ResolveService(serviceName)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, rpc.ContextError(ctx, err)
+		}
 		return nil, fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
 	}
 
@@ -402,8 +396,11 @@ func invokeGRPCEndpointList(hostPort string, opts []grpc.DialOption) (map[string
 	respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
 	fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
 
-	err = conn.Invoke(context.Background(), fullMethod, reqMsg, respMsg)
+	err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, rpc.ContextError(ctx, err)
+		}
 		return nil, fmt.Errorf("failed to invoke method %s: %v", fullMethod, err)
 	}
 
@@ -0,0 +1,280 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidEndpoint is returned for endpoints and endpoint templates that can't be parsed
+var ErrInvalidEndpoint = errors.New("invalid endpoint")
+
+// ErrUnknownService is returned by Resolve for services missing from the endpoint list
+var ErrUnknownService = errors.New("no endpoint found for service")
+
+// endpointsCacheTTL is how long the endpoint list of an environment is reused
+const endpointsCacheTTL = 24 * time.Hour
+
+// Target is the address a service is dialed at
+type Target struct {
+	HostPort string // host:port, with IPv6 hosts in brackets, or unix:///path for a socket
+	Secure   bool   // Whether to dial over TLS
+}
+
+// String returns the target as a grpc://, grpc+ssl:// or grpc+unix:// endpoint
+func (t Target) String() string {
+	if t.IsUnix() {
+		return "grpc+unix://" + strings.TrimPrefix(t.HostPort, "unix://")
+	}
+	if t.Secure {
+		return "grpc+ssl://" + t.HostPort
+	}
+	return "grpc://" + t.HostPort
+}
+
+// IsUnix reports whether the target is a Unix domain socket
+func (t Target) IsUnix() bool {
+	return strings.HasPrefix(t.HostPort, "unix://")
+}
+
+// IsGRPCEndpoint reports whether endpoint is dialed with gRPC directly rather than found
+// through a console API
+func IsGRPCEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "grpc://") || strings.HasPrefix(endpoint, "grpc+ssl://") ||
+		strings.HasPrefix(endpoint, "grpc+unix://")
+}
+
+// ParseEndpoint reads an endpoint such as grpc+ssl://inventory.api.example.com:443/v1 into
+// the target to dial. Paths are dropped, and without a port grpc+ssl:// and https:// use
+// 443, http:// uses 80 and grpc:// uses 443 like gRPC itself. grpc+unix:///run/identity.sock
+// names a Unix domain socket, dialed in plaintext.
+func ParseEndpoint(endpoint string) (Target, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return Target{}, fmt.Errorf("%w '%s': %v", ErrInvalidEndpoint, endpoint, err)
+	}
+
+	port := "443"
+	var secure bool
+	switch u.Scheme {
+	case "grpc+ssl", "https":
+		secure = true
+	case "grpc":
+	case "http":
+		port = "80"
+	case "grpc+unix":
+		if u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+			return Target{}, fmt.Errorf("%w '%s': expected an absolute socket path such as grpc+unix:///run/identity.sock", ErrInvalidEndpoint, endpoint)
+		}
+		return Target{HostPort: "unix://" + u.Path}, nil
+	default:
+		return Target{}, fmt.Errorf("%w '%s': the scheme must be grpc, grpc+ssl, grpc+unix, http or https", ErrInvalidEndpoint, endpoint)
+	}
+
+	if u.Hostname() == "" {
+		return Target{}, fmt.Errorf("%w '%s': missing host", ErrInvalidEndpoint, endpoint)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	return Target{HostPort: net.JoinHostPort(u.Hostname(), port), Secure: secure}, nil
+}
+
+// ExpandEndpointTemplate fills the {service} placeholder of an endpoint_template setting.
+// Underscores become hyphens since host names can't contain them.
+func ExpandEndpointTemplate(template, service string) string {
+	return strings.ReplaceAll(template, "{service}", strings.ReplaceAll(service, "_", "-"))
+}
+
+// ServiceOfEndpoint returns the service an endpoint such as grpc+ssl://inventory.api.example.com
+// is named after, i.e. the first label of its host, or "" for IPs and single-label hosts
+func ServiceOfEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+
+	host := u.Hostname()
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return ""
+	}
+	return host[:strings.Index(host, ".")]
+}
+
+// SiblingEndpoint returns the endpoint of service next to endpoint, by naming the first
+// label of the host after it, e.g. identity.api.example.com for inventory.api.example.com.
+// The scheme, port and path are kept.
+func SiblingEndpoint(endpoint, service string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w '%s': %v", ErrInvalidEndpoint, endpoint, err)
+	}
+	if ServiceOfEndpoint(endpoint) == "" {
+		return "", fmt.Errorf("the %s endpoint can't be derived from %s; set endpoint_template", service, endpoint)
+	}
+
+	host := u.Hostname()
+	host = strings.ReplaceAll(service, "_", "-") + host[strings.Index(host, "."):]
+	if u.Port() != "" {
+		host = net.JoinHostPort(host, u.Port())
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+// stripPath drops the path, such as /v1, of an endpoint
+func stripPath(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	u.Path, u.RawPath = "", ""
+	return u.String()
+}
+
+// Resolver finds the endpoint of each service of an environment. The endpoint list of the
+// identity service is the source of truth, unless the environment sets an endpoint_template
+// such as grpc+ssl://{service}.api.example.com:443.
+type Resolver struct {
+	name      string
+	env       Environment
+	endpoints map[string]string
+}
+
+// NewResolver creates a Resolver for the named environment
+func NewResolver(name string, env Environment) *Resolver {
+	return &Resolver{name: name, env: env}
+}
+
+// Resolve returns the target to dial for service. ctx bounds the lookup of the endpoint
+// list when it isn't cached.
+func (r *Resolver) Resolve(ctx context.Context, service string) (Target, error) {
+	if r.env.EndpointTemplate != "" {
+		endpoint := ExpandEndpointTemplate(r.env.EndpointTemplate, service)
+		rpc.Logf(rpc.LevelInfo, "endpoint of %s is %s, from endpoint_template", service, endpoint)
+		return ParseEndpoint(endpoint)
+	}
+
+	// A plaintext endpoint or a socket, such as a local server, serves every service itself
+	if strings.HasPrefix(r.env.Endpoint, "grpc://") || strings.HasPrefix(r.env.Endpoint, "grpc+unix://") {
+		return ParseEndpoint(r.env.Endpoint)
+	}
+
+	endpoints, err := r.Endpoints(ctx)
+	if err != nil {
+		return Target{}, err
+	}
+
+	endpoint, ok := endpoints[service]
+	if !ok {
+		return Target{}, fmt.Errorf("%w %s in the endpoint list of environment %s", ErrUnknownService, service, r.name)
+	}
+	rpc.Logf(rpc.LevelInfo, "endpoint of %s is %s", service, endpoint)
+	return ParseEndpoint(endpoint)
+}
+
+// Endpoints returns the endpoint of every service, from the cache of the environment while
+// it is fresh and from the identity service otherwise. The lookup uses the TLS and proxy
+// setting of the Resolver's environment.
+func (r *Resolver) Endpoints(ctx context.Context) (map[string]string, error) {
+	if r.endpoints != nil {
+		return r.endpoints, nil
+	}
+
+	if endpoints, err := LoadEndpointsCache(r.name); err == nil {
+		r.endpoints = endpoints
+		return endpoints, nil
+	}
+
+	source := r.env.Endpoint
+	if r.env.EndpointTemplate != "" {
+		source = ExpandEndpointTemplate(r.env.EndpointTemplate, "identity")
+	}
+
+	apiEndpoint, err := GetAPIEndpointEnvironment(ctx, r.env, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API endpoint: %v", err)
+	}
+
+	endpoints, err := FetchEndpointsMapEnvironment(ctx, r.env, apiEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch endpoints map: %v", err)
+	}
+
+	if err := SaveEndpointsCache(r.name, endpoints); err != nil {
+		rpc.Logf(rpc.LevelInfo, "failed to cache the endpoint list: %v", err)
+	}
+
+	r.endpoints = endpoints
+	return endpoints, nil
+}
+
+// endpointsCachePath returns the file caching the endpoint list of env
+func endpointsCachePath(env string) (string, error) {
+	if env == "" {
+		return "", fmt.Errorf("no environment set")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cfctl", "cache", env, "endpoints.yaml"), nil
+}
+
+// LoadEndpointsCache reads the cached endpoint list of env, failing once it is a day old
+func LoadEndpointsCache(env string) (map[string]string, error) {
+	cacheFile, err := endpointsCachePath(env)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheInfo, err := os.Stat(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(cacheInfo.ModTime()) > endpointsCacheTTL {
+		return nil, fmt.Errorf("cache expired")
+	}
+
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints map[string]string
+	if err := yaml.Unmarshal(data, &endpoints); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// SaveEndpointsCache caches the endpoint list of env
+func SaveEndpointsCache(env string, endpoints map[string]string) error {
+	cacheFile, err := endpointsCachePath(env)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(endpoints)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cacheFile, data, 0644)
+}
@@ -0,0 +1,459 @@
+package configs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     Target
+		wantErr  string
+	}{
+		{endpoint: "grpc://localhost:50051", want: Target{HostPort: "localhost:50051"}},
+		{endpoint: "grpc://identity.api.example.com", want: Target{HostPort: "identity.api.example.com:443"}},
+		{endpoint: "grpc+ssl://inventory.api.example.com:8443/v1", want: Target{HostPort: "inventory.api.example.com:8443", Secure: true}},
+		{endpoint: "grpc+ssl://inventory.api.example.com", want: Target{HostPort: "inventory.api.example.com:443", Secure: true}},
+		{endpoint: "grpc+ssl://[::1]", want: Target{HostPort: "[::1]:443", Secure: true}},
+		{endpoint: "grpc://[fd00::1]:50051", want: Target{HostPort: "[fd00::1]:50051"}},
+		{endpoint: "https://console.example.com", want: Target{HostPort: "console.example.com:443", Secure: true}},
+		{endpoint: "https://console.example.com:8443/api", want: Target{HostPort: "console.example.com:8443", Secure: true}},
+		{endpoint: "http://console.example.com", want: Target{HostPort: "console.example.com:80"}},
+		{endpoint: "http://10.0.0.5:8080", want: Target{HostPort: "10.0.0.5:8080"}},
+		{endpoint: "grpc+unix:///run/identity.sock", want: Target{HostPort: "unix:///run/identity.sock"}},
+		{endpoint: "grpc+unix:/tmp/cf.sock", want: Target{HostPort: "unix:///tmp/cf.sock"}},
+		{endpoint: "grpc+unix://run/identity.sock", wantErr: "expected an absolute socket path"},
+		{endpoint: "grpc+unix:relative.sock", wantErr: "expected an absolute socket path"},
+		{endpoint: "grpc+ssl://", wantErr: "missing host"},
+		{endpoint: "grpc://:50051", wantErr: "missing host"},
+		{endpoint: "ftp://files.example.com", wantErr: "the scheme must be"},
+		{endpoint: "identity.api.example.com", wantErr: "the scheme must be"},
+		{endpoint: "", wantErr: "the scheme must be"},
+		{endpoint: "grpc://[::1", wantErr: "missing ']'"},
+		{endpoint: "grpc://host name", wantErr: "invalid character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			got, err := ParseEndpoint(tt.endpoint)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidEndpoint) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseEndpoint(%q) error = %v, want an ErrInvalidEndpoint containing %q", tt.endpoint, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEndpoint(%q) error = %v", tt.endpoint, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseEndpoint(%q) = %+v, want %+v", tt.endpoint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetString(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"grpc://localhost:50051", "grpc://localhost:50051"},
+		{"grpc+ssl://inventory.api.example.com/v1", "grpc+ssl://inventory.api.example.com:443"},
+		{"https://console.example.com", "grpc+ssl://console.example.com:443"},
+		{"grpc+unix:///run/identity.sock", "grpc+unix:///run/identity.sock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			target, err := ParseEndpoint(tt.endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := target.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandEndpointTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		service  string
+		want     string
+	}{
+		{"grpc+ssl://{service}.api.example.com:443", "inventory", "grpc+ssl://inventory.api.example.com:443"},
+		{"grpc+ssl://{service}.api.example.com", "cost_analysis", "grpc+ssl://cost-analysis.api.example.com"},
+		{"grpc://10.0.0.5:50051", "identity", "grpc://10.0.0.5:50051"},
+		{"grpc+ssl://{service}.{service}.example.com", "board", "grpc+ssl://board.board.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			if got := ExpandEndpointTemplate(tt.template, tt.service); got != tt.want {
+				t.Errorf("ExpandEndpointTemplate(%q, %q) = %q, want %q", tt.template, tt.service, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceOfEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"grpc+ssl://inventory.api.example.com:443", "inventory"},
+		{"https://identity.api.example.com/v1", "identity"},
+		{"grpc://localhost:50051", ""},
+		{"grpc://10.0.0.5:50051", ""},
+		{"grpc+ssl://[::1]:443", ""},
+		{"grpc+unix:///run/identity.sock", ""},
+		{"grpc://[::1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			if got := ServiceOfEndpoint(tt.endpoint); got != tt.want {
+				t.Errorf("ServiceOfEndpoint(%q) = %q, want %q", tt.endpoint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSiblingEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		service  string
+		want     string
+		wantErr  string
+	}{
+		{endpoint: "grpc+ssl://inventory.api.example.com:443/v1", service: "identity", want: "grpc+ssl://identity.api.example.com:443/v1"},
+		{endpoint: "grpc://inventory.api.example.com", service: "cost_analysis", want: "grpc://cost-analysis.api.example.com"},
+		{endpoint: "grpc://10.0.0.5:50051", service: "identity", wantErr: "set endpoint_template"},
+		{endpoint: "grpc://localhost:50051", service: "identity", wantErr: "set endpoint_template"},
+		{endpoint: "grpc://[::1", service: "identity", wantErr: "invalid endpoint"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			got, err := SiblingEndpoint(tt.endpoint, tt.service)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SiblingEndpoint(%q) error = %v, want one containing %q", tt.endpoint, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SiblingEndpoint(%q) error = %v", tt.endpoint, err)
+			}
+			if got != tt.want {
+				t.Errorf("SiblingEndpoint(%q, %q) = %q, want %q", tt.endpoint, tt.service, got, tt.want)
+			}
+		})
+	}
+}
+
+// useHome points the home directory, and with it setting.yaml and the endpoint cache, at
+// an empty directory
+func useHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return home
+}
+
+func TestResolverWithoutDiscovery(t *testing.T) {
+	useHome(t)
+
+	tests := []struct {
+		name    string
+		env     Environment
+		service string
+		want    Target
+		wantErr string
+	}{
+		{
+			name:    "endpoint template",
+			env:     Environment{Endpoint: "https://console.example.com", EndpointTemplate: "grpc+ssl://{service}.api.example.com:443"},
+			service: "inventory",
+			want:    Target{HostPort: "inventory.api.example.com:443", Secure: true},
+		},
+		{
+			name:    "endpoint template with underscores",
+			env:     Environment{EndpointTemplate: "grpc+ssl://{service}.api.example.com"},
+			service: "cost_analysis",
+			want:    Target{HostPort: "cost-analysis.api.example.com:443", Secure: true},
+		},
+		{
+			name:    "endpoint template without placeholder",
+			env:     Environment{EndpointTemplate: "grpc://10.0.0.5:50051"},
+			service: "identity",
+			want:    Target{HostPort: "10.0.0.5:50051"},
+		},
+		{
+			name:    "malformed endpoint template",
+			env:     Environment{EndpointTemplate: "{service}.api.example.com:443"},
+			service: "inventory",
+			wantErr: "the scheme must be",
+		},
+		{
+			name:    "plaintext endpoint serves every service",
+			env:     Environment{Endpoint: "grpc://localhost:50051"},
+			service: "inventory",
+			want:    Target{HostPort: "localhost:50051"},
+		},
+		{
+			name:    "plaintext endpoint without port",
+			env:     Environment{Endpoint: "grpc://identity.dev.example.com"},
+			service: "identity",
+			want:    Target{HostPort: "identity.dev.example.com:443"},
+		},
+		{
+			name:    "socket serves every service",
+			env:     Environment{Endpoint: "grpc+unix:///run/cloudforet.sock"},
+			service: "repository",
+			want:    Target{HostPort: "unix:///run/cloudforet.sock"},
+		},
+		{
+			name:    "malformed socket",
+			env:     Environment{Endpoint: "grpc+unix://run/cloudforet.sock"},
+			service: "repository",
+			wantErr: "expected an absolute socket path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewResolver("test", tt.env).Resolve(context.Background(), tt.service)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidEndpoint) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve(%q) error = %v, want an ErrInvalidEndpoint containing %q", tt.service, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) error = %v", tt.service, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %+v, want %+v", tt.service, got, tt.want)
+			}
+		})
+	}
+}
+
+// startConsole serves the console config and the endpoint list of the console API over
+// TLS, and trusts its certificate in the setting of environment test
+func startConsole(t *testing.T, endpoints map[string]string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var lists atomic.Int32
+
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/config/production.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"CONSOLE_API_V2": {"ENDPOINT": "%s/api/"}}`, server.URL)
+	})
+	mux.HandleFunc("/api/identity/endpoint/list", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		lists.Add(1)
+
+		var results []map[string]string
+		for service, endpoint := range endpoints {
+			results = append(results, map[string]string{"service": service, "endpoint": endpoint})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	})
+
+	home := useHome(t)
+	caFile := filepath.Join(home, "console.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeSetting(t, server.URL, caFile)
+
+	return server, &lists
+}
+
+// writeSetting makes environment test, with endpoint and tls.ca_file, the current one
+func writeSetting(t *testing.T, endpoint, caFile string) {
+	t.Helper()
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setting := fmt.Sprintf("environment: test\nenvironments:\n  test:\n    endpoint: %s\n    tls:\n      ca_file: %s\n", endpoint, caFile)
+	if err := os.MkdirAll(filepath.Join(home, ".cfctl"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".cfctl", "setting.yaml"), []byte(setting), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeUnrelatedCA writes a CA certificate that signed nothing the tests serve
+func writeUnrelatedCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "unrelated test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "unrelated.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return caFile
+}
+
+func TestResolverConsole(t *testing.T) {
+	endpoints := map[string]string{
+		"inventory":  "grpc+ssl://inventory.api.example.com:443/v1",
+		"repository": "grpc+ssl://repository.api.example.com",
+	}
+
+	tests := []struct {
+		name   string
+		scheme string
+	}{
+		{"https console", "https://"},
+		{"http console", "http://"},
+		{"console without scheme", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, lists := startConsole(t, endpoints)
+			env := CurrentEnvironment()
+			env.Endpoint = tt.scheme + strings.TrimPrefix(server.URL, "https://")
+
+			resolver := NewResolver("test", env)
+			got, err := resolver.Resolve(context.Background(), "inventory")
+			if err != nil {
+				t.Fatalf("Resolve(inventory) error = %v", err)
+			}
+			if want := (Target{HostPort: "inventory.api.example.com:443", Secure: true}); got != want {
+				t.Errorf("Resolve(inventory) = %+v, want %+v", got, want)
+			}
+
+			if _, err := resolver.Resolve(context.Background(), "monitoring"); !errors.Is(err, ErrUnknownService) {
+				t.Errorf("Resolve(monitoring) error = %v, want ErrUnknownService", err)
+			}
+
+			// A new resolver reads the endpoint list cached by the first one
+			cached, err := NewResolver("test", env).Endpoints(context.Background())
+			if err != nil {
+				t.Fatalf("Endpoints() error = %v", err)
+			}
+			if !reflect.DeepEqual(cached, endpoints) {
+				t.Errorf("Endpoints() = %v, want %v", cached, endpoints)
+			}
+			if n := lists.Load(); n != 2 {
+				t.Errorf("the endpoint list was fetched %d times, want 2 (identity lookup and list)", n)
+			}
+		})
+	}
+}
+
+func TestResolverConsoleUntrusted(t *testing.T) {
+	server, _ := startConsole(t, map[string]string{})
+
+	// Without the CA of the console, discovery fails rather than skipping verification
+	_, err := NewResolver("test", Environment{Endpoint: server.URL}).Resolve(context.Background(), "inventory")
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("Resolve() error = %v, want a certificate error", err)
+	}
+}
+
+func TestResolverUsesItsEnvironment(t *testing.T) {
+	endpoints := map[string]string{"inventory": "grpc+ssl://inventory.api.example.com:443"}
+	unrelatedCA := writeUnrelatedCA(t)
+
+	t.Run("target trusts the console, current does not", func(t *testing.T) {
+		server, lists := startConsole(t, endpoints)
+		env := Environment{Endpoint: server.URL, TLS: CurrentEnvironment().TLS}
+		writeSetting(t, server.URL, unrelatedCA)
+
+		if _, err := NewResolver("target", env).Resolve(context.Background(), "inventory"); err != nil {
+			t.Fatalf("Resolve() error = %v, want the CA of the target environment to apply", err)
+		}
+		if n := lists.Load(); n != 2 {
+			t.Errorf("the endpoint list was fetched %d times, want 2", n)
+		}
+	})
+
+	t.Run("current trusts the console, target does not", func(t *testing.T) {
+		server, lists := startConsole(t, endpoints)
+		env := Environment{Endpoint: server.URL, TLS: TLSConfig{CAFile: unrelatedCA}}
+
+		_, err := NewResolver("target", env).Resolve(context.Background(), "inventory")
+		if err == nil || !strings.Contains(err.Error(), "certificate") {
+			t.Fatalf("Resolve() error = %v, want a certificate error", err)
+		}
+		if n := lists.Load(); n != 0 {
+			t.Errorf("the endpoint list was fetched %d times, want none", n)
+		}
+	})
+}
+
+func TestResolverHonorsContext(t *testing.T) {
+	useHome(t)
+
+	// The console accepts the connection and never answers
+	hang := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(hang) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	env := Environment{Endpoint: server.URL, TLS: TLSConfig{InsecureSkipVerify: true}}
+	start := time.Now()
+	_, err := NewResolver("test", env).Resolve(ctx, "inventory")
+	if err == nil {
+		t.Fatal("Resolve() succeeded against a console that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Resolve() returned after %s, want it bounded by the context", elapsed)
+	}
+}
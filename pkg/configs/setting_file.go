@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/spf13/viper"
 )
 
@@ -17,9 +18,27 @@ type Environments struct {
 
 // Environment represents a single environment configuration
 type Environment struct {
-	Endpoint string `yaml:"endpoint"` // gRPC or HTTP endpoint URL
-	Proxy    string `yaml:"proxy"`    // Proxy server address if required
-	Token    string `yaml:"token"`    // Authentication token
+	Endpoint         string      `yaml:"endpoint"`          // gRPC or HTTP endpoint URL
+	EndpointTemplate string      `yaml:"endpoint_template"` // Endpoint of every service, e.g. grpc+ssl://{service}.api.example.com:443
+	Proxy            string      `yaml:"proxy"`             // Whether the endpoint is the identity proxy; not a network proxy
+	Token            string      `yaml:"token"`             // Authentication token
+	Timeout          string      `yaml:"timeout"`           // Default time limit of each request, e.g. 30s
+	Retry            RetryConfig `yaml:"retry"`             // Retry policy for transient failures
+	TLS              TLSConfig   `yaml:"tls"`               // CA bundle, client certificate and verification of grpc+ssl:// endpoints
+	NetworkProxy     string      `yaml:"network_proxy"`     // Proxy for every connection, e.g. socks5://127.0.0.1:1080
+	Authority        string      `yaml:"authority"`         // Host name sent to the server, e.g. identity.api.example.com when dialing an IP
+	MaxRecvSize      string      `yaml:"max_recv_size"`     // Largest response message accepted, e.g. 64MB
+	MaxSendSize      string      `yaml:"max_send_size"`     // Largest request message sent, e.g. 16MB
+	Compression      string      `yaml:"compression"`       // Compressor for requests, e.g. gzip; none by default
+	Transport        string      `yaml:"transport"`         // grpc (default), rest through the console API, or auto
+}
+
+// RetryConfig controls how calls that fail with a transient error are retried
+type RetryConfig struct {
+	MaxAttempts    int      `yaml:"max_attempts"`    // Total attempts including the first
+	InitialBackoff string   `yaml:"initial_backoff"` // Wait before the first retry, e.g. 200ms
+	MaxBackoff     string   `yaml:"max_backoff"`     // Upper bound of the growing wait, e.g. 5s
+	Codes          []string `yaml:"codes"`           // gRPC status codes to retry, e.g. UNAVAILABLE
 }
 
 // SetSettingFile loads the setting from the default location (~/.cfctl/setting.yaml)
@@ -39,6 +58,9 @@ func SetSettingFile() (*Environments, error) {
 		return nil, err
 	}
 
+	rpc.Logf(rpc.LevelInfo, "using environment %s from %s: endpoint %s, token set: %v",
+		currentEnvName.Environment, settingPath, currentEnvValues.Endpoint, currentEnvValues.Token != "")
+
 	return &Environments{
 		Environment: currentEnvName.Environment,
 		Environments: map[string]Environment{
@@ -85,8 +107,23 @@ func getCurrentEnvValues(env string) (*Environment, error) {
 	}
 
 	envSetting := &Environment{
-		Endpoint: v.GetString(fmt.Sprintf("environments.%s.endpoint", env)),
-		Proxy:    v.GetString(fmt.Sprintf("environments.%s.proxy", env)),
+		Endpoint:         v.GetString(fmt.Sprintf("environments.%s.endpoint", env)),
+		EndpointTemplate: v.GetString(fmt.Sprintf("environments.%s.endpoint_template", env)),
+		Proxy:            v.GetString(fmt.Sprintf("environments.%s.proxy", env)),
+		Timeout:          v.GetString(fmt.Sprintf("environments.%s.timeout", env)),
+		Retry: RetryConfig{
+			MaxAttempts:    v.GetInt(fmt.Sprintf("environments.%s.retry.max_attempts", env)),
+			InitialBackoff: v.GetString(fmt.Sprintf("environments.%s.retry.initial_backoff", env)),
+			MaxBackoff:     v.GetString(fmt.Sprintf("environments.%s.retry.max_backoff", env)),
+			Codes:          v.GetStringSlice(fmt.Sprintf("environments.%s.retry.codes", env)),
+		},
+		TLS:          tlsConfigOf(env, v),
+		NetworkProxy: v.GetString(fmt.Sprintf("environments.%s.network_proxy", env)),
+		Authority:    v.GetString(fmt.Sprintf("environments.%s.authority", env)),
+		MaxRecvSize:  v.GetString(fmt.Sprintf("environments.%s.max_recv_size", env)),
+		MaxSendSize:  v.GetString(fmt.Sprintf("environments.%s.max_send_size", env)),
+		Compression:  v.GetString(fmt.Sprintf("environments.%s.compression", env)),
+		Transport:    v.GetString(fmt.Sprintf("environments.%s.transport", env)),
 	}
 
 	if err := loadToken(env, envSetting); err != nil {
@@ -96,6 +133,17 @@ func getCurrentEnvValues(env string) (*Environment, error) {
 	return envSetting, nil
 }
 
+// tlsConfigOf reads the tls setting of env
+func tlsConfigOf(env string, v *viper.Viper) TLSConfig {
+	return TLSConfig{
+		CAFile:             v.GetString(fmt.Sprintf("environments.%s.tls.ca_file", env)),
+		CertFile:           v.GetString(fmt.Sprintf("environments.%s.tls.cert_file", env)),
+		KeyFile:            v.GetString(fmt.Sprintf("environments.%s.tls.key_file", env)),
+		ServerName:         v.GetString(fmt.Sprintf("environments.%s.tls.server_name", env)),
+		InsecureSkipVerify: v.GetBool(fmt.Sprintf("environments.%s.tls.insecure_skip_verify", env)),
+	}
+}
+
 // loadToken loads the appropriate token based on environment type
 func loadToken(env string, envSetting *Environment) error {
 	if strings.HasSuffix(env, "-user") {
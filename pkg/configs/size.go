@@ -0,0 +1,42 @@
+package configs
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// byteUnits are the suffixes ParseByteSize accepts, in powers of 1024
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize reads a size such as 64MB, 512KiB or 1048576. Units are powers of 1024.
+func ParseByteSize(value string) (int, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(n > 0) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size '%s': expected a positive number of bytes such as 64MB", value)
+	}
+
+	size := n * float64(unit)
+	if size > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid size '%s': the largest message gRPC allows is 2GB", value)
+	}
+	return int(size), nil
+}
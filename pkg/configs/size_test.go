@@ -0,0 +1,48 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr string
+	}{
+		{value: "1048576", want: 1 << 20},
+		{value: "512B", want: 512},
+		{value: "64MB", want: 64 << 20},
+		{value: "64mb", want: 64 << 20},
+		{value: "64M", want: 64 << 20},
+		{value: "512KiB", want: 512 << 10},
+		{value: " 1 GiB ", want: 1 << 30},
+		{value: "1.5K", want: 1536},
+		{value: "", wantErr: "expected a positive number"},
+		{value: "MB", wantErr: "expected a positive number"},
+		{value: "0", wantErr: "expected a positive number"},
+		{value: "-1MB", wantErr: "expected a positive number"},
+		{value: "NaN", wantErr: "expected a positive number"},
+		{value: "10TB", wantErr: "expected a positive number"},
+		{value: "2GB", wantErr: "the largest message gRPC allows is 2GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseByteSize(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseByteSize(%q) error = %v, want one containing %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseByteSize(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseByteSize(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+// Printer renders a response for the output formats that take an argument
+type Printer interface {
+	Print(data interface{}) (string, error)
+}
+
+// NewPrinter returns the Printer for an -o value of the form template=<text>,
+// template-file=<path> or custom-columns=<HEADER>:<path>,... ok is false for the
+// built-in formats such as yaml or table, which need no Printer.
+func NewPrinter(outputFormat string) (printer Printer, ok bool, err error) {
+	name, arg, _ := strings.Cut(outputFormat, "=")
+
+	switch name {
+	case "template", "go-template":
+		printer, err = newTemplatePrinter("template", arg)
+	case "template-file", "go-template-file":
+		text, readErr := os.ReadFile(arg)
+		if readErr != nil {
+			return nil, true, fmt.Errorf("failed to read template file: %v", readErr)
+		}
+		printer, err = newTemplatePrinter(arg, string(text))
+	case "custom-columns":
+		printer, err = newColumnsPrinter(arg)
+	default:
+		return nil, false, nil
+	}
+
+	return printer, true, err
+}
+
+type templatePrinter struct {
+	tmpl *template.Template
+}
+
+func newTemplatePrinter(name, text string) (*templatePrinter, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("template is empty: use -o template='{{range .results}}{{.name}}{{\"\\n\"}}{{end}}'")
+	}
+
+	funcs := template.FuncMap{
+		"get": func(data interface{}, path string) interface{} {
+			v, _ := LookupPath(data, path)
+			if v == nil {
+				return ""
+			}
+			return v
+		},
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join": func(sep string, v interface{}) string {
+			items, ok := v.([]interface{})
+			if !ok {
+				return FormatValue(v)
+			}
+			parts := make([]string, len(items))
+			for i, item := range items {
+				parts[i] = FormatValue(item)
+			}
+			return strings.Join(parts, sep)
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+
+	return &templatePrinter{tmpl: tmpl}, nil
+}
+
+func (p *templatePrinter) Print(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, normalize(data)); err != nil {
+		return "", fmt.Errorf("failed to execute template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+type column struct {
+	header string
+	path   string
+}
+
+type columnsPrinter struct {
+	columns []column
+}
+
+func newColumnsPrinter(spec string) (*columnsPrinter, error) {
+	var columns []column
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		header, path, ok := strings.Cut(part, ":")
+		if !ok || header == "" || path == "" {
+			return nil, fmt.Errorf("invalid custom column '%s': expected <HEADER>:<path>, e.g. NAME:.name", part)
+		}
+		columns = append(columns, column{header: header, path: path})
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("custom-columns needs at least one column, e.g. -o custom-columns=NAME:.name,STATE:.state")
+	}
+
+	return &columnsPrinter{columns: columns}, nil
+}
+
+// Print writes one row per item of data's results, or a single row for other responses
+func (p *columnsPrinter) Print(data interface{}) (string, error) {
+	var rows []interface{}
+	switch v := data.(type) {
+	case []interface{}:
+		rows = v
+	case map[string]interface{}:
+		if results, ok := v["results"].([]interface{}); ok {
+			rows = results
+		} else {
+			rows = []interface{}{v}
+		}
+	default:
+		rows = []interface{}{v}
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0)
+
+	headers := make([]string, len(p.columns))
+	for i, col := range p.columns {
+		headers[i] = col.header
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+
+	for _, row := range rows {
+		cells := make([]string, len(p.columns))
+		for i, col := range p.columns {
+			v, ok := LookupPath(row, col.path)
+			if !ok || v == nil {
+				cells[i] = "<none>"
+			} else {
+				cells[i] = FormatValue(v)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// LookupPath resolves a dot-path such as .data.region_code or tags[0] in data.
+// Each key also matches its lowerCamelCase form, since responses are keyed that way.
+func LookupPath(data interface{}, path string) (interface{}, bool) {
+	current := data
+	path = strings.TrimPrefix(strings.TrimSpace(path), ".")
+	if path == "" {
+		return current, true
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		key, indexes := part, ""
+		if idx := strings.Index(part, "["); idx >= 0 {
+			key, indexes = part[:idx], part[idx:]
+		}
+
+		if key != "" {
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			v, ok := m[key]
+			if !ok {
+				if v, ok = m[ToLowerCamel(key)]; !ok {
+					return nil, false
+				}
+			}
+			current = v
+		}
+
+		for indexes != "" {
+			end := strings.Index(indexes, "]")
+			if !strings.HasPrefix(indexes, "[") || end < 0 {
+				return nil, false
+			}
+			n, err := strconv.Atoi(indexes[1:end])
+			if err != nil {
+				return nil, false
+			}
+			items, ok := current.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			if n < 0 {
+				n += len(items)
+			}
+			if n < 0 || n >= len(items) {
+				return nil, false
+			}
+			current = items[n]
+			indexes = indexes[end+1:]
+		}
+	}
+
+	return current, true
+}
+
+// ToLowerCamel converts a snake_case field name to the lowerCamelCase key used in responses
+func ToLowerCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// FormatValue renders a value as plain text: strings as-is, objects and lists as JSON
+func FormatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Flatten turns nested objects into dot-path keys, e.g. {"data": {"region": "x"}} becomes
+// {"data.region": "x"}. Lists and empty objects are kept as values.
+func Flatten(item map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(item))
+
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+				walk(key, nested)
+				continue
+			}
+			flat[key] = v
+		}
+	}
+	walk("", item)
+
+	return flat
+}
@@ -0,0 +1,247 @@
+package format
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeInto parses the JSON input of a test case into v
+func decodeInto(t *testing.T, src string, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(src), v); err != nil {
+		t.Fatalf("bad test input %s: %v", src, err)
+	}
+}
+
+func TestNewPrinter(t *testing.T) {
+	tests := []struct {
+		output  string
+		wantOK  bool
+		wantErr string
+	}{
+		{output: "yaml"},
+		{output: "table"},
+		{output: "csv"},
+		{output: "template={{.name}}", wantOK: true},
+		{output: "go-template={{.name}}", wantOK: true},
+		{output: "template=", wantOK: true, wantErr: "template is empty"},
+		{output: "template={{.name", wantOK: true, wantErr: "invalid template"},
+		{output: "template-file=/nonexistent/cfctl.tmpl", wantOK: true, wantErr: "failed to read template file"},
+		{output: "custom-columns=NAME:.name,STATE:.state", wantOK: true},
+		{output: "custom-columns=", wantOK: true, wantErr: "needs at least one column"},
+		{output: "custom-columns=NAME", wantOK: true, wantErr: "expected <HEADER>:<path>"},
+		{output: "custom-columns=:.name", wantOK: true, wantErr: "expected <HEADER>:<path>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			printer, ok, err := NewPrinter(tt.output)
+			if ok != tt.wantOK {
+				t.Errorf("NewPrinter(%q) ok = %v, want %v", tt.output, ok, tt.wantOK)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewPrinter(%q) error = %v, want one containing %q", tt.output, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewPrinter(%q) error = %v", tt.output, err)
+			}
+			if (printer != nil) != tt.wantOK {
+				t.Errorf("NewPrinter(%q) printer = %v, want one only for formats with an argument", tt.output, printer)
+			}
+		})
+	}
+}
+
+func TestColumnsPrinter(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		data string
+		want []string // Lines with their columns separated by single spaces
+	}{
+		{
+			name: "list",
+			spec: "NAME:.name,SIZE:.size",
+			data: queryTestData,
+			want: []string{"NAME SIZE", "web-1 3", "web-2 1", "db-1 8"},
+		},
+		{
+			name: "nested and indexed paths",
+			spec: "NAME:.name,ENV:.tags.env,ZONE:.zones[0]",
+			data: queryTestData,
+			want: []string{"NAME ENV ZONE", "web-1 prod a", "web-2 dev <none>", "db-1 <none> c"},
+		},
+		{
+			name: "snake_case path on a camelCase response",
+			spec: "ID:.server_id,REGION:.data.region_code",
+			data: `{"serverId": "server-1", "data": {"regionCode": "us-east-1"}}`,
+			want: []string{"ID REGION", "server-1 us-east-1"},
+		},
+		{
+			name: "objects and lists as JSON",
+			spec: "TAGS:.tags,ZONES:.zones",
+			data: `{"results": [{"tags": {"env": "prod"}, "zones": ["a", "b"]}]}`,
+			want: []string{`TAGS ZONES`, `{"env":"prod"} ["a","b"]`},
+		},
+		{
+			name: "no results",
+			spec: "NAME:.name",
+			data: `{"results": []}`,
+			want: []string{"NAME"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			printer, err := newColumnsPrinter(tt.spec)
+			if err != nil {
+				t.Fatalf("newColumnsPrinter(%q) error = %v", tt.spec, err)
+			}
+
+			var data interface{}
+			decodeInto(t, tt.data, &data)
+			out, err := printer.Print(data)
+			if err != nil {
+				t.Fatalf("Print() error = %v", err)
+			}
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+				got = append(got, strings.Join(strings.Fields(line), " "))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Print() =\n%s\nwant rows %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatePrinter(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{name: "range", template: `{{range .results}}{{.name}} {{end}}`, want: "web-1 web-2 db-1 "},
+		{name: "whole numbers", template: `{{.total_count}}`, want: "3"},
+		{name: "get", template: `{{range .results}}{{get . "tags.env"}},{{end}}`, want: "prod,dev,,"},
+		{name: "join", template: `{{range .results}}{{join "+" .zones}};{{end}}`, want: "a+b;;c;"},
+		{name: "json", template: `{{json (index .results 0).tags}}`, want: `{"env":"prod"}`},
+		{name: "upper", template: `{{upper (index .results 1).state}}`, want: "DELETED"},
+		{name: "missing function", template: `{{nope .}}`, wantErr: "invalid template"},
+		{name: "failing call", template: `{{index .results 5}}`, wantErr: "failed to execute template"},
+	}
+
+	data := queryTestInput(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			printer, err := newTemplatePrinter("test", tt.template)
+			if err == nil {
+				var out string
+				out, err = printer.Print(data)
+				if err == nil && out != tt.want {
+					t.Errorf("Print() = %q, want %q", out, tt.want)
+				}
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		name string
+		val  interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"string", "a,b", "a,b"},
+		{"whole number", float64(1700000000), "1700000000"},
+		{"fraction", 2.5, "2.5"},
+		{"bool", true, "true"},
+		{"int", 42, "42"},
+		{"object", map[string]interface{}{"b": 1.0, "a": "x"}, `{"a":"x","b":1}`},
+		{"list", []interface{}{"a", 1.0}, `["a",1]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatValue(tt.val); got != tt.want {
+				t.Errorf("FormatValue(%#v) = %q, want %q", tt.val, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		name string
+		item string
+		want map[string]interface{}
+	}{
+		{
+			name: "flat",
+			item: `{"name": "web-1", "size": 3}`,
+			want: map[string]interface{}{"name": "web-1", "size": 3.0},
+		},
+		{
+			name: "nested",
+			item: `{"data": {"region": "x", "spec": {"cpu": 2}}}`,
+			want: map[string]interface{}{"data.region": "x", "data.spec.cpu": 2.0},
+		},
+		{
+			name: "lists and empty objects kept",
+			item: `{"zones": ["a"], "tags": {}}`,
+			want: map[string]interface{}{"zones": []interface{}{"a"}, "tags": map[string]interface{}{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var item map[string]interface{}
+			decodeInto(t, tt.item, &item)
+			if got := Flatten(item); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Flatten(%s) = %v, want %v", tt.item, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   interface{}
+		wantOK bool
+	}{
+		{path: ".total_count", want: 3.0, wantOK: true},
+		{path: "results[0].name", want: "web-1", wantOK: true},
+		{path: ".results[-1].zones[0]", want: "c", wantOK: true},
+		{path: ".results[1].tags.env", want: "dev", wantOK: true},
+		{path: ".results[3]"},
+		{path: ".results[x]"},
+		{path: ".results.name"},
+		{path: ".missing"},
+	}
+
+	data := queryTestInput(t)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := LookupPath(data, tt.path)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LookupPath(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
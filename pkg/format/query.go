@@ -0,0 +1,490 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// Query is a compiled --query expression. Expressions starting with '$' are JSONPath,
+// anything else is jq, as implemented by gojq: paths, pipes, select, map, reduce, as
+// $var bindings, string interpolation and the standard builtins. The response is the
+// only input, so input and inputs are rejected, and env is empty.
+type Query struct {
+	expr string
+	code *gojq.Code
+}
+
+// CompileQuery parses a JSONPath or jq expression
+func CompileQuery(expr string) (*Query, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	source := expr
+	if strings.HasPrefix(expr, "$") {
+		var err error
+		if source, err = jsonPathToJQ(expr); err != nil {
+			return nil, fmt.Errorf("invalid query '%s': %v", expr, err)
+		}
+	}
+
+	parsed, err := gojq.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query '%s': %v", expr, err)
+	}
+
+	code, err := gojq.Compile(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query '%s': %v", expr, err)
+	}
+
+	return &Query{expr: expr, code: code}, nil
+}
+
+// Run evaluates the query and returns every value it produces
+func (q *Query) Run(data interface{}) ([]interface{}, error) {
+	var outputs []interface{}
+
+	iter := q.code.Run(normalize(data))
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			if halt, ok := err.(*gojq.HaltError); ok && halt.Value() == nil {
+				break
+			}
+			return nil, fmt.Errorf("query '%s' failed: %v", q.expr, err)
+		}
+		outputs = append(outputs, plainNumbers(v))
+	}
+
+	return outputs, nil
+}
+
+// Apply evaluates the query and returns a single value: the only output, or a list
+// when the query produced zero or several outputs
+func (q *Query) Apply(data interface{}) (interface{}, error) {
+	outputs, err := q.Run(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) == 1 {
+		return outputs[0], nil
+	}
+	if outputs == nil {
+		outputs = []interface{}{}
+	}
+	return outputs, nil
+}
+
+// normalize converts data into plain JSON values so that numbers are float64 everywhere
+func normalize(data interface{}) interface{} {
+	switch data.(type) {
+	case nil, bool, float64, string:
+		return data
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return data
+	}
+	return out
+}
+
+// plainNumbers turns the int and big.Int results of jq arithmetic into float64, like every
+// other number the printers see
+func plainNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(x).Float64()
+		return f
+	case []interface{}:
+		for i, item := range x {
+			x[i] = plainNumbers(item)
+		}
+	case map[string]interface{}:
+		for key, item := range x {
+			x[key] = plainNumbers(item)
+		}
+	}
+	return v
+}
+
+// jsonPathMember is the jq function JSONPath members compile to: unlike .name, it yields
+// nothing when the input is not an object or lacks the member
+const jsonPathMember = `def _jsonpath_member($k): if type == "object" and has($k) then .[$k] else empty end; `
+
+// jsonPathToJQ translates a JSONPath expression into jq. It supports $, .name, ['name'],
+// [n], [*], .*, ..name, [start:end], [a,b] and [?(@.k op v)] filters combined with &&, ||
+// and !.
+func jsonPathToJQ(expr string) (string, error) {
+	tokens, err := tokenizeJSONPath(expr)
+	if err != nil {
+		return "", err
+	}
+
+	p := &jsonPathParser{tokens: tokens}
+	if !p.accept("$") {
+		return "", p.errorf("JSONPath must start with '$'")
+	}
+
+	path, err := p.segments(false)
+	if err != nil {
+		return "", err
+	}
+	if p.peek().kind != jpEOF {
+		return "", p.errorf("unexpected '%s'", p.peek().text)
+	}
+
+	return jsonPathMember + "." + path, nil
+}
+
+type jsonPathKind int
+
+const (
+	jpEOF jsonPathKind = iota
+	jpPunct
+	jpName
+	jpString
+	jpNumber
+)
+
+type jsonPathToken struct {
+	kind jsonPathKind
+	text string
+	pos  int
+}
+
+// jsonPathPuncts are the punctuation tokens of JSONPath, longest first
+var jsonPathPuncts = []string{"..", "==", "!=", "<=", ">=", "&&", "||", "$", "@", ".", "[", "]", "(", ")", "*", ",", ":", "?", "<", ">", "!", "-"}
+
+func tokenizeJSONPath(src string) ([]jsonPathToken, error) {
+	var tokens []jsonPathToken
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+
+		case c == '\'' || c == '"':
+			end := i + 1
+			var b strings.Builder
+			for ; end < len(src) && src[end] != c; end++ {
+				if src[end] == '\\' && end+1 < len(src) {
+					end++
+				}
+				b.WriteByte(src[end])
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, jsonPathToken{kind: jpString, text: b.String(), pos: i})
+			i = end + 1
+
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(src) && (src[end] >= '0' && src[end] <= '9' || src[end] == '.' && end+1 < len(src) && src[end+1] >= '0' && src[end+1] <= '9') {
+				end++
+			}
+			tokens = append(tokens, jsonPathToken{kind: jpNumber, text: src[i:end], pos: i})
+			i = end
+
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			end := i
+			for end < len(src) && (src[end] == '_' || src[end] == '-' || src[end] >= 'a' && src[end] <= 'z' ||
+				src[end] >= 'A' && src[end] <= 'Z' || src[end] >= '0' && src[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, jsonPathToken{kind: jpName, text: src[i:end], pos: i})
+			i = end
+
+		default:
+			matched := false
+			for _, punct := range jsonPathPuncts {
+				if strings.HasPrefix(src[i:], punct) {
+					tokens = append(tokens, jsonPathToken{kind: jpPunct, text: punct, pos: i})
+					i += len(punct)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected '%c' at position %d", c, i)
+			}
+		}
+	}
+
+	return append(tokens, jsonPathToken{kind: jpEOF, pos: len(src)}), nil
+}
+
+type jsonPathParser struct {
+	tokens []jsonPathToken
+	pos    int
+}
+
+func (p *jsonPathParser) peek() jsonPathToken {
+	return p.tokens[p.pos]
+}
+
+func (p *jsonPathParser) next() jsonPathToken {
+	t := p.tokens[p.pos]
+	if t.kind != jpEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *jsonPathParser) is(punct string) bool {
+	t := p.peek()
+	return t.kind == jpPunct && t.text == punct
+}
+
+func (p *jsonPathParser) accept(punct string) bool {
+	if p.is(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *jsonPathParser) expect(punct string) error {
+	if !p.accept(punct) {
+		return p.errorf("expected '%s'", punct)
+	}
+	return nil
+}
+
+func (p *jsonPathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+// segments translates the path segments that follow $ or @ into a jq pipeline applied
+// to '.'. In filters, paths that can't be followed yield nothing rather than failing.
+func (p *jsonPathParser) segments(inFilter bool) (string, error) {
+	var parts []string
+
+	for {
+		var part string
+		var err error
+		switch {
+		case p.accept(".."):
+			part, err = p.member()
+			part = "(.. | try (" + part + "))"
+		case p.accept("."):
+			part, err = p.member()
+		case p.accept("["):
+			part, err = p.bracket()
+		default:
+			path := strings.Join(parts, " | ")
+			switch {
+			case path == "":
+				return "", nil
+			case inFilter:
+				return " | try (" + path + ")", nil
+			}
+			return " | " + path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+}
+
+func (p *jsonPathParser) member() (string, error) {
+	t := p.peek()
+	switch {
+	case p.accept("*"):
+		return ".[]?", nil
+	case t.kind == jpName || t.kind == jpString:
+		p.next()
+		return "_jsonpath_member(" + strconv.Quote(t.text) + ")", nil
+	case p.accept("["):
+		return p.bracket()
+	}
+	return "", p.errorf("expected member name")
+}
+
+func (p *jsonPathParser) bracket() (string, error) {
+	switch {
+	case p.accept("*"):
+		return ".[]?", p.expect("]")
+
+	case p.accept("?"):
+		if err := p.expect("("); err != nil {
+			return "", err
+		}
+		cond, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(")"); err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		return ".[]? | select(" + cond + ")", nil
+	}
+
+	var selectors []string
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == jpString:
+			p.next()
+			selectors = append(selectors, "_jsonpath_member("+strconv.Quote(t.text)+")")
+
+		case t.kind == jpNumber || p.is("-") || p.is(":"):
+			from, err := p.optionalNumber()
+			if err != nil {
+				return "", err
+			}
+			if !p.accept(":") {
+				if from == "" {
+					return "", p.errorf("expected number")
+				}
+				selectors = append(selectors, ".["+from+"]")
+				break
+			}
+			to, err := p.optionalNumber()
+			if err != nil {
+				return "", err
+			}
+			selectors = append(selectors, "(.["+from+":"+to+"] | .[])")
+
+		default:
+			return "", p.errorf("unsupported JSONPath selector")
+		}
+
+		if p.accept("]") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return "", err
+		}
+	}
+
+	if len(selectors) == 1 {
+		return selectors[0], nil
+	}
+	return "(" + strings.Join(selectors, ", ") + ")", nil
+}
+
+// optionalNumber reads an optional, possibly negative, integer of an index or slice
+func (p *jsonPathParser) optionalNumber() (string, error) {
+	negative := p.accept("-")
+	if p.peek().kind != jpNumber {
+		if negative {
+			return "", p.errorf("expected number")
+		}
+		return "", nil
+	}
+	number := p.next().text
+	if negative {
+		number = "-" + number
+	}
+	return number, nil
+}
+
+func (p *jsonPathParser) or() (string, error) {
+	left, err := p.and()
+	if err != nil {
+		return "", err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " or " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *jsonPathParser) and() (string, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return "", err
+	}
+	for p.accept("&&") {
+		right, err := p.comparison()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " and " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *jsonPathParser) comparison() (string, error) {
+	if p.accept("!") {
+		operand, err := p.comparison()
+		if err != nil {
+			return "", err
+		}
+		return "(" + operand + " | not)", nil
+	}
+	if p.accept("(") {
+		cond, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		return cond, p.expect(")")
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return "", err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.operand()
+			if err != nil {
+				return "", err
+			}
+			return "(" + left + " " + op + " " + right + ")", nil
+		}
+	}
+	return left, nil
+}
+
+func (p *jsonPathParser) operand() (string, error) {
+	t := p.peek()
+	switch {
+	case p.accept("@"):
+		path, err := p.segments(true)
+		return "(." + path + ")", err
+	case t.kind == jpString:
+		p.next()
+		return strconv.Quote(t.text), nil
+	case t.kind == jpNumber:
+		p.next()
+		return t.text, nil
+	case p.accept("-"):
+		if n := p.next(); n.kind == jpNumber {
+			return "-" + n.text, nil
+		}
+		return "", p.errorf("expected number")
+	case t.kind == jpName && (t.text == "true" || t.text == "false" || t.text == "null"):
+		p.next()
+		return t.text, nil
+	}
+	return "", p.errorf("expected @, string, number, true, false or null")
+}
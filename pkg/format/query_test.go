@@ -0,0 +1,221 @@
+package format
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const queryTestData = `{
+  "results": [
+    {"name": "web-1", "state": "ACTIVE", "size": 3, "tags": {"env": "prod"}, "zones": ["a", "b"]},
+    {"name": "web-2", "state": "DELETED", "size": 1, "tags": {"env": "dev"}, "zones": []},
+    {"name": "db-1", "state": "ACTIVE", "size": 8, "tags": {}, "zones": ["c"]}
+  ],
+  "total_count": 3
+}`
+
+func queryTestInput(t *testing.T) interface{} {
+	t.Helper()
+	var data interface{}
+	if err := json.Unmarshal([]byte(queryTestData), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decodeJSON parses the expected outputs of a test case
+func decodeJSON(t *testing.T, src string) []interface{} {
+	t.Helper()
+	var want []interface{}
+	if err := json.Unmarshal([]byte(src), &want); err != nil {
+		t.Fatalf("bad expected value %s: %v", src, err)
+	}
+	return want
+}
+
+func TestQueryRun(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string // JSON list of every output
+	}{
+		{"identity", ".total_count", `[3]`},
+		{"path", ".results[0].tags.env", `["prod"]`},
+		{"missing field", ".results[0].missing", `[null]`},
+		{"negative index", ".results[-1].name", `["db-1"]`},
+		{"slice", ".results[1:] | length", `[2]`},
+		{"iterate", ".results[].name", `["web-1", "web-2", "db-1"]`},
+		{"optional iterate", ".total_count[]?", `[]`},
+		{"comma", ".results[0] | .name, .state", `["web-1", "ACTIVE"]`},
+		{"recurse", "[.. | .env? // empty]", `[["prod", "dev"]]`},
+		{"select", `[.results[] | select(.state == "ACTIVE") | .name]`, `[["web-1", "db-1"]]`},
+		{"select and", `[.results[] | select(.state == "ACTIVE" and .size > 5) | .name]`, `[["db-1"]]`},
+		{"map", "[.results | map(.size * 2)[]]", `[[6, 2, 16]]`},
+		{"object construction", ".results[0] | {name, env: .tags.env}", `[{"name": "web-1", "env": "prod"}]`},
+		{"alternative", ".results[2].tags.env // \"none\"", `["none"]`},
+		{"if", `.results[] | if .size > 2 then "big" else "small" end`, `["big", "small", "big"]`},
+		{"sort_by", "[.results | sort_by(.size)[].name]", `[["web-2", "web-1", "db-1"]]`},
+		{"group_by", "[.results | group_by(.state)[] | length]", `[[2, 1]]`},
+		{"unique", "[.results[].state] | unique", `[["ACTIVE", "DELETED"]]`},
+		{"min_by max_by", "[.results | min_by(.size).name, max_by(.size).name]", `[["web-2", "db-1"]]`},
+		{"add", "[.results[].size] | add", `[12]`},
+		{"keys", ".results[0].tags | keys", `[["env"]]`},
+		{"has", ".results[] | has(\"zones\")", `[true, true, true]`},
+		{"to_entries object", ".results[0].tags | to_entries", `[[{"key": "env", "value": "prod"}]]`},
+		{"to_entries array", `[.results[0].zones | to_entries[] | "\(.key)=\(.value)"]`, `[["0=a", "1=b"]]`},
+		{"from_entries", `[{key: "a", value: 1}] | from_entries`, `[{"a": 1}]`},
+		{"join split", `.results[0].name | split("-") | join("_")`, `["web_1"]`},
+		{"test", `[.results[] | select(.name | test("^web")) | .name]`, `[["web-1", "web-2"]]`},
+		{"string interpolation", `.results[0] | "\(.name) is \(.state)"`, `["web-1 is ACTIVE"]`},
+		{"as binding", `.total_count as $n | [.results[] | .size / $n]`, `[[1, 0.3333333333333333, 2.6666666666666665]]`},
+		{"reduce", "reduce .results[] as $r (0; . + $r.size)", `[12]`},
+		{"length of each", "[.results[] | .zones | length]", `[[2, 0, 1]]`},
+		{"type", "[.total_count, .results, .results[0].name, null] | map(type)", `[["number", "array", "string", "null"]]`},
+		{"tostring tonumber", `[.total_count | tostring, ("7" | tonumber)]`, `[["3", 7]]`},
+		{"empty", "empty", `[]`},
+		{"any all", "[[.results[].size] | any(. > 5), all(. > 5)]", `[[true, false]]`},
+		{"jsonpath member", "$.results[0].name", `["web-1"]`},
+		{"jsonpath wildcard", "$.results[*].name", `["web-1", "web-2", "db-1"]`},
+		{"jsonpath bracket member", "$['results'][1]['state']", `["DELETED"]`},
+		{"jsonpath missing member", "$.results[*].tags.env", `["prod", "dev"]`},
+		{"jsonpath union", "$.results[0,2].name", `["web-1", "db-1"]`},
+		{"jsonpath slice", "$.results[:2].name", `["web-1", "web-2"]`},
+		{"jsonpath negative index", "$.results[-1].size", `[8]`},
+		{"jsonpath recursive", "$..env", `["prod", "dev"]`},
+		{"jsonpath filter", `$.results[?(@.state == 'ACTIVE')].name`, `["web-1", "db-1"]`},
+		{"jsonpath filter and or", `$.results[?(@.size > 2 && @.tags.env == "prod" || @.size < 2)].name`, `["web-1", "web-2"]`},
+		{"jsonpath filter not", `$.results[?(!(@.state == "ACTIVE"))].name`, `["web-2"]`},
+		{"jsonpath filter missing", `$.results[?(@.tags.env != null)].name`, `["web-1", "web-2"]`},
+		{"jsonpath root", "$", `[` + queryTestData + `]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := CompileQuery(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileQuery(%q) error = %v", tt.expr, err)
+			}
+
+			got, err := query.Run(queryTestInput(t))
+			if err != nil {
+				t.Fatalf("Run(%q) error = %v", tt.expr, err)
+			}
+			if got == nil {
+				got = []interface{}{}
+			}
+
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Run(%q) = %v, want %v", tt.expr, got, want)
+			}
+		})
+	}
+}
+
+func TestQueryApply(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{".total_count", `3`},
+		{".results[].size", `[3, 1, 8]`},
+		{"empty", `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			query, err := CompileQuery(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileQuery(%q) error = %v", tt.expr, err)
+			}
+
+			got, err := query.Apply(queryTestInput(t))
+			if err != nil {
+				t.Fatalf("Apply(%q) error = %v", tt.expr, err)
+			}
+
+			var want interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Apply(%q) = %v, want %v", tt.expr, got, want)
+			}
+		})
+	}
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "empty query"},
+		{".results[", "invalid query"},
+		{".results | map(", "invalid query"},
+		{"unknown_builtin(1)", "function not defined: unknown_builtin/1"},
+		{".results | $unbound", "variable not defined: $unbound"},
+		{"$unbound", "unexpected 'unbound'"},
+		{"input", "invalid query"},
+		{"$.results[", "invalid query"},
+		{"$.results[?(@.size >)]", "expected @, string, number"},
+		{"$.results[?(@.size + 1)]", "unexpected '+'"},
+		{"$.results[?(@.a == 1]", "expected ')'"},
+		{"$.results[{]", "unexpected '{'"},
+		{"$.results.'name", "unterminated string"},
+		{"$.results extra", "unexpected 'extra'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := CompileQuery(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CompileQuery(%q) error = %v, want one containing %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueryRunErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{".total_count.name", "expected an object"},
+		{".results.name", "expected an object"},
+		{".total_count[]", "cannot iterate over"},
+		{`error("boom")`, "boom"},
+		{`.results[0].name | tonumber`, "query '.results[0].name | tonumber' failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			query, err := CompileQuery(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileQuery(%q) error = %v", tt.expr, err)
+			}
+
+			_, err = query.Run(queryTestInput(t))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Run(%q) error = %v, want one containing %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueryNormalizesInput(t *testing.T) {
+	query, err := CompileQuery(".count + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Typed Go values, such as int fields, are seen as JSON numbers
+	got, err := query.Apply(map[string]interface{}{"count": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != float64(3) {
+		t.Errorf("Apply = %#v, want float64(3)", got)
+	}
+}
@@ -0,0 +1,124 @@
+package format
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// minColumnWidth is the narrowest a column is squeezed to when the table does not fit
+const minColumnWidth = 6
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// IsTerminal reports whether f is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// OutputWidth returns the width static tables are fitted to: the terminal width when
+// stdout is a terminal, otherwise $COLUMNS, otherwise 0 for no limit
+func OutputWidth() int {
+	if IsTerminal(os.Stdout) {
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 0
+}
+
+// StripANSI removes color and cursor escape sequences from s
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// RenderStaticTable lays rows out as plain, uncolored, space aligned text. When width is
+// positive the widest columns are shortened, with a trailing "...", until the table fits.
+func RenderStaticTable(headers []string, rows [][]string, width int) string {
+	clean := func(s string) string {
+		s = StripANSI(s)
+		return strings.NewReplacer("\r\n", " ", "\n", " ", "\t", " ").Replace(s)
+	}
+
+	cells := make([][]string, 0, len(rows)+1)
+	cells = append(cells, make([]string, len(headers)))
+	for i, header := range headers {
+		cells[0][i] = clean(header)
+	}
+	for _, row := range rows {
+		line := make([]string, len(headers))
+		for i := range headers {
+			if i < len(row) {
+				line[i] = clean(row[i])
+			}
+		}
+		cells = append(cells, line)
+	}
+
+	widths := make([]int, len(headers))
+	for _, line := range cells {
+		for i, cell := range line {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	if width > 0 {
+		fitWidths(widths, width)
+	}
+
+	var sb strings.Builder
+	for _, line := range cells {
+		for i, cell := range line {
+			cell = truncate(cell, widths[i])
+			sb.WriteString(cell)
+			if i < len(line)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+3))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// fitWidths narrows the widest columns one at a time until the row fits in width
+func fitWidths(widths []int, width int) {
+	total := func() int {
+		sum := 3 * (len(widths) - 1)
+		for _, w := range widths {
+			sum += w
+		}
+		return sum
+	}
+
+	for total() > width {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			return
+		}
+		widths[widest]--
+	}
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if width <= 3 {
+		return string(runes[:width])
+	}
+	return string(runes[:width-3]) + "..."
+}
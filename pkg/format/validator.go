@@ -1,22 +1,15 @@
 package format
 
 import (
-	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/spf13/viper"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 // ValidateServiceCommand checks if the given verb and resource are valid for the service
@@ -50,22 +43,23 @@ func ValidateServiceCommand(service, verb, resourceName string) error {
 		return fmt.Errorf("no endpoint found in configuration")
 	}
 
-	endpointName, _ = configs.GetAPIEndpoint(endpointName)
-
-	// Fetch endpoints map
-	endpointsMap, err := configs.FetchEndpointsMap(endpointName)
-	if err != nil {
-		return fmt.Errorf("failed to fetch endpoints: %v", err)
-	}
+	env := configs.CurrentEnvironment()
+	env.Endpoint, env.EndpointTemplate = endpointName, envConfig.GetString("endpoint_template")
+	resolver := configs.NewResolver(currentEnv, env)
 
 	// Check if service exists
-	serviceEndpoint, ok := endpointsMap[service]
-	if !ok {
+	ctx, cancel := rpc.Context()
+	defer cancel()
+	target, err := resolver.Resolve(ctx, service)
+	if errors.Is(err, configs.ErrUnknownService) {
 		return fmt.Errorf("service '%s' not found", service)
 	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch endpoints: %v", err)
+	}
 
 	// Fetch service resources
-	resources, err := FetchServiceResources(service, serviceEndpoint, nil)
+	resources, err := FetchServiceResources(currentEnv, service, target.String(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to fetch service resources: %v", err)
 	}
@@ -99,53 +93,31 @@ func ValidateServiceCommand(service, verb, resourceName string) error {
 	return nil
 }
 
-func FetchServiceResources(service, endpoint string, shortNamesMap map[string]string) ([][]string, error) {
-	parts := strings.Split(endpoint, "://")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid endpoint format: %s", endpoint)
-	}
-
-	scheme := parts[0]
-	hostPort := strings.SplitN(parts[1], "/", 2)[0]
-
-	var opts []grpc.DialOption
-	if scheme == "grpc+ssl" {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false,
-		}
-		creds := credentials.NewTLS(tlsConfig)
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// FetchServiceResources lists the resources and verbs of a service, using the descriptor cache of env
+func FetchServiceResources(env, service, endpoint string, shortNamesMap map[string]string) ([][]string, error) {
+	target, err := configs.ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
 	}
 
-	conn, err := grpc.Dial(hostPort, opts...)
+	conn, err := configs.Dial(target.HostPort, target.Secure)
 	if err != nil {
 		return nil, fmt.Errorf("connection failed: unable to connect to %s: %v", endpoint, err)
 	}
 	defer conn.Close()
 
-	client := grpc_reflection_v1alpha.NewServerReflectionClient(conn)
-	stream, err := client.ServerReflectionInfo(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("failed to create reflection client: %v", err)
-	}
-
-	req := &grpc_reflection_v1alpha.ServerReflectionRequest{
-		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_ListServices{ListServices: ""},
-	}
+	cacheDir, _ := rpc.DescriptorCacheDir(env)
+	ctx, cancel := rpc.Context()
+	defer cancel()
 
-	if err := stream.Send(req); err != nil {
-		return nil, fmt.Errorf("failed to send reflection request: %v", err)
-	}
+	reflector := rpc.NewReflector(ctx, conn, cacheDir, service)
+	defer reflector.Close()
 
-	resp, err := stream.Recv()
+	services, err := reflector.ListServices()
 	if err != nil {
-		return nil, fmt.Errorf("failed to receive reflection response: %v", err)
+		return nil, fmt.Errorf("failed to list services: %v", rpc.ContextError(ctx, err))
 	}
 
-	services := resp.GetListServicesResponse().Service
-
 	// Load aliases
 	aliases, err := configs.LoadAliases()
 	if err != nil {
@@ -154,11 +126,14 @@ func FetchServiceResources(service, endpoint string, shortNamesMap map[string]st
 
 	data := [][]string{}
 	for _, s := range services {
-		if strings.HasPrefix(s.Name, "grpc.reflection.v1alpha.") {
+		if strings.HasPrefix(s, "grpc.reflection.") {
 			continue
 		}
-		resourceName := s.Name[strings.LastIndex(s.Name, ".")+1:]
-		verbs := getServiceMethods(client, s.Name)
+		resourceName := s[strings.LastIndex(s, ".")+1:]
+		verbs, err := getServiceMethods(reflector, s)
+		if err != nil {
+			return nil, err
+		}
 
 		// Group verbs by alias
 		verbsWithAlias := make(map[string]string)
@@ -199,44 +174,16 @@ func FetchServiceResources(service, endpoint string, shortNamesMap map[string]st
 	return data, nil
 }
 
-func getServiceMethods(client grpc_reflection_v1alpha.ServerReflectionClient, serviceName string) []string {
-	stream, err := client.ServerReflectionInfo(context.Background())
-	if err != nil {
-		log.Fatalf("Failed to create reflection client: %v", err)
-	}
-
-	req := &grpc_reflection_v1alpha.ServerReflectionRequest{
-		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: serviceName},
-	}
-
-	if err := stream.Send(req); err != nil {
-		log.Fatalf("Failed to send reflection request: %v", err)
-	}
-
-	resp, err := stream.Recv()
+func getServiceMethods(reflector *rpc.Reflector, serviceName string) ([]string, error) {
+	serviceDesc, err := reflector.ResolveService(serviceName)
 	if err != nil {
-		log.Fatalf("Failed to receive reflection response: %v", err)
-	}
-
-	fileDescriptor := resp.GetFileDescriptorResponse()
-	if fileDescriptor == nil {
-		return []string{}
+		return nil, fmt.Errorf("failed to resolve service %s: %v", serviceName, err)
 	}
 
 	methods := []string{}
-	for _, fdBytes := range fileDescriptor.FileDescriptorProto {
-		fd := &descriptorpb.FileDescriptorProto{}
-		if err := proto.Unmarshal(fdBytes, fd); err != nil {
-			log.Fatalf("Failed to unmarshal file descriptor: %v", err)
-		}
-		for _, service := range fd.GetService() {
-			if service.GetName() == serviceName[strings.LastIndex(serviceName, ".")+1:] {
-				for _, method := range service.GetMethod() {
-					methods = append(methods, method.GetName())
-				}
-			}
-		}
+	for _, method := range serviceDesc.GetMethods() {
+		methods = append(methods, method.GetName())
 	}
 
-	return methods
+	return methods, nil
 }
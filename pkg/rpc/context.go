@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrInterrupted is reported when an RPC is cancelled with Ctrl+C
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrTimeout is reported when an RPC does not finish within the configured timeout
+var ErrTimeout = errors.New("request timed out")
+
+// interruptGrace is how long a command may take to wind down after Ctrl+C before the
+// process exits anyway
+const interruptGrace = 2 * time.Second
+
+var (
+	ctxMu   sync.Mutex
+	rootCtx = context.Background()
+	timeout time.Duration
+)
+
+// HandleInterrupt makes Ctrl+C cancel every RPC context instead of killing the process,
+// so commands can stop cleanly. The process still exits if the command has not returned
+// within a short grace period, or on a second Ctrl+C.
+func HandleInterrupt() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ctxMu.Lock()
+	rootCtx = ctx
+	ctxMu.Unlock()
+
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt)
+
+	go func() {
+		<-sigChan
+		cancel()
+
+		select {
+		case <-sigChan:
+		case <-time.After(interruptGrace):
+		}
+		os.Exit(130)
+	}()
+}
+
+// SetTimeout sets the time limit of contexts returned by Context; zero means none
+func SetTimeout(d time.Duration) {
+	ctxMu.Lock()
+	defer ctxMu.Unlock()
+	timeout = d
+}
+
+// Timeout returns the time limit set with SetTimeout
+func Timeout() time.Duration {
+	ctxMu.Lock()
+	defer ctxMu.Unlock()
+	return timeout
+}
+
+// Context returns the context for one operation, such as a command's call or a login
+// step. It is cancelled on Ctrl+C and once the configured timeout has passed.
+func Context() (context.Context, context.CancelFunc) {
+	ctxMu.Lock()
+	parent, limit := rootCtx, timeout
+	ctxMu.Unlock()
+
+	if limit > 0 {
+		return context.WithTimeout(parent, limit)
+	}
+	return context.WithCancel(parent)
+}
+
+// ContextError replaces the error of an RPC that ran out of time or was interrupted with
+// a message saying so; other errors are returned as they are
+func ContextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), status.Code(err) == codes.DeadlineExceeded:
+		return fmt.Errorf("%w after %s; use --timeout to allow more time", ErrTimeout, Timeout())
+	case errors.Is(ctx.Err(), context.Canceled):
+		return ErrInterrupted
+	}
+	return err
+}
@@ -0,0 +1,342 @@
+// Package rpc holds the gRPC plumbing shared by the cobra commands and pkg/client.
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DefaultDescriptorTTL is how long cached descriptors are trusted before the server is asked again
+const DefaultDescriptorTTL = 24 * time.Hour
+
+// ErrNotCached is returned by the Reflectors of NewCachedReflector for what the cache lacks
+var ErrNotCached = errors.New("not in the descriptor cache")
+
+// DescriptorCacheDir returns the directory holding the cached descriptors of an environment
+func DescriptorCacheDir(env string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+
+	return filepath.Join(home, ".cfctl", "cache", env, "descriptors"), nil
+}
+
+// descriptorMeta is stored next to the FileDescriptorSet of a service. Fingerprint is a hash
+// of the service list and of the set, so an entry whose two files don't match is ignored.
+type descriptorMeta struct {
+	FetchedAt   time.Time `json:"fetched_at"`
+	Fingerprint string    `json:"fingerprint"`
+	Services    []string  `json:"services"`
+}
+
+// Reflector answers reflection queries from the on-disk descriptor cache and falls back to
+// server reflection on a miss, writing whatever it learns back to the cache.
+//
+// Cached entries are trusted for the TTL. Once it has passed, the server is asked for its
+// service list again and the descriptors are dropped, to be fetched again as they are used,
+// since a server may change a message without changing its services.
+type Reflector struct {
+	ctx  context.Context
+	conn grpc.ClientConnInterface
+	live *grpcreflect.Client
+
+	*descriptorState
+}
+
+// descriptorState is what the Reflectors returned by With share
+type descriptorState struct {
+	dir string
+	key string
+	ttl time.Duration
+
+	mu     sync.Mutex
+	loaded bool
+	meta   descriptorMeta
+	files  map[string]*desc.FileDescriptor
+}
+
+// NewReflector creates a Reflector for the services served by conn. Descriptors are cached
+// in dir under key, usually the cfctl service name; an empty dir disables the disk cache.
+// conn is only used on a cache miss, so a lazily dialed connection costs nothing when warm.
+func NewReflector(ctx context.Context, conn grpc.ClientConnInterface, dir, key string) *Reflector {
+	return &Reflector{
+		ctx:  ctx,
+		conn: conn,
+		descriptorState: &descriptorState{
+			dir:   dir,
+			key:   key,
+			ttl:   DefaultDescriptorTTL,
+			files: make(map[string]*desc.FileDescriptor),
+		},
+	}
+}
+
+// NewCachedReflector creates a Reflector that answers from the disk cache alone, however old
+// its entries are, for when the server can't be reached over gRPC
+func NewCachedReflector(dir, key string) *Reflector {
+	r := NewReflector(context.Background(), nil, dir, key)
+	r.ttl = time.Duration(math.MaxInt64)
+	return r
+}
+
+// With returns a Reflector that asks the server within ctx, such as the context of one call,
+// while sharing the descriptors r has loaded or learned. Close it once the call is done.
+func (r *Reflector) With(ctx context.Context) *Reflector {
+	return &Reflector{ctx: ctx, conn: r.conn, descriptorState: r.descriptorState}
+}
+
+// SetTTL changes how long cached descriptors are trusted; zero or less always revalidates
+func (r *Reflector) SetTTL(ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ttl = ttl
+}
+
+// ListServices returns the fully qualified names of the services exposed by the server
+func (r *Reflector) ListServices() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.revalidate(); err != nil {
+		return nil, err
+	}
+
+	return append([]string(nil), r.meta.Services...), nil
+}
+
+// ResolveService returns the descriptor of the named service
+func (r *Reflector) ResolveService(name string) (*desc.ServiceDescriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.revalidate(); err != nil {
+		return nil, err
+	}
+
+	for _, fd := range r.files {
+		if sd := fd.FindService(name); sd != nil {
+			return sd, nil
+		}
+	}
+
+	if r.conn == nil {
+		return nil, fmt.Errorf("descriptor of %s is %w", name, ErrNotCached)
+	}
+
+	Logf(LevelInfo, "descriptor of %s not cached, asking the server", name)
+	sd, err := r.client().ResolveService(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r.files[sd.GetFile().GetName()] = sd.GetFile()
+	r.save()
+
+	return sd, nil
+}
+
+// Close releases the reflection stream, if one was opened
+func (r *Reflector) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.live != nil {
+		r.live.Reset()
+		r.live = nil
+	}
+}
+
+func (r *Reflector) client() *grpcreflect.Client {
+	if r.live == nil {
+		r.live = NewReflectionClient(r.ctx, r.conn)
+	}
+	return r.live
+}
+
+// revalidate makes sure the service list is known and not older than the TTL
+func (r *Reflector) revalidate() error {
+	firstUse := !r.loaded
+	if firstUse {
+		r.load()
+		r.loaded = true
+	}
+
+	known := !r.meta.FetchedAt.IsZero()
+	if known && time.Since(r.meta.FetchedAt) < r.ttl {
+		if firstUse {
+			Logf(LevelInfo, "descriptor cache hit for %s, fetched %s ago", r.key, time.Since(r.meta.FetchedAt).Round(time.Second))
+		}
+		return nil
+	}
+
+	if r.conn == nil {
+		return fmt.Errorf("service list of %s is %w", r.key, ErrNotCached)
+	}
+
+	if !known {
+		Logf(LevelInfo, "descriptor cache miss for %s, asking the server", r.key)
+	} else {
+		Logf(LevelInfo, "descriptor cache for %s is older than %s, fetching it again", r.key, r.ttl)
+	}
+
+	services, err := r.client().ListServices()
+	if status.Code(err) == codes.Unimplemented {
+		// The server no longer speaks the remembered reflection version; probe it again
+		r.live.Reset()
+		r.live = nil
+		services, err = r.client().ListServices()
+	}
+	if err != nil {
+		return err
+	}
+
+	r.files = make(map[string]*desc.FileDescriptor)
+	r.meta = descriptorMeta{
+		FetchedAt: time.Now(),
+		Services:  services,
+	}
+	r.save()
+
+	return nil
+}
+
+func (r *Reflector) paths() (string, string) {
+	base := filepath.Join(r.dir, r.key)
+	return base + ".pb", base + ".json"
+}
+
+// load reads the cached entry; a missing or unreadable entry is treated as empty
+func (r *Reflector) load() {
+	if r.dir == "" {
+		return
+	}
+
+	pbPath, metaPath := r.paths()
+
+	metaBytes, err := os.ReadFile(metaPath)
+	if err != nil {
+		return
+	}
+
+	var meta descriptorMeta
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		return
+	}
+
+	pbBytes, err := os.ReadFile(pbPath)
+	if err != nil {
+		return
+	}
+
+	if meta.Fingerprint != descriptorFingerprint(meta.Services, pbBytes) {
+		Logf(LevelInfo, "descriptor cache for %s does not match its fingerprint, ignoring it", r.key)
+		return
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(pbBytes, set); err != nil {
+		return
+	}
+
+	files, err := desc.CreateFileDescriptorsFromSet(set)
+	if err != nil {
+		return
+	}
+
+	r.meta = meta
+	r.files = files
+}
+
+// save writes the entry to disk. The cache is best effort, so failures are ignored.
+func (r *Reflector) save() {
+	if r.dir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return
+	}
+
+	// Sorted and deterministic, so the same descriptors always get the same fingerprint
+	names := make([]string, 0, len(r.files))
+	for name := range r.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*desc.FileDescriptor, 0, len(names))
+	for _, name := range names {
+		files = append(files, r.files[name])
+	}
+
+	pbBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(desc.ToFileDescriptorSet(files...))
+	if err != nil {
+		return
+	}
+	r.meta.Fingerprint = descriptorFingerprint(r.meta.Services, pbBytes)
+
+	metaBytes, err := json.MarshalIndent(r.meta, "", "  ")
+	if err != nil {
+		return
+	}
+
+	pbPath, metaPath := r.paths()
+	if err := writeFileAtomic(pbPath, pbBytes); err != nil {
+		return
+	}
+	_ = writeFileAtomic(metaPath, metaBytes)
+}
+
+// descriptorFingerprint identifies a cache entry by its service list and the serialized
+// FileDescriptorSet of its descriptors
+func descriptorFingerprint(services []string, pbBytes []byte) string {
+	sorted := append([]string(nil), services...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	h.Write([]byte(strings.Join(sorted, "\n")))
+	h.Write([]byte{0})
+	h.Write(pbBytes)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeFileAtomic replaces path so that concurrent readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
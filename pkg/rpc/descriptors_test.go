@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// serverFile describes spaceone.api.inventory.v1.Server with the given verbs
+func serverFile(t *testing.T, verbs ...string) *desc.FileDescriptor {
+	t.Helper()
+
+	request := builder.NewMessage("ServerRequest").
+		AddField(builder.NewField("server_id", builder.FieldTypeString()))
+	response := builder.NewMessage("ServerInfo").
+		AddField(builder.NewField("server_id", builder.FieldTypeString()))
+	service := builder.NewService("Server")
+	for _, verb := range verbs {
+		service.AddMethod(builder.NewMethod(verb, builder.RpcTypeMessage(request, false), builder.RpcTypeMessage(response, false)))
+	}
+
+	file, err := builder.NewFile("spaceone/api/inventory/v1/server.proto").SetPackageName("spaceone.api.inventory.v1").
+		AddMessage(request).AddMessage(response).AddService(service).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+type serviceList map[string]grpc.ServiceInfo
+
+func (l serviceList) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return l
+}
+
+// startReflectionServer serves reflection for file and returns a connection to it, along
+// with the number of reflection requests the server has received
+func startReflectionServer(t *testing.T, file *desc.FileDescriptor) (*grpc.ClientConn, *atomic.Int32) {
+	t.Helper()
+
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(file.UnwrapFile()); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests atomic.Int32
+	srv := grpc.NewServer(grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &countingStream{ServerStream: ss, requests: &requests})
+	}))
+	services := serviceList{}
+	for _, sd := range file.GetServices() {
+		services[sd.GetFullyQualifiedName()] = grpc.ServiceInfo{}
+	}
+	reflectionv1.RegisterServerReflectionServer(srv, reflection.NewServerV1(reflection.ServerOptions{Services: services, DescriptorResolver: files}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, &requests
+}
+
+type countingStream struct {
+	grpc.ServerStream
+	requests *atomic.Int32
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.requests.Add(1)
+	}
+	return err
+}
+
+// resolve asks a new Reflector over conn, caching in dir, for the Server service
+func resolve(t *testing.T, conn grpc.ClientConnInterface, dir string, ttl time.Duration) (*desc.ServiceDescriptor, error) {
+	t.Helper()
+
+	r := NewReflector(context.Background(), conn, dir, "inventory")
+	if ttl != 0 {
+		r.SetTTL(ttl)
+	}
+	defer r.Close()
+
+	if _, err := r.ListServices(); err != nil {
+		return nil, err
+	}
+	return r.ResolveService("spaceone.api.inventory.v1.Server")
+}
+
+func TestReflectorCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		serve []string // Verbs served once the cache holds list and get
+		// corrupt replaces the cached descriptors without updating their fingerprint
+		corrupt      bool
+		wantVerb     string
+		wantRequests bool
+	}{
+		{name: "hit", ttl: time.Hour, serve: []string{"list", "get", "delete"}, wantVerb: "get"},
+		{name: "ttl expiry", ttl: -1, serve: []string{"list", "get", "delete"}, wantVerb: "delete", wantRequests: true},
+		{name: "fingerprint change", ttl: time.Hour, serve: []string{"list", "get", "delete"}, corrupt: true, wantVerb: "delete", wantRequests: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			dir := t.TempDir()
+
+			before, _ := startReflectionServer(t, serverFile(t, "list", "get"))
+			if _, err := resolve(t, before, dir, 0); err != nil {
+				t.Fatalf("filling the cache: %v", err)
+			}
+
+			if tt.corrupt {
+				pbBytes, err := proto.Marshal(desc.ToFileDescriptorSet(serverFile(t, "list")))
+				if err != nil {
+					t.Fatal(err)
+				}
+				pbPath, _ := NewReflector(context.Background(), nil, dir, "inventory").paths()
+				if err := os.WriteFile(pbPath, pbBytes, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			after, requests := startReflectionServer(t, serverFile(t, tt.serve...))
+			sd, err := resolve(t, after, dir, tt.ttl)
+			if err != nil {
+				t.Fatalf("ResolveService() error = %v", err)
+			}
+
+			if sd.FindMethodByName(tt.wantVerb) == nil {
+				t.Errorf("ResolveService() has no %s verb", tt.wantVerb)
+			}
+			if got := requests.Load() > 0; got != tt.wantRequests {
+				t.Errorf("the server got %d reflection requests, want some = %v", requests.Load(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestCachedReflector(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+
+	r := NewCachedReflector(dir, "inventory")
+	if _, err := r.ListServices(); !errors.Is(err, ErrNotCached) {
+		t.Errorf("ListServices() on an empty cache error = %v, want ErrNotCached", err)
+	}
+
+	conn, _ := startReflectionServer(t, serverFile(t, "list"))
+	if _, err := resolve(t, conn, dir, 0); err != nil {
+		t.Fatalf("filling the cache: %v", err)
+	}
+
+	// Answers from the cache however old it is
+	r = NewCachedReflector(dir, "inventory")
+	if _, err := r.ResolveService("spaceone.api.inventory.v1.Server"); err != nil {
+		t.Errorf("ResolveService() error = %v", err)
+	}
+	if _, err := r.ResolveService("spaceone.api.inventory.v1.Region"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("ResolveService() of an unknown service error = %v, want ErrNotCached", err)
+	}
+}
@@ -0,0 +1,27 @@
+package rpc
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+var verbosity atomic.Int32
+
+// SetVerbosity sets how much diagnostic output Logf writes; zero disables it
+func SetVerbosity(level int) {
+	verbosity.Store(int32(level))
+}
+
+// Verbosity returns the level set with SetVerbosity
+func Verbosity() int {
+	return int(verbosity.Load())
+}
+
+// Logf writes a diagnostic line to stderr when the verbosity is at least level
+func Logf(level int, format string, args ...interface{}) {
+	if Verbosity() < level {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "cfctl: "+format+"\n", args...)
+}
@@ -0,0 +1,190 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// Reflection protocol versions, as remembered per endpoint
+const (
+	ReflectionV1      = "v1"
+	ReflectionV1Alpha = "v1alpha"
+)
+
+var (
+	versionsMu     sync.Mutex
+	versionsLoaded bool
+	versions       = map[string]string{}
+)
+
+// NewReflectionClient returns a reflection client for conn. Servers are asked over
+// grpc.reflection.v1 first and over v1alpha when they don't implement it. The version an
+// endpoint speaks is remembered on disk, so later runs skip the probe.
+func NewReflectionClient(ctx context.Context, conn grpc.ClientConnInterface) *grpcreflect.Client {
+	target := connTarget(conn)
+	version := reflectionVersion(target)
+
+	if version == "" {
+		supported, err := probeReflectionV1(ctx, conn)
+		switch {
+		case err != nil:
+			// Left for the caller's first request to report
+			Logf(LevelInfo, "failed to probe the reflection version of %s: %v", target, err)
+		case supported:
+			version = ReflectionV1
+			Logf(LevelInfo, "%s speaks grpc.reflection.v1", target)
+			setReflectionVersion(target, version)
+		default:
+			version = ReflectionV1Alpha
+			Logf(LevelInfo, "%s speaks grpc.reflection.v1alpha only", target)
+			setReflectionVersion(target, version)
+		}
+	}
+
+	if version == ReflectionV1Alpha {
+		stub := v1AlphaStub{ServerReflectionClient: reflectionv1alpha.NewServerReflectionClient(conn), target: target}
+		return grpcreflect.NewClientV1Alpha(ctx, stub)
+	}
+	// Still falls back to v1alpha by itself should the server have changed
+	return grpcreflect.NewClientAuto(ctx, conn)
+}
+
+// probeReflectionV1 asks the server for its services over grpc.reflection.v1 and reports
+// whether it implements that version
+func probeReflectionV1(ctx context.Context, conn grpc.ClientConnInterface) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := reflectionv1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err == nil {
+		err = stream.Send(&reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_ListServices{},
+		})
+		if err == nil || err == io.EOF {
+			// Send reports EOF when the server ended the stream; Recv has the status
+			_, err = stream.Recv()
+		}
+	}
+
+	switch {
+	case err == nil:
+		return true, nil
+	case status.Code(err) == codes.Unimplemented:
+		return false, nil
+	}
+	return false, err
+}
+
+// v1AlphaStub forgets that target speaks v1alpha once the server says it doesn't implement
+// it, so the next client probes the server again
+type v1AlphaStub struct {
+	reflectionv1alpha.ServerReflectionClient
+	target string
+}
+
+func (s v1AlphaStub) ServerReflectionInfo(ctx context.Context, opts ...grpc.CallOption) (reflectionv1alpha.ServerReflection_ServerReflectionInfoClient, error) {
+	stream, err := s.ServerReflectionClient.ServerReflectionInfo(ctx, opts...)
+	if err != nil {
+		s.check(err)
+		return nil, err
+	}
+	return v1AlphaStream{ServerReflection_ServerReflectionInfoClient: stream, stub: s}, nil
+}
+
+func (s v1AlphaStub) check(err error) {
+	if status.Code(err) == codes.Unimplemented && reflectionVersion(s.target) == ReflectionV1Alpha {
+		Logf(LevelInfo, "%s no longer speaks grpc.reflection.v1alpha", s.target)
+		setReflectionVersion(s.target, "")
+	}
+}
+
+type v1AlphaStream struct {
+	reflectionv1alpha.ServerReflection_ServerReflectionInfoClient
+	stub v1AlphaStub
+}
+
+func (s v1AlphaStream) Recv() (*reflectionv1alpha.ServerReflectionResponse, error) {
+	resp, err := s.ServerReflection_ServerReflectionInfoClient.Recv()
+	if err != nil {
+		s.stub.check(err)
+	}
+	return resp, err
+}
+
+// connTarget returns the target conn was dialed to, or "" if it doesn't say
+func connTarget(conn grpc.ClientConnInterface) string {
+	if t, ok := conn.(interface{ Target() string }); ok {
+		return t.Target()
+	}
+	return ""
+}
+
+// reflectionVersion returns the version remembered for target, or "" if it is unknown
+func reflectionVersion(target string) string {
+	if target == "" {
+		return ""
+	}
+
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+
+	if !versionsLoaded {
+		versionsLoaded = true
+		if path, err := reflectionVersionsPath(); err == nil {
+			if data, err := os.ReadFile(path); err == nil {
+				_ = json.Unmarshal(data, &versions)
+			}
+		}
+	}
+	return versions[target]
+}
+
+// setReflectionVersion remembers the version of target. The file is best effort, so
+// failures to write it are ignored.
+func setReflectionVersion(target, version string) {
+	if target == "" {
+		return
+	}
+
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+
+	if version == "" {
+		delete(versions, target)
+	} else {
+		versions[target] = version
+	}
+
+	path, err := reflectionVersionsPath()
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	_ = writeFileAtomic(path, data)
+}
+
+// reflectionVersionsPath returns the file remembering the reflection version of each endpoint
+func reflectionVersionsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cfctl", "cache", "reflection_versions.json"), nil
+}
@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// versionedServer serves reflection for a file over the versions it speaks and counts the
+// streams opened over each of them
+type versionedServer struct {
+	conn    *grpc.ClientConn
+	v1      atomic.Int32
+	v1alpha atomic.Int32
+}
+
+func startVersionedServer(t *testing.T, file *desc.FileDescriptor, v1, v1alpha bool) *versionedServer {
+	t.Helper()
+
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(file.UnwrapFile()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &versionedServer{}
+	srv := grpc.NewServer(
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if strings.HasPrefix(info.FullMethod, "/grpc.reflection.v1alpha.") {
+				s.v1alpha.Add(1)
+			} else {
+				s.v1.Add(1)
+			}
+			return handler(srv, ss)
+		}),
+		// Lets the interceptor see calls to the version the server doesn't speak
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			return status.Errorf(codes.Unimplemented, "unknown service %s", method)
+		}),
+	)
+	opts := reflection.ServerOptions{
+		Services:           serviceList{"spaceone.api.inventory.v1.Server": {}},
+		DescriptorResolver: files,
+	}
+	if v1 {
+		reflectionv1.RegisterServerReflectionServer(srv, reflection.NewServerV1(opts))
+	}
+	if v1alpha {
+		reflectionv1alpha.RegisterServerReflectionServer(srv, reflection.NewServer(opts))
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	s.conn, err = grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.conn.Close() })
+
+	return s
+}
+
+// resolveServer asks a new reflection client over conn for the Server service
+func resolveServer(conn grpc.ClientConnInterface) error {
+	client := NewReflectionClient(context.Background(), conn)
+	defer client.Reset()
+
+	_, err := client.ResolveService("spaceone.api.inventory.v1.Server")
+	return err
+}
+
+// savedReflectionVersions reads the versions remembered on disk
+func savedReflectionVersions(t *testing.T) map[string]string {
+	t.Helper()
+
+	path, err := reflectionVersionsPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := map[string]string{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return saved
+}
+
+func TestNewReflectionClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		v1, v1alpha bool
+		want        string
+	}{
+		{name: "both versions", v1: true, v1alpha: true, want: ReflectionV1},
+		{name: "v1 only", v1: true, want: ReflectionV1},
+		{name: "v1alpha only", v1alpha: true, want: ReflectionV1Alpha},
+	}
+
+	file := serverFile(t, "list")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			server := startVersionedServer(t, file, tt.v1, tt.v1alpha)
+			target := server.conn.Target()
+
+			if err := resolveServer(server.conn); err != nil {
+				t.Fatalf("ResolveService() error = %v", err)
+			}
+			if got := reflectionVersion(target); got != tt.want {
+				t.Errorf("remembered version = %q, want %q", got, tt.want)
+			}
+			if got := savedReflectionVersions(t)[target]; got != tt.want {
+				t.Errorf("saved version = %q, want %q", got, tt.want)
+			}
+			if tt.want == ReflectionV1 && server.v1alpha.Load() > 0 {
+				t.Errorf("a v1 server got %d v1alpha streams", server.v1alpha.Load())
+			}
+
+			// Later clients go straight to the remembered version
+			server.v1.Store(0)
+			server.v1alpha.Store(0)
+			if err := resolveServer(server.conn); err != nil {
+				t.Fatalf("ResolveService() with the version remembered error = %v", err)
+			}
+			if tt.want == ReflectionV1Alpha && server.v1.Load() > 0 {
+				t.Errorf("the remembered v1alpha server was probed again with %d v1 streams", server.v1.Load())
+			}
+		})
+	}
+}
+
+func TestNewReflectionClientForgetsStaleVersion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := startVersionedServer(t, serverFile(t, "list"), true, false)
+	target := server.conn.Target()
+
+	// The server was upgraded since v1alpha was remembered for it
+	setReflectionVersion(target, ReflectionV1Alpha)
+	if err := resolveServer(server.conn); err == nil {
+		t.Fatal("ResolveService() over v1alpha succeeded on a v1 only server")
+	}
+	if got := reflectionVersion(target); got != "" {
+		t.Errorf("remembered version = %q, want it forgotten", got)
+	}
+
+	if err := resolveServer(server.conn); err != nil {
+		t.Fatalf("ResolveService() after probing again error = %v", err)
+	}
+	if got := reflectionVersion(target); got != ReflectionV1 {
+		t.Errorf("remembered version = %q, want %q", got, ReflectionV1)
+	}
+}
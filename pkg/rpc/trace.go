@@ -0,0 +1,333 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Verbosity levels understood by Logf
+const (
+	// LevelInfo logs config resolution, endpoint discovery, dial targets and phase timings
+	LevelInfo = 1
+	// LevelCalls adds every gRPC call and HTTP request with its metadata and status
+	LevelCalls = 2
+	// LevelBodies adds request and response bodies, shortened to maxTracedBody
+	LevelBodies = 3
+	// LevelFullBodies logs bodies without shortening them
+	LevelFullBodies = 4
+)
+
+// Redacted replaces the value of secrets such as tokens and passwords in logs and plans
+const Redacted = "<redacted>"
+
+// maxTracedBody is how much of a body is logged below LevelFullBodies
+const maxTracedBody = 2048
+
+// Phase logs how long a step such as dial or invoke took once the returned func is called,
+// e.g. defer rpc.Phase("invoke")()
+func Phase(name string) func() {
+	start := time.Now()
+	return func() {
+		Logf(LevelInfo, "%s took %s", name, time.Since(start).Round(time.Microsecond))
+	}
+}
+
+// TraceDialOptions returns the interceptors that log every call made over a connection
+func TraceDialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(traceUnary),
+		grpc.WithChainStreamInterceptor(traceStream),
+		grpc.WithStatsHandler(payloadStats{}),
+	}
+}
+
+// payloadStats logs how many bytes each call sent and received, before and after compression
+type payloadStats struct{}
+
+// payloadCounts accumulates the payload sizes of a call. The two sides of a bidirectional
+// stream report them concurrently.
+type payloadCounts struct {
+	mu                   sync.Mutex
+	method               string
+	sent, sentCompressed int
+	recv, recvCompressed int
+}
+
+type payloadCountsKey struct{}
+
+func (payloadStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	if Verbosity() < LevelCalls {
+		return ctx
+	}
+	return context.WithValue(ctx, payloadCountsKey{}, &payloadCounts{method: info.FullMethodName})
+}
+
+func (payloadStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	counts, ok := ctx.Value(payloadCountsKey{}).(*payloadCounts)
+	if !ok {
+		return
+	}
+
+	counts.mu.Lock()
+	defer counts.mu.Unlock()
+
+	switch s := s.(type) {
+	case *stats.OutPayload:
+		counts.sent += s.Length
+		counts.sentCompressed += s.CompressedLength
+	case *stats.InPayload:
+		counts.recv += s.Length
+		counts.recvCompressed += s.CompressedLength
+	case *stats.End:
+		Logf(LevelCalls, "grpc %s sent %d bytes (%d on the wire), received %d bytes (%d on the wire)",
+			counts.method, counts.sent, counts.sentCompressed, counts.recv, counts.recvCompressed)
+	}
+}
+
+func (payloadStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (payloadStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func traceUnary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if Verbosity() < LevelCalls {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	Logf(LevelCalls, "grpc %s to %s, metadata: %s", method, cc.Target(), outgoingMetadata(ctx))
+	Logf(LevelBodies, "grpc %s request: %s", method, messageBody(req))
+
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	Logf(LevelCalls, "grpc %s returned %s in %s", method, status.Code(err), time.Since(start).Round(time.Microsecond))
+	if err == nil {
+		Logf(LevelBodies, "grpc %s response: %s", method, messageBody(reply))
+	}
+
+	return err
+}
+
+func traceStream(ctx context.Context, streamDesc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if Verbosity() < LevelCalls {
+		return streamer(ctx, streamDesc, cc, method, opts...)
+	}
+
+	Logf(LevelCalls, "grpc stream %s to %s, metadata: %s", method, cc.Target(), outgoingMetadata(ctx))
+
+	start := time.Now()
+	stream, err := streamer(ctx, streamDesc, cc, method, opts...)
+	if err != nil {
+		Logf(LevelCalls, "grpc stream %s failed to open with %s in %s", method, status.Code(err), time.Since(start).Round(time.Microsecond))
+		return nil, err
+	}
+
+	return &tracedStream{ClientStream: stream, method: method, start: start}, nil
+}
+
+// tracedStream logs the messages of a stream and how it ended
+type tracedStream struct {
+	grpc.ClientStream
+	method   string
+	start    time.Time
+	sent     int
+	received int
+}
+
+func (s *tracedStream) SendMsg(m interface{}) error {
+	Logf(LevelBodies, "grpc stream %s sent: %s", s.method, messageBody(m))
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
+
+func (s *tracedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+		Logf(LevelBodies, "grpc stream %s received: %s", s.method, messageBody(m))
+		return nil
+	}
+
+	result := status.Code(err).String()
+	if err == io.EOF {
+		result = "OK"
+	}
+	Logf(LevelCalls, "grpc stream %s ended with %s after %d sent and %d received in %s",
+		s.method, result, s.sent, s.received, time.Since(s.start).Round(time.Microsecond))
+	return err
+}
+
+// outgoingMetadata formats the metadata attached to ctx with credentials redacted
+func outgoingMetadata(ctx context.Context) string {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if len(md) == 0 {
+		return "none"
+	}
+
+	keys := make([]string, 0, len(md))
+	for key := range md {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(md[key], ",")
+		if IsSecretKey(key) {
+			value = Redacted
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// messageBody renders a request or response message as JSON with secrets redacted
+func messageBody(m interface{}) string {
+	var body []byte
+	var err error
+	switch msg := m.(type) {
+	case json.Marshaler:
+		body, err = msg.MarshalJSON()
+	case proto.Message:
+		body, err = protojson.Marshal(msg)
+	default:
+		return fmt.Sprintf("%v", m)
+	}
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return traceBody(body)
+}
+
+// traceBody redacts secrets in a JSON body and shortens it below LevelFullBodies
+func traceBody(body []byte) string {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		RedactSecrets(value)
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err == nil {
+			body = bytes.TrimSpace(buf.Bytes())
+		}
+	}
+
+	if Verbosity() < LevelFullBodies && len(body) > maxTracedBody {
+		return fmt.Sprintf("%s... (%d bytes, use --verbosity %d to see all)", body[:maxTracedBody], len(body), LevelFullBodies)
+	}
+	return string(body)
+}
+
+// RedactSecrets replaces the values of fields such as token, password or secret_data in a
+// decoded JSON value
+func RedactSecrets(v interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if IsSecretKey(key) {
+				value[key] = Redacted
+				continue
+			}
+			RedactSecrets(field)
+		}
+	case []interface{}:
+		for _, item := range value {
+			RedactSecrets(item)
+		}
+	}
+}
+
+// IsSecretKey reports whether the value of a field, header or metadata key is a credential
+func IsSecretKey(key string) bool {
+	name := strings.ToLower(key)
+	return strings.Contains(name, "token") || strings.Contains(name, "password") ||
+		strings.Contains(name, "secret") || name == "authorization"
+}
+
+// TraceTransport makes the requests sent through base show up in the log
+func TraceTransport(base http.RoundTripper) http.RoundTripper {
+	return &traceTransport{base: base}
+}
+
+// traceTransport is an http.RoundTripper that logs requests and responses
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Verbosity() < LevelCalls {
+		return t.base.RoundTrip(req)
+	}
+
+	Logf(LevelCalls, "http %s %s, headers: %s", req.Method, req.URL.Redacted(), requestHeaders(req.Header))
+	if Verbosity() >= LevelBodies && req.Body != nil && req.GetBody != nil {
+		// Read a copy so the body sent is left untouched
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			Logf(LevelBodies, "http %s %s request: %s", req.Method, req.URL.Redacted(), traceBody(data))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Microsecond)
+	if err != nil {
+		Logf(LevelCalls, "http %s %s failed in %s: %v", req.Method, req.URL.Redacted(), elapsed, err)
+		return nil, err
+	}
+	Logf(LevelCalls, "http %s %s returned %s in %s", req.Method, req.URL.Redacted(), resp.Status, elapsed)
+
+	if Verbosity() >= LevelBodies && resp.Body != nil {
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		if readErr != nil {
+			return nil, readErr
+		}
+		Logf(LevelBodies, "http %s %s response: %s", req.Method, req.URL.Redacted(), traceBody(data))
+	}
+
+	return resp, nil
+}
+
+// requestHeaders formats HTTP headers with credentials redacted
+func requestHeaders(header http.Header) string {
+	if len(header) == 0 {
+		return "none"
+	}
+
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(header[key], ",")
+		if IsSecretKey(key) {
+			value = Redacted
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,233 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// setVerbosity sets the verbosity for the rest of the test
+func setVerbosity(t *testing.T, level int) {
+	t.Helper()
+	previous := Verbosity()
+	SetVerbosity(level)
+	t.Cleanup(func() { SetVerbosity(previous) })
+}
+
+// captureStderr returns what fn writes to os.Stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestLogf(t *testing.T) {
+	tests := []struct {
+		name      string
+		verbosity int
+		level     int
+		want      string
+	}{
+		{name: "disabled", verbosity: 0, level: LevelInfo, want: ""},
+		{name: "below", verbosity: LevelInfo, level: LevelCalls, want: ""},
+		{name: "at", verbosity: LevelCalls, level: LevelCalls, want: "cfctl: dial grpc://a\n"},
+		{name: "above", verbosity: LevelFullBodies, level: LevelInfo, want: "cfctl: dial grpc://a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVerbosity(t, tt.verbosity)
+			got := captureStderr(t, func() { Logf(tt.level, "dial %s", "grpc://a") })
+			if got != tt.want {
+				t.Errorf("Logf() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSecretKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"token", true},
+		{"refresh_token", true},
+		{"accessToken", true},
+		{"password", true},
+		{"secret_data", true},
+		{"Authorization", true},
+		{"x-domain-id", false},
+		{"name", false},
+		{"authorization_type", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := IsSecretKey(tt.key); got != tt.want {
+				t.Errorf("IsSecretKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceBody(t *testing.T) {
+	long := `{"name":"` + strings.Repeat("x", maxTracedBody) + `"}`
+
+	tests := []struct {
+		name      string
+		verbosity int
+		body      string
+		want      string
+	}{
+		{
+			name:      "secrets redacted",
+			verbosity: LevelBodies,
+			body:      `{"user_id":"u-1","password":"hunter2","tags":{"token":"t"}}`,
+			want:      `{"password":"<redacted>","tags":{"token":"<redacted>"},"user_id":"u-1"}`,
+		},
+		{
+			name:      "secrets in lists redacted",
+			verbosity: LevelBodies,
+			body:      `{"results":[{"secret_data":{"key":"k"},"name":"a"}]}`,
+			want:      `{"results":[{"name":"a","secret_data":"<redacted>"}]}`,
+		},
+		{
+			name:      "not JSON",
+			verbosity: LevelBodies,
+			body:      `plain <text>`,
+			want:      `plain <text>`,
+		},
+		{
+			name:      "shortened",
+			verbosity: LevelBodies,
+			body:      long,
+			want:      long[:maxTracedBody] + "... (2059 bytes, use --verbosity 4 to see all)",
+		},
+		{
+			name:      "full",
+			verbosity: LevelFullBodies,
+			body:      long,
+			want:      long,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVerbosity(t, tt.verbosity)
+			if got := traceBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("traceBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutgoingMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want string
+	}{
+		{name: "none", md: nil, want: "none"},
+		{
+			name: "sorted and redacted",
+			md:   metadata.Pairs("x-domain-id", "d-1", "token", "secret", "authorization", "Bearer x", "x-tags", "a", "x-tags", "b"),
+			want: "authorization=<redacted> token=<redacted> x-domain-id=d-1 x-tags=a,b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewOutgoingContext(context.Background(), tt.md)
+			if got := outgoingMetadata(ctx); got != tt.want {
+				t.Errorf("outgoingMetadata() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"user_id":"u-1","refresh_token":"r"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		verbosity int
+		want      []string
+		wantNot   []string
+	}{
+		{name: "disabled", verbosity: 0, wantNot: []string{"http"}},
+		{
+			name:      "calls",
+			verbosity: LevelCalls,
+			want:      []string{"http POST " + server.URL + "/user/get, headers: Authorization=<redacted>", "returned 200 OK in"},
+			wantNot:   []string{"Bearer", "request:", "response:"},
+		},
+		{
+			name:      "bodies",
+			verbosity: LevelBodies,
+			want:      []string{`request: {"password":"<redacted>","user_id":"u-1"}`, `response: {"refresh_token":"<redacted>","user_id":"u-1"}`},
+			wantNot:   []string{"Bearer", "hunter2", `"r"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVerbosity(t, tt.verbosity)
+			client := &http.Client{Transport: TraceTransport(http.DefaultTransport)}
+
+			var body string
+			log := captureStderr(t, func() {
+				req, err := http.NewRequest(http.MethodPost, server.URL+"/user/get", strings.NewReader(`{"user_id":"u-1","password":"hunter2"}`))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Authorization", "Bearer secret")
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				b, _ := io.ReadAll(resp.Body)
+				body = string(b)
+			})
+
+			if body != `{"user_id":"u-1","refresh_token":"r"}` {
+				t.Errorf("the caller read %q, want the response body untouched", body)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(log, want) {
+					t.Errorf("log %q does not contain %q", log, want)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(log, unwanted) {
+					t.Errorf("log %q contains %q", log, unwanted)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cloudforet-io/cfctl/pkg/client"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
+	"github.com/pterm/pterm"
+	"google.golang.org/grpc/codes"
+)
+
+// ExitInterrupted is the exit code of a command stopped with Ctrl+C
+const ExitInterrupted = 130
+
+// reportedError is an error the user has already been shown, e.g. with the login guide.
+// It is kept only for its exit code and the JSON error output.
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reportedError) Unwrap() error {
+	return e.err
+}
+
+// ExitCode returns the process exit code for an error returned by FetchService:
+// 3 for authentication, 4 for not found, 5 for invalid arguments, 6 when the service is
+// unavailable or times out, 2 for configuration problems, 130 on Ctrl+C and 1 otherwise
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return client.ExitOK
+	case errors.Is(err, rpc.ErrInterrupted):
+		return ExitInterrupted
+	case errors.Is(err, rpc.ErrTimeout):
+		return client.ExitUnavailable
+	}
+	return client.ExitCode(err)
+}
+
+// ReportError shows err to the user. With -o json it is written to stderr as
+// {"error": {...}} so scripts can inspect it; otherwise it is printed as an error line,
+// unless it has already been explained.
+func ReportError(err error, outputFormat string) {
+	if outputFormat == "json" {
+		data, _ := json.Marshal(map[string]interface{}{"error": errorDetail(err)})
+		fmt.Fprintln(os.Stderr, string(data))
+		return
+	}
+
+	var reported *reportedError
+	if errors.As(err, &reported) {
+		return
+	}
+	pterm.Error.Println(err.Error())
+}
+
+// errorDetail describes err for the JSON error output
+func errorDetail(err error) map[string]interface{} {
+	detail := map[string]interface{}{
+		"message":   err.Error(),
+		"exit_code": ExitCode(err),
+		"kind":      client.KindUnknown.String(),
+	}
+
+	switch {
+	case errors.Is(err, rpc.ErrInterrupted):
+		detail["kind"] = "interrupted"
+	case errors.Is(err, rpc.ErrTimeout):
+		detail["kind"] = "timeout"
+	}
+
+	var clientErr *client.Error
+	if !errors.As(err, &clientErr) {
+		return detail
+	}
+
+	detail["kind"] = clientErr.Kind.String()
+	if clientErr.Code != codes.OK {
+		detail["code"] = client.CodeName(clientErr.Code)
+	}
+	if clientErr.ErrorCode != "" {
+		detail["error_code"] = clientErr.ErrorCode
+	}
+	if clientErr.Message != "" {
+		detail["server_message"] = clientErr.Message
+	}
+	if len(clientErr.Params) > 0 {
+		detail["params"] = clientErr.Params
+	}
+
+	return detail
+}
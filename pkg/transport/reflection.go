@@ -1,17 +1,14 @@
 package transport
 
 import (
-	"context"
-	"crypto/tls"
 	"fmt"
 	"log"
 	"net/url"
 	"strings"
 
-	"github.com/jhump/protoreflect/grpcreflect"
+	"github.com/cloudforet-io/cfctl/pkg/configs"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 )
 
 // ListGRPCServices retrieves a list of available gRPC services from the specified endpoint.
@@ -93,18 +90,11 @@ func CheckIdentityProxyAvailable(endpoint string) (bool, error) {
 
 // dialGRPC establishes a gRPC connection with the specified endpoint
 func dialGRPC(endpoint, host, port string) (*grpc.ClientConn, error) {
-	var opts []grpc.DialOption
-	if strings.HasPrefix(endpoint, "grpc+ssl://") {
-		tlsSetting := &tls.Config{
-			InsecureSkipVerify: false,
-		}
-		credential := credentials.NewTLS(tlsSetting)
-		opts = append(opts, grpc.WithTransportCredentials(credential))
-	} else {
+	if !strings.HasPrefix(endpoint, "grpc+ssl://") {
 		return nil, fmt.Errorf("unsupported scheme in endpoint: %s", endpoint)
 	}
 
-	conn, err := grpc.Dial(fmt.Sprintf("%s:%s", host, port), opts...)
+	conn, err := configs.Dial(fmt.Sprintf("%s:%s", host, port), true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial gRPC endpoint: %w", err)
 	}
@@ -113,13 +103,15 @@ func dialGRPC(endpoint, host, port string) (*grpc.ClientConn, error) {
 
 // listServices uses gRPC reflection to list available services
 func listServices(conn *grpc.ClientConn) ([]string, error) {
-	ctx := context.Background()
-	refClient := grpcreflect.NewClientV1Alpha(ctx, grpc_reflection_v1alpha.NewServerReflectionClient(conn))
+	ctx, cancel := rpc.Context()
+	defer cancel()
+
+	refClient := rpc.NewReflectionClient(ctx, conn)
 	defer refClient.Reset()
 
 	services, err := refClient.ListServices()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list services: %w", err)
+		return nil, fmt.Errorf("failed to list services: %w", rpc.ContextError(ctx, err))
 	}
 
 	return services, nil
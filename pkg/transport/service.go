@@ -1,11 +1,12 @@
 package transport
 
 import (
+	"bufio"
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,38 +18,22 @@ import (
 	"time"
 
 	"github.com/atotto/clipboard"
+	"github.com/cloudforet-io/cfctl/pkg/client"
 	"github.com/cloudforet-io/cfctl/pkg/configs"
 	"github.com/cloudforet-io/cfctl/pkg/format"
+	"github.com/cloudforet-io/cfctl/pkg/rpc"
 	"github.com/eiannone/keyboard"
+	"github.com/jhump/protoreflect/desc"
 	"github.com/pterm/pterm"
-	"github.com/spf13/viper"
-
-	"google.golang.org/grpc/metadata"
-
-	"github.com/jhump/protoreflect/dynamic"
-	"github.com/jhump/protoreflect/grpcreflect"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 
 	"gopkg.in/yaml.v3"
 )
 
-type Environment struct {
-	Endpoint string `yaml:"endpoint"`
-	Proxy    string `yaml:"proxy"`
-	Token    string `yaml:"token"`
-}
-
-type Config struct {
-	Environment  string                 `yaml:"environment"`
-	Environments map[string]Environment `yaml:"environments"`
-}
-
 // FetchOptions holds the flag values for a command
 type FetchOptions struct {
 	Parameters           []string
 	JSONParameter        string
+	JSONParameters       []string
 	FileParameter        string
 	APIVersion           string
 	OutputFormat         string
@@ -61,201 +46,48 @@ type FetchOptions struct {
 	Page                 int
 	PageSize             int
 	NoPaging             bool
+	AllPages             bool
+	AllPageSize          int
+	Filters              []string
+	Query                string
+	NoInteractive        bool
+	CSVDelimiter         string
+	NoHeaders            bool
+	MaxAttempts          int
+	ForceRetry           bool
+	DryRun               bool
+	Headers              []string
+	Token                string
+	TokenFile            string
+	MaxRecvSize          string
+	MaxSendSize          string
+	Compression          string
+	Authority            string
 }
 
 // FetchService handles the execution of gRPC commands for all services
 func FetchService(serviceName string, verb string, resourceName string, options *FetchOptions) (map[string]interface{}, error) {
-	homeDir, err := os.UserHomeDir()
+	setting, err := configs.SetSettingFile()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %v", err)
-	}
-
-	// Read configuration file
-	mainViper := viper.New()
-	mainViper.SetConfigFile(filepath.Join(homeDir, ".cfctl", "setting.yaml"))
-	mainViper.SetConfigType("yaml")
-	if err := mainViper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read configuration file. Please run 'cfctl login' first")
+		return nil, &client.Error{Kind: client.KindConfig, Err: fmt.Errorf("%v. Please run 'cfctl login' first", err)}
 	}
 
-	// Check current environment
-	currentEnv := mainViper.GetString("environment")
-	if currentEnv == "" {
-		return nil, fmt.Errorf("no environment set. Please run 'cfctl login' first")
-	}
+	currentEnv := setting.Environment
+	envConfig := setting.Environments[currentEnv]
 
-	// Load configuration first
-	config, err := loadConfig()
+	cli, err := client.New(currentEnv, envConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %v", err)
-	}
-
-	token := config.Environments[config.Environment].Token
-	if token == "" {
-		pterm.Error.Println("No token found for authentication.")
-
-		// Get current endpoint
-		endpoint := config.Environments[config.Environment].Endpoint
-
-		if config.Environment == "local" {
-			// Local environment message
-			pterm.Info.Printf("Using endpoint: %s\n", endpoint)
-			return nil, nil
-		} else if strings.HasSuffix(config.Environment, "-app") {
-			// App environment message
-			headerBox := pterm.DefaultBox.WithTitle("App Guide").
-				WithTitleTopCenter().
-				WithRightPadding(4).
-				WithLeftPadding(4).
-				WithBoxStyle(pterm.NewStyle(pterm.FgLightCyan))
-
-			appTokenExplain := "Please create a Domain Admin App in SpaceONE Console.\n" +
-				"This requires Domain Admin privilege.\n\n" +
-				"Or Please create a Workspace App in SpaceONE Console.\n" +
-				"This requires Workspace Owner privilege."
-
-			pterm.Info.Printf("Using endpoint: %s\n", endpoint)
-			headerBox.Println(appTokenExplain)
-			fmt.Println()
-
-			steps := []string{
-				"1. Go to SpaceONE Console",
-				"2. Navigate to either 'Admin > App Page' or specific 'Workspace > App page'",
-				"3. Click 'Create' to create your App",
-				"4. Copy value of either 'client_secret' from Client ID or 'token' from Spacectl (CLI)",
-			}
-
-			yamlExample := pterm.DefaultBox.WithTitle("Config Example").
-				WithTitleTopCenter().
-				WithRightPadding(4).
-				WithLeftPadding(4).
-				Sprint(fmt.Sprintf("environment: %s\nenvironments:\n    %s:\n        endpoint: %s\n        proxy: true\n        token: %s",
-					currentEnv,
-					currentEnv,
-					endpoint,
-					pterm.FgLightCyan.Sprint("YOUR_COPIED_TOKEN")))
-
-			instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
-				WithTitleTopCenter().
-				WithRightPadding(4).
-				WithLeftPadding(4)
-
-			allSteps := append(steps,
-				fmt.Sprintf("5. Add the token under the proxy in your config file:\n%s", yamlExample),
-				"6. Run 'cfctl login' again")
-
-			instructionBox.Println(strings.Join(allSteps, "\n\n"))
-
-		} else if strings.HasSuffix(config.Environment, "-user") {
-			// User environment message
-			headerBox := pterm.DefaultBox.WithTitle("Authentication Required").
-				WithTitleTopCenter().
-				WithRightPadding(4).
-				WithLeftPadding(4).
-				WithBoxStyle(pterm.NewStyle(pterm.FgLightCyan))
-
-			authExplain := "Please login to SpaceONE Console first.\n" +
-				"This requires your SpaceONE credentials."
-
-			headerBox.Println(authExplain)
-			fmt.Println()
-
-			steps := []string{
-				"1. Run 'cfctl login'",
-				"2. Enter your credentials when prompted",
-				"3. Select your scope",
-				"4. Try your command again",
-			}
-
-			instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
-				WithTitleTopCenter().
-				WithRightPadding(4).
-				WithLeftPadding(4)
-
-			instructionBox.Println(strings.Join(steps, "\n\n"))
-		}
-
-		return nil, nil
-	}
-
-	// Get hostPort based on environment prefix
-	var hostPort string
-	var apiEndpoint string
-	var identityEndpoint string
-	var hasIdentityService bool
-	if strings.HasPrefix(config.Environments[config.Environment].Endpoint, "grpc://") {
-		hostPort = strings.TrimPrefix(config.Environments[config.Environment].Endpoint, "grpc://")
-	} else {
-		apiEndpoint, err = configs.GetAPIEndpoint(config.Environments[config.Environment].Endpoint)
-		if err != nil {
-			pterm.Error.Printf("Failed to get API endpoint: %v\n", err)
-			os.Exit(1)
-		}
-		// Get identity service endpoint
-		identityEndpoint, hasIdentityService, err = configs.GetIdentityEndpoint(apiEndpoint)
-		if err != nil {
-			pterm.Error.Printf("Failed to get identity endpoint: %v\n", err)
-			os.Exit(1)
-		}
-
-		if !hasIdentityService {
-			urlParts := strings.Split(apiEndpoint, "//")
-			if len(urlParts) != 2 {
-				return nil, fmt.Errorf("invalid API endpoint format: %s", apiEndpoint)
-			}
-
-			domainParts := strings.Split(urlParts[1], ".")
-			if len(domainParts) > 0 {
-				port := extractPortFromParts(domainParts)
-				if strings.Contains(domainParts[len(domainParts)-1], ":") {
-					parts := strings.Split(domainParts[len(domainParts)-1], ":")
-					domainParts[len(domainParts)-1] = parts[0]
-				}
-
-				domainParts[0] = format.ConvertServiceName(serviceName)
-				hostPort = strings.Join(domainParts, ".") + port
-			}
-		} else {
-			trimmedEndpoint := strings.TrimPrefix(identityEndpoint, "grpc+ssl://")
-			parts := strings.Split(trimmedEndpoint, ".")
-			if len(parts) < 4 {
-				return nil, fmt.Errorf("invalid endpoint format: %s", trimmedEndpoint)
-			}
-
-			// Replace 'identity' with the converted service name
-			parts[0] = format.ConvertServiceName(serviceName)
-			hostPort = strings.Join(parts, ".")
-		}
+		return nil, err
 	}
-
-	// Configure gRPC connection
-	var conn *grpc.ClientConn
-	if strings.HasPrefix(config.Environments[config.Environment].Endpoint, "grpc://") {
-		hostPort := strings.TrimPrefix(config.Environments[config.Environment].Endpoint, "grpc://")
-		// For local environment, use insecure connection
-		conn, err = grpc.Dial(hostPort, grpc.WithInsecure())
-		if err != nil {
-			pterm.Error.Printf("Cannot connect to local gRPC server (%s)\n", hostPort)
-			pterm.Info.Println("Please check if your gRPC server is running")
-			return nil, fmt.Errorf("failed to connect to local server: %v", err)
-		}
-	} else {
-		// Existing SSL connection logic for non-local environments
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false,
-		}
-		creds := credentials.NewTLS(tlsConfig)
-		conn, err = grpc.Dial(hostPort, grpc.WithTransportCredentials(creds))
-		if err != nil {
-			return nil, fmt.Errorf("connection failed: %v", err)
-		}
+	applyRetryOptions(cli, options)
+	if err := applyCallOverrides(cli, options); err != nil {
+		return nil, err
 	}
-	defer conn.Close()
+	tokenOverridden := options.Token != "" || options.TokenFile != ""
 
-	// Create reflection client for both service calls and minimal fields detection
-	ctx := metadata.AppendToOutgoingContext(context.Background(), "token", config.Environments[config.Environment].Token)
-	refClient := grpcreflect.NewClient(ctx, grpc_reflection_v1alpha.NewServerReflectionClient(conn))
-	defer refClient.Reset()
+	// Every call below shares one context, cancelled by Ctrl+C or --timeout
+	ctx, cancel := rpc.Context()
+	defer cancel()
 
 	// Check for alias
 	aliases, err := configs.ListAliases()
@@ -282,6 +114,7 @@ func FetchService(serviceName string, verb string, resourceName string, options
 					newOptions := &FetchOptions{
 						Parameters:           options.Parameters,
 						JSONParameter:        options.JSONParameter,
+						JSONParameters:       options.JSONParameters,
 						FileParameter:        options.FileParameter,
 						APIVersion:           options.APIVersion,
 						OutputFormat:         options.OutputFormat,
@@ -289,6 +122,23 @@ func FetchService(serviceName string, verb string, resourceName string, options
 						CopyToClipboard:      options.CopyToClipboard,
 						MinimalColumns:       false, // Always show all columns for alias
 						PageSize:             15,    // Default page size
+						AllPages:             options.AllPages,
+						AllPageSize:          options.AllPageSize,
+						Filters:              options.Filters,
+						Query:                options.Query,
+						NoInteractive:        options.NoInteractive,
+						CSVDelimiter:         options.CSVDelimiter,
+						NoHeaders:            options.NoHeaders,
+						MaxAttempts:          options.MaxAttempts,
+						ForceRetry:           options.ForceRetry,
+						DryRun:               options.DryRun,
+						Headers:              options.Headers,
+						Token:                options.Token,
+						TokenFile:            options.TokenFile,
+						MaxRecvSize:          options.MaxRecvSize,
+						MaxSendSize:          options.MaxSendSize,
+						Compression:          options.Compression,
+						Authority:            options.Authority,
 					}
 
 					options = newOptions
@@ -297,64 +147,107 @@ func FetchService(serviceName string, verb string, resourceName string, options
 		}
 	}
 
-	// Call the service
-	jsonBytes, err := fetchJSONResponse(config, serviceName, verb, resourceName, options, apiEndpoint, identityEndpoint, hasIdentityService)
-	if err != nil {
-		// Check if the error is about missing required parameters
-		if strings.Contains(err.Error(), "ERROR_REQUIRED_PARAMETER") {
-			// Extract parameter name from error message
-			paramName := extractParameterName(err.Error())
-			if paramName != "" {
-				return nil, fmt.Errorf("missing required parameter: %s", paramName)
-			}
+	if verb == "list" && options.Page > 0 {
+		options.Parameters = append(options.Parameters,
+			fmt.Sprintf("page=%d", options.Page),
+			fmt.Sprintf("page_size=%d", options.PageSize))
+	}
+
+	var sortKeys []client.SortKey
+	if options.SortBy != "" && verb == "list" {
+		sortKeys, err = client.ParseSort(options.SortBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var query *format.Query
+	if options.Query != "" {
+		query, err = format.CompileQuery(options.Query)
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	// Catch output format mistakes before calling the service
+	if _, _, err := format.NewPrinter(options.OutputFormat); err != nil {
+		return nil, err
+	}
+	if _, err := csvDelimiter(options); err != nil {
 		return nil, err
 	}
 
-	// Unmarshal JSON bytes to a map
-	var respMap map[string]interface{}
-	if err = json.Unmarshal(jsonBytes, &respMap); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	// The method kind decides how requests are sent and responses printed. Resolution
+	// errors are left for the call itself to report.
+	methodDesc, _ := cli.ResolveMethod(ctx, serviceName, resourceName, verb)
+
+	// Client streams read their requests as they are sent, so -f is not loaded up front
+	if methodDesc != nil && methodDesc.IsClientStreaming() {
+		if options.DryRun {
+			return nil, dryRunRequests(ctx, cli, serviceName, resourceName, verb, options)
+		}
+		response, err := streamRequests(ctx, cli, methodDesc, serviceName, resourceName, verb, query, options)
+		if err != nil {
+			return nil, fetchError(ctx, err, currentEnv, envConfig.Endpoint, tokenOverridden)
+		}
+		return response, nil
+	}
+
+	if len(options.JSONParameters) > 1 {
+		return nil, fmt.Errorf("'%s %s' takes a single request: -j can only be repeated for client-streaming methods", verb, resourceName)
+	}
+
+	inputParams, err := parseParameters(options)
+	if err != nil {
+		return nil, err
 	}
 
+	if options.DryRun {
+		if _, err := buildQuery(ctx, cli, serviceName, resourceName, verb, inputParams, sortKeys, options); err != nil {
+			return nil, err
+		}
+		plan, err := cli.Plan(ctx, serviceName, resourceName, verb, inputParams)
+		if err != nil {
+			return nil, fetchError(ctx, err, currentEnv, envConfig.Endpoint, tokenOverridden)
+		}
+		return nil, printPlan(plan, options)
+	}
+
+	// Server streams printed as NDJSON are written message by message instead of buffered
+	if streamsNDJSON(methodDesc, options) {
+		handle := func(msg client.Result) error {
+			return printNDJSON(map[string]interface{}(msg), query)
+		}
+		_, _, err := invoke(ctx, cli, serviceName, resourceName, verb, inputParams, sortKeys, options, handle)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			// Interrupted with Ctrl+C; everything received so far has been printed
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fetchError(ctx, err, currentEnv, envConfig.Endpoint, tokenOverridden)
+		}
+		return nil, nil
+	}
+
+	// Call the service
+	result, applied, err := invoke(ctx, cli, serviceName, resourceName, verb, inputParams, sortKeys, options, nil)
+	if err != nil {
+		return nil, fetchError(ctx, err, currentEnv, envConfig.Endpoint, tokenOverridden)
+	}
+	respMap := map[string]interface{}(result)
+
 	// Print the data if not in watch mode
 	if options.OutputFormat != "" {
-		if options.SortBy != "" && verb == "list" {
-			if results, ok := respMap["results"].([]interface{}); ok {
-				// Sort the results by the specified field
-				sort.Slice(results, func(i, j int) bool {
-					iMap := results[i].(map[string]interface{})
-					jMap := results[j].(map[string]interface{})
-
-					iVal, iOk := iMap[options.SortBy]
-					jVal, jOk := jMap[options.SortBy]
-
-					// Handle cases where the field doesn't exist
-					if !iOk && !jOk {
-						return false
-					} else if !iOk {
-						return false
-					} else if !jOk {
-						return true
-					}
+		defer rpc.Phase("render")()
 
-					// Compare based on type
-					switch v := iVal.(type) {
-					case string:
-						return v < jVal.(string)
-					case float64:
-						return v < jVal.(float64)
-					case bool:
-						return v && !jVal.(bool)
-					default:
-						return false
-					}
-				})
+		if sortKeys != nil && !applied.sort {
+			if results, ok := respMap["results"].([]interface{}); ok {
+				sortResults(results, sortKeys)
 				respMap["results"] = results
 			}
 		}
 
-		if options.Rows > 0 && verb == "list" {
+		if options.Rows > 0 && verb == "list" && !applied.limit {
 			if results, ok := respMap["results"].([]interface{}); ok {
 				if len(results) > options.Rows {
 					respMap["results"] = results[:options.Rows]
@@ -372,8 +265,9 @@ func FetchService(serviceName string, verb string, resourceName string, options
 					if resultMap, ok := result.(map[string]interface{}); ok {
 						filteredMap := make(map[string]interface{})
 						for _, col := range columns {
-							if val, exists := resultMap[strings.TrimSpace(col)]; exists {
-								filteredMap[strings.TrimSpace(col)] = val
+							key, val, exists := lookupField(resultMap, strings.TrimSpace(col))
+							if exists {
+								filteredMap[key] = val
 							}
 						}
 						filteredResults[i] = filteredMap
@@ -383,362 +277,823 @@ func FetchService(serviceName string, verb string, resourceName string, options
 			}
 		}
 
-		printData(respMap, options, serviceName, verb, resourceName, refClient)
+		if query != nil && options.OutputFormat == "ndjson" {
+			if err := printNDJSON(respMap, query); err != nil {
+				return nil, err
+			}
+		} else if query != nil {
+			value, err := query.Apply(respMap)
+			if err != nil {
+				return nil, err
+			}
+			printQueryResult(value, options, serviceName, verb, resourceName, cli)
+		} else {
+			printData(respMap, options, serviceName, verb, resourceName, cli)
+		}
 	}
 
 	return respMap, nil
 }
 
-// extractParameterName extracts the parameter name from the error message
-func extractParameterName(errMsg string) string {
-	if strings.Contains(errMsg, "Required parameter. (key = ") {
-		start := strings.Index(errMsg, "key = ") + 6
-		end := strings.Index(errMsg[start:], ")")
-		if end != -1 {
-			return errMsg[start : start+end]
+// applyRetryOptions adds the --max-attempts and --force-retry flags to the retry policy of
+// the environment and logs each retry in verbose mode
+func applyRetryOptions(cli *client.Client, options *FetchOptions) {
+	policy := cli.RetryPolicy()
+	if options.MaxAttempts > 0 {
+		policy.MaxAttempts = options.MaxAttempts
+	}
+	if options.ForceRetry {
+		policy.Force = true
+	}
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		rpc.Logf(rpc.LevelInfo, "attempt %d of %d failed: %v; retrying in %s", attempt, policy.MaxAttempts, err, delay.Round(time.Millisecond))
+	}
+	cli.SetRetryPolicy(policy)
+}
+
+// applyCallOverrides adds the -H metadata and the --token or --token-file override to the
+// client, leaving setting.yaml untouched
+func applyCallOverrides(cli *client.Client, options *FetchOptions) error {
+	for _, header := range options.Headers {
+		key, value, ok := strings.Cut(header, "=")
+		if !ok {
+			return &client.Error{Kind: client.KindInvalidArgument, Err: fmt.Errorf("invalid header '%s': expected key=value", header)}
+		}
+		if err := cli.AddHeader(key, value); err != nil {
+			return err
 		}
 	}
-	return ""
+
+	if options.Token != "" && options.TokenFile != "" {
+		return &client.Error{Kind: client.KindInvalidArgument, Err: fmt.Errorf("--token and --token-file can't be used together")}
+	}
+
+	token := options.Token
+	if options.TokenFile != "" {
+		data, err := os.ReadFile(options.TokenFile)
+		if err != nil {
+			return &client.Error{Kind: client.KindInvalidArgument, Op: "failed to read token file", Err: err}
+		}
+		token = strings.TrimSpace(string(data))
+		if token == "" {
+			return &client.Error{Kind: client.KindInvalidArgument, Err: fmt.Errorf("token file %s is empty", options.TokenFile)}
+		}
+	}
+
+	if token != "" {
+		rpc.Logf(rpc.LevelInfo, "using the token given on the command line instead of environment %s's", cli.Environment())
+		cli.SetToken(token)
+	}
+
+	if options.Authority != "" {
+		if err := configs.ValidateAuthority(options.Authority); err != nil {
+			return &client.Error{Kind: client.KindInvalidArgument, Err: err}
+		}
+		cli.SetAuthority(options.Authority)
+	}
+
+	return applyMessageOverrides(cli, options)
 }
 
-func extractPortFromParts(parts []string) string {
-	if len(parts) == 0 {
-		return ":443"
+// applyMessageOverrides sets the message size limits and compression given on the command
+// line over those of the environment
+func applyMessageOverrides(cli *client.Client, options *FetchOptions) error {
+	if options.MaxRecvSize == "" && options.MaxSendSize == "" && options.Compression == "" {
+		return nil
 	}
 
-	lastPart := parts[len(parts)-1]
-	if strings.Contains(lastPart, ":") {
-		portParts := strings.Split(lastPart, ":")
-		if len(portParts) == 2 {
-			return ":" + portParts[1]
+	messages := cli.MessageOptions()
+	if options.MaxRecvSize != "" {
+		size, err := configs.ParseByteSize(options.MaxRecvSize)
+		if err != nil {
+			return &client.Error{Kind: client.KindInvalidArgument, Err: fmt.Errorf("invalid --max-recv-size: %v", err)}
+		}
+		messages.MaxRecvSize = size
+	}
+	if options.MaxSendSize != "" {
+		size, err := configs.ParseByteSize(options.MaxSendSize)
+		if err != nil {
+			return &client.Error{Kind: client.KindInvalidArgument, Err: fmt.Errorf("invalid --max-send-size: %v", err)}
 		}
+		messages.MaxSendSize = size
+	}
+	switch options.Compression {
+	case "":
+	case "none":
+		messages.Compression = ""
+	default:
+		messages.Compression = options.Compression
 	}
 
-	return ":443"
+	return cli.SetMessageOptions(messages)
 }
 
-// promptForParameter prompts the user to enter a value for the given parameter
-func promptForParameter(paramName string) (string, error) {
-	prompt := fmt.Sprintf("Please enter value for '%s'", paramName)
-	result, err := pterm.DefaultInteractiveTextInput.WithDefaultText("").Show(prompt)
+// dryRunRequests checks every request a client stream would send and prints the plan
+func dryRunRequests(ctx context.Context, cli *client.Client, serviceName, resourceName, verb string, options *FetchOptions) error {
+	next, closeSource, err := requestSource(options)
 	if err != nil {
-		return "", fmt.Errorf("failed to read input: %v", err)
+		return err
 	}
-	return result, nil
+	defer closeSource()
+
+	plan, err := cli.PlanRequests(ctx, serviceName, resourceName, verb, next)
+	if err != nil {
+		return rpc.ContextError(ctx, err)
+	}
+	return printPlan(plan, options)
 }
 
-func loadConfig() (*Config, error) {
-	home, err := os.UserHomeDir()
+// printPlan prints what a --dry-run would have sent, as JSON for -o json and YAML otherwise
+func printPlan(plan *client.Plan, options *FetchOptions) error {
+	if options.OutputFormat == "json" {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(plan); err != nil {
+		return err
+	}
+	fmt.Print(buf.String())
+	return nil
+}
+
+// fetchError prints the token or authentication guide for auth failures and returns
+// the error FetchService should report. Timeouts and interrupts are reported as such
+// rather than as failed calls.
+func fetchError(ctx context.Context, err error, currentEnv, endpoint string, tokenOverridden bool) error {
+	if ctx.Err() != nil {
+		return rpc.ContextError(ctx, err)
+	}
+	// The setting guides don't apply to a token given with --token or --token-file
+	if tokenOverridden {
+		return err
+	}
+	if errors.Is(err, client.ErrNoToken) {
+		printTokenGuide(currentEnv, endpoint)
+		return &reportedError{err: err}
+	}
+	if client.IsKind(err, client.KindAuth) {
+		pterm.Error.Println(printAuthenticationGuide(currentEnv))
+		return &reportedError{err: err}
+	}
+	return err
+}
+
+// streamsNDJSON reports whether the response is a server stream to be printed as NDJSON,
+// either because -o ndjson was given or because output is piped without an explicit -o
+func streamsNDJSON(methodDesc *desc.MethodDescriptor, options *FetchOptions) bool {
+	if methodDesc == nil || !methodDesc.IsServerStreaming() {
+		return false
+	}
+
+	switch {
+	case options.OutputFormat == "ndjson":
+	case options.OutputFormat != "" && !options.OutputFormatExplicit && !format.IsTerminal(os.Stdout):
+	default:
+		return false
+	}
+
+	options.OutputFormat = "ndjson"
+	return true
+}
+
+// streamRequests calls a client-streaming or bidirectional method with the request
+// messages of requestSource. The single response of a client stream is printed like any
+// other response; the responses of a bidirectional stream are printed as they arrive,
+// as NDJSON unless another format was asked for.
+func streamRequests(ctx context.Context, cli *client.Client, methodDesc *desc.MethodDescriptor, serviceName, resourceName, verb string, query *format.Query, options *FetchOptions) (map[string]interface{}, error) {
+	next, closeSource, err := requestSource(options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %v", err)
+		return nil, err
 	}
+	defer closeSource()
 
-	// Load main configuration file
-	mainV := viper.New()
-	mainConfigPath := filepath.Join(home, ".cfctl", "setting.yaml")
-	mainV.SetConfigFile(mainConfigPath)
-	mainV.SetConfigType("yaml")
-	if err := mainV.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
+	bidi := methodDesc.IsServerStreaming()
+	if bidi && options.OutputFormat != "" && !options.OutputFormatExplicit {
+		options.OutputFormat = "ndjson"
 	}
 
-	currentEnv := mainV.GetString("environment")
-	if currentEnv == "" {
-		return nil, fmt.Errorf("no environment set in config")
+	var last map[string]interface{}
+	received := 0
+	handle := func(msg client.Result) error {
+		last = map[string]interface{}(msg)
+		received++
+		if !bidi || options.OutputFormat == "" {
+			return nil
+		}
+
+		switch {
+		case options.OutputFormat == "ndjson":
+			return printNDJSON(last, query)
+		case options.OutputFormat == "yaml" && received > 1:
+			fmt.Println("---")
+		}
+		printResponse(last, query, options, serviceName, verb, resourceName, cli)
+		return nil
 	}
 
-	// Get environment config from main config file
-	envConfig := &Environment{
-		Endpoint: mainV.GetString(fmt.Sprintf("environments.%s.endpoint", currentEnv)),
-		Proxy:    mainV.GetString(fmt.Sprintf("environments.%s.proxy", currentEnv)),
-		Token:    mainV.GetString(fmt.Sprintf("environments.%s.token", currentEnv)),
+	err = cli.StreamRequests(ctx, serviceName, resourceName, verb, next, handle)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// Interrupted with Ctrl+C; responses received so far have been printed
+		return last, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Handle token based on environment type
-	if strings.HasSuffix(currentEnv, "-user") {
-		// For user environments, read from access_token file (Actual token is grant_token)
-		grantTokenPath := filepath.Join(home, ".cfctl", "cache", currentEnv, "access_token")
-		tokenBytes, err := os.ReadFile(grantTokenPath)
-		if err == nil {
-			envConfig.Token = strings.TrimSpace(string(tokenBytes))
+	if !bidi && last != nil && options.OutputFormat != "" {
+		if options.OutputFormat == "ndjson" {
+			return last, printNDJSON(last, query)
 		}
-	} else if strings.HasSuffix(currentEnv, "-app") {
-		// For app environments, get token from main config
-		envConfig.Token = mainV.GetString(fmt.Sprintf("environments.%s.token", currentEnv))
-	} else if currentEnv == "local" {
-		// For local environment, get token from main config
-		envConfig.Token = mainV.GetString(fmt.Sprintf("environments.%s.token", currentEnv))
+		printResponse(last, query, options, serviceName, verb, resourceName, cli)
 	}
 
-	if envConfig == nil {
-		return nil, fmt.Errorf("environment '%s' not found in config files", currentEnv)
+	return last, nil
+}
+
+// printResponse prints a response through --query when one is given
+func printResponse(data map[string]interface{}, query *format.Query, options *FetchOptions, serviceName, verb, resourceName string, cli *client.Client) {
+	if query == nil {
+		printData(data, options, serviceName, verb, resourceName, cli)
+		return
 	}
 
-	return &Config{
-		Environment: currentEnv,
-		Environments: map[string]Environment{
-			currentEnv: *envConfig,
-		},
-	}, nil
+	value, err := query.Apply(data)
+	if err != nil {
+		pterm.Error.Println(err)
+		return
+	}
+	printQueryResult(value, options, serviceName, verb, resourceName, cli)
 }
 
-func fetchJSONResponse(config *Config, serviceName string, verb string, resourceName string, options *FetchOptions, apiEndpoint, identityEndpoint string, hasIdentityService bool) ([]byte, error) {
-	var conn *grpc.ClientConn
-	var err error
-	var hostPort string
+// requestSource returns the request messages of a client stream, read in order from
+//   - -f <file>: YAML documents, or JSON values for .json, .jsonl and .ndjson files
+//   - -f -: NDJSON or YAML documents on stdin
+//   - every -j value
+//   - stdin, when it is piped and neither -f nor -j is given
+//
+// Values given with -p are added to every message. Without any of the above, the -p
+// values are sent as the only message.
+func requestSource(options *FetchOptions) (client.RequestSource, func(), error) {
+	overrides, err := parseParameters(&FetchOptions{Parameters: options.Parameters})
+	if err != nil {
+		return nil, nil, err
+	}
+	base := overrides
 
-	if verb == "list" && options.Page > 0 {
-		options.Parameters = append(options.Parameters,
-			fmt.Sprintf("page=%d", options.Page),
-			fmt.Sprintf("page_size=%d", options.PageSize))
+	merge := func(doc map[string]interface{}) map[string]interface{} {
+		msg := make(map[string]interface{}, len(doc)+len(overrides))
+		for k, v := range doc {
+			msg[k] = v
+		}
+		for k, v := range overrides {
+			msg[k] = v
+		}
+		return msg
 	}
 
-	if strings.HasPrefix(config.Environments[config.Environment].Endpoint, "grpc://") {
-		hostPort = strings.TrimPrefix(config.Environments[config.Environment].Endpoint, "grpc://")
-		conn, err = grpc.Dial(hostPort, grpc.WithInsecure(),
-			grpc.WithDefaultCallOptions(
-				grpc.MaxCallRecvMsgSize(10*1024*1024),
-				grpc.MaxCallSendMsgSize(10*1024*1024),
-			))
+	noop := func() {}
+
+	switch {
+	case len(options.JSONParameters) > 0:
+		docs := options.JSONParameters
+		return func() (map[string]interface{}, error) {
+			if len(docs) == 0 {
+				return nil, io.EOF
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal([]byte(docs[0]), &doc); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal JSON parameter: %v", err)
+			}
+			docs = docs[1:]
+			return merge(doc), nil
+		}, noop, nil
+
+	case options.FileParameter == "-" || (options.FileParameter == "" && !format.IsTerminal(os.Stdin)):
+		return documentSource(os.Stdin, "", merge, base), noop, nil
+
+	case options.FileParameter != "":
+		file, err := os.Open(options.FileParameter)
 		if err != nil {
-			return nil, fmt.Errorf("connection failed: unable to connect to local server: %v", err)
+			return nil, nil, fmt.Errorf("failed to read file parameter: %v", err)
 		}
-	} else {
-		if !hasIdentityService {
-			// Handle gRPC+SSL protocol directly
-			if strings.HasPrefix(config.Environments[config.Environment].Endpoint, "grpc+ssl://") {
-				endpoint := config.Environments[config.Environment].Endpoint
-				parts := strings.Split(endpoint, "/")
-				endpoint = strings.Join(parts[:len(parts)-1], "/")
-				parts = strings.Split(endpoint, "://")
-				if len(parts) != 2 {
-					return nil, fmt.Errorf("invalid endpoint format: %s", endpoint)
-				}
+		return documentSource(file, options.FileParameter, merge, base), func() { file.Close() }, nil
+	}
 
-				hostParts := strings.Split(parts[1], ".")
-				if len(hostParts) < 4 {
-					return nil, fmt.Errorf("invalid endpoint format: %s", endpoint)
-				}
+	sent := false
+	return func() (map[string]interface{}, error) {
+		if sent {
+			return nil, io.EOF
+		}
+		sent = true
+		return base, nil
+	}, noop, nil
+}
 
-				// Replace service name
-				hostParts[0] = format.ConvertServiceName(serviceName)
-				hostPort = strings.Join(hostParts, ".")
-			} else {
-				// Original HTTP/HTTPS handling
-				urlParts := strings.Split(apiEndpoint, "//")
-				if len(urlParts) != 2 {
-					return nil, fmt.Errorf("invalid API endpoint format: %s", apiEndpoint)
-				}
+// documentDecoder is satisfied by both json.Decoder and yaml.Decoder
+type documentDecoder interface {
+	Decode(v interface{}) error
+}
 
-				domainParts := strings.Split(urlParts[1], ".")
-				if len(domainParts) > 0 {
-					port := extractPortFromParts(domainParts)
-					if strings.Contains(domainParts[len(domainParts)-1], ":") {
-						parts := strings.Split(domainParts[len(domainParts)-1], ":")
-						domainParts[len(domainParts)-1] = parts[0]
-					}
+// documentSource reads request messages one at a time from r, so that requests typed
+// on stdin are sent as soon as they are complete. Input without a single document
+// sends base instead.
+func documentSource(r io.Reader, name string, merge func(map[string]interface{}) map[string]interface{}, base map[string]interface{}) client.RequestSource {
+	reader := bufio.NewReader(r)
+	var decoder documentDecoder
+	sent := 0
+
+	return func() (map[string]interface{}, error) {
+		if decoder == nil {
+			decoder = newDocumentDecoder(reader, name)
+		}
 
-					domainParts[0] = format.ConvertServiceName(serviceName)
-					hostPort = strings.Join(domainParts, ".") + port
+		for {
+			var doc map[string]interface{}
+			err := decoder.Decode(&doc)
+			if err == io.EOF {
+				if sent == 0 {
+					sent++
+					return base, nil
 				}
+				return nil, io.EOF
 			}
-		} else {
-			trimmedEndpoint := strings.TrimPrefix(identityEndpoint, "grpc+ssl://")
-			parts := strings.Split(trimmedEndpoint, ".")
-			if len(parts) < 4 {
-				return nil, fmt.Errorf("invalid endpoint format: %s", trimmedEndpoint)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse request %d: %v", sent+1, err)
 			}
-
-			// Replace 'identity' with the converted service name
-			parts[0] = format.ConvertServiceName(serviceName)
-			hostPort = strings.Join(parts, ".")
+			// Empty YAML documents, such as a trailing ---, carry no request
+			if doc == nil {
+				continue
+			}
+			sent++
+			return merge(doc), nil
 		}
+	}
+}
 
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false,
-		}
-		creds := credentials.NewTLS(tlsConfig)
+// newDocumentDecoder decodes JSON values for .json, .jsonl and .ndjson files and for
+// input starting with '{', and YAML documents otherwise
+func newDocumentDecoder(reader *bufio.Reader, name string) documentDecoder {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".jsonl", ".ndjson":
+		return json.NewDecoder(reader)
+	case ".yaml", ".yml":
+		return yaml.NewDecoder(reader)
+	}
 
-		conn, err = grpc.Dial(hostPort,
-			grpc.WithTransportCredentials(creds),
-			grpc.WithDefaultCallOptions(
-				grpc.MaxCallRecvMsgSize(10*1024*1024),
-				grpc.MaxCallSendMsgSize(10*1024*1024),
-			))
+	for {
+		b, err := reader.Peek(1)
 		if err != nil {
-			return nil, fmt.Errorf("connection failed: unable to connect to %s: %v", hostPort, err)
+			return yaml.NewDecoder(reader)
 		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+			continue
+		case '{':
+			return json.NewDecoder(reader)
+		}
+		return yaml.NewDecoder(reader)
 	}
+}
 
-	defer func(conn *grpc.ClientConn) {
-		err := conn.Close()
+// printNDJSON writes data as newline delimited JSON: one line per item of a results list,
+// or one line for any other message. With a query, each value it produces is a line.
+func printNDJSON(data map[string]interface{}, query *format.Query) error {
+	var lines []interface{}
+	if query != nil {
+		values, err := query.Run(data)
 		if err != nil {
+			return err
+		}
+		lines = values
+	} else if results, ok := data["results"].([]interface{}); ok {
+		lines = results
+	} else {
+		lines = []interface{}{data}
+	}
 
+	for _, line := range lines {
+		b, err := json.Marshal(line)
+		if err != nil {
+			return fmt.Errorf("failed to marshal response to JSON: %v", err)
+		}
+		// os.Stdout is unbuffered, so every line reaches the reader as soon as it is written
+		if _, err := os.Stdout.Write(append(b, '\n')); err != nil {
+			return err
 		}
-	}(conn)
+	}
+	return nil
+}
 
-	ctx := metadata.AppendToOutgoingContext(context.Background(), "token", config.Environments[config.Environment].Token)
-	refClient := grpcreflect.NewClient(ctx, grpc_reflection_v1alpha.NewServerReflectionClient(conn))
-	defer refClient.Reset()
+// serverSide records which of the list flags were sent to the server in the query
+type serverSide struct {
+	sort  bool
+	limit bool
+}
 
-	fullServiceName, err := discoverService(refClient, serviceName, resourceName)
+// invoke compiles the query flags into inputParams and calls the service.
+// Flags the request's query cannot express are left for the caller to apply locally.
+// With a non-nil handle the response is streamed to it instead of being returned.
+func invoke(ctx context.Context, cli *client.Client, serviceName, resourceName, verb string, inputParams map[string]interface{}, sortKeys []client.SortKey, options *FetchOptions, handle client.MessageHandler) (client.Result, serverSide, error) {
+	applied, err := buildQuery(ctx, cli, serviceName, resourceName, verb, inputParams, sortKeys, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to discover service: %v", err)
+		return nil, applied, err
 	}
 
-	serviceDesc, err := refClient.ResolveService(fullServiceName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve service %s: %v", fullServiceName, err)
+	if handle != nil {
+		return nil, applied, cli.Stream(ctx, serviceName, resourceName, verb, inputParams, handle)
 	}
 
-	methodDesc := serviceDesc.FindMethodByName(verb)
-	if methodDesc == nil {
-		return nil, fmt.Errorf("method not found: %s", verb)
+	var result client.Result
+	if options.AllPages && verb == "list" {
+		// Progress is only drawn for rendered output, not for watch polling
+		var progress client.PageProgress
+		if options.OutputFormat != "" {
+			var stop func()
+			progress, stop = pageProgressBar()
+			defer stop()
+		}
+		result, err = cli.InvokeAll(ctx, serviceName, resourceName, verb, inputParams, options.AllPageSize, progress)
+	} else {
+		result, err = cli.Invoke(ctx, serviceName, resourceName, verb, inputParams)
 	}
 
-	// Create request and response messages
-	reqMsg := dynamic.NewMessage(methodDesc.GetInputType())
-	respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
+	return result, applied, err
+}
+
+// buildQuery adds --filter, --sort, --columns and --rows to the query of inputParams
+// and reports which of them the server will apply
+func buildQuery(ctx context.Context, cli *client.Client, serviceName, resourceName, verb string, inputParams map[string]interface{}, sortKeys []client.SortKey, options *FetchOptions) (serverSide, error) {
+	var applied serverSide
+
+	listFlags := verb == "list" && (sortKeys != nil || options.Columns != "" || options.Rows > 0)
+	if len(options.Filters) > 0 || listFlags {
+		methodDesc, err := cli.ResolveMethod(ctx, serviceName, resourceName, verb)
+		queryType := client.QueryType(methodDesc)
+		switch {
+		case errors.Is(err, client.ErrNoDescriptor):
+			// Called through the console API, which checks the query itself
+			queryType = client.StandardQueryType()
+		case err != nil:
+			return applied, err
+		}
 
-	// Parse and set input parameters
-	inputParams, err := parseParameters(options)
-	if err != nil {
-		return nil, err
+		if len(options.Filters) > 0 {
+			conditions := make([]client.Condition, 0, len(options.Filters))
+			for _, expr := range options.Filters {
+				cond, err := client.ParseFilter(expr)
+				if err != nil {
+					return applied, err
+				}
+				conditions = append(conditions, cond)
+			}
+
+			if queryType == nil || queryType.FindFieldByName("filter") == nil {
+				return applied, fmt.Errorf("'%s %s' does not accept --filter: %s has no query.filter field",
+					verb, resourceName, methodDesc.GetInputType().GetName())
+			}
+
+			client.AddFilter(inputParams, conditions)
+		}
+
+		if verb == "list" {
+			applied.sort = client.SetSort(inputParams, queryType, sortKeys)
+
+			if options.Columns != "" {
+				var fields []string
+				for _, col := range strings.Split(options.Columns, ",") {
+					if col = strings.TrimSpace(col); col != "" {
+						fields = append(fields, col)
+					}
+				}
+				client.SetOnly(inputParams, queryType, fields)
+			}
+
+			// --all pages through everything itself, so the limit is applied locally. So is
+			// it when sorting locally, since the top rows are only known once all are sorted.
+			if !options.AllPages && (applied.sort || len(sortKeys) == 0) {
+				applied.limit = client.SetLimit(inputParams, queryType, options.Rows)
+			}
+		}
 	}
 
-	// Marshal the inputParams map to JSON
-	jsonBytes, err := json.Marshal(inputParams)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal input parameters to JSON: %v", err)
+	return applied, nil
+}
+
+// sortResults sorts list items by keys without assuming the type of any value.
+// Items missing a key sort last, and values of different types are ordered by type.
+func sortResults(results []interface{}, keys []client.SortKey) {
+	sort.SliceStable(results, func(i, j int) bool {
+		iMap, _ := results[i].(map[string]interface{})
+		jMap, _ := results[j].(map[string]interface{})
+
+		for _, key := range keys {
+			_, iVal, iOk := lookupField(iMap, key.Key)
+			_, jVal, jOk := lookupField(jMap, key.Key)
+
+			switch {
+			case !iOk && !jOk:
+				continue
+			case !iOk:
+				return false
+			case !jOk:
+				return true
+			}
+
+			c := compareValues(iVal, jVal)
+			if c == 0 {
+				continue
+			}
+			if key.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// compareValues orders two decoded JSON values, falling back to their type when they differ
+func compareValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			switch {
+			case av < bv:
+				return -1
+			case av > bv:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0
+			case !av:
+				return -1
+			}
+			return 1
+		}
 	}
 
-	// Unmarshal the JSON into the dynamic.Message
-	if err := reqMsg.UnmarshalJSON(jsonBytes); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON into request message: %v", err)
+	if ar, br := typeRank(a), typeRank(b); ar != br {
+		return ar - br
 	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
 
-	fullMethod := fmt.Sprintf("/%s/%s", fullServiceName, verb)
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	default:
+		return 5
+	}
+}
 
-	// Handle client streaming
-	if !methodDesc.IsClientStreaming() && methodDesc.IsServerStreaming() {
-		streamDesc := &grpc.StreamDesc{
-			StreamName:    verb,
-			ServerStreams: true,
-			ClientStreams: false,
+// lookupField finds a dot-separated key in an item. Message fields come back in
+// lowerCamelCase, so each part is also tried in that form.
+func lookupField(item map[string]interface{}, key string) (string, interface{}, bool) {
+	var current interface{} = item
+	var found []string
+
+	for _, part := range strings.Split(key, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return "", nil, false
 		}
 
-		stream, err := conn.NewStream(ctx, streamDesc, fullMethod)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create stream: %v", err)
+		if v, ok := m[part]; ok {
+			current = v
+			found = append(found, part)
+			continue
 		}
 
-		if err := stream.SendMsg(reqMsg); err != nil {
-			return nil, fmt.Errorf("failed to send request message: %v", err)
+		camel := format.ToLowerCamel(part)
+		v, ok := m[camel]
+		if !ok {
+			return "", nil, false
 		}
+		current = v
+		found = append(found, camel)
+	}
+
+	return strings.Join(found, "."), current, true
+}
 
-		if err := stream.CloseSend(); err != nil {
-			return nil, fmt.Errorf("failed to close send: %v", err)
+// pageProgressBar reports --all progress on stderr once more than one page is needed
+func pageProgressBar() (client.PageProgress, func()) {
+	var bar *pterm.ProgressbarPrinter
+
+	progress := func(fetched, total int) {
+		if fetched > total {
+			fetched = total
 		}
 
-		var allResponses []string
-		for {
-			respMsg := dynamic.NewMessage(methodDesc.GetOutputType())
-			err := stream.RecvMsg(respMsg)
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return nil, fmt.Errorf("failed to receive response: %v", err)
+		if bar == nil {
+			if total <= fetched {
+				return
 			}
+			bar, _ = pterm.DefaultProgressbar.
+				WithTotal(total).
+				WithTitle("Fetching all pages").
+				WithWriter(os.Stderr).
+				WithRemoveWhenDone(true).
+				Start()
+		}
 
-			jsonBytes, err := respMsg.MarshalJSON()
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal response: %v", err)
-			}
+		if bar != nil && fetched > bar.Current {
+			bar.Add(fetched - bar.Current)
+		}
+	}
 
-			allResponses = append(allResponses, string(jsonBytes))
+	stop := func() {
+		if bar != nil && bar.IsActive {
+			_, _ = bar.Stop()
 		}
+	}
 
-		if len(allResponses) == 1 {
-			return []byte(allResponses[0]), nil
+	return progress, stop
+}
+
+// printTokenGuide explains how to obtain a token for the current environment
+func printTokenGuide(currentEnv, endpoint string) {
+	pterm.Error.Println("No token found for authentication.")
+
+	if currentEnv == "local" {
+		// Local environment message
+		pterm.Info.Printf("Using endpoint: %s\n", endpoint)
+		return
+	} else if strings.HasSuffix(currentEnv, "-app") {
+		// App environment message
+		headerBox := pterm.DefaultBox.WithTitle("App Guide").
+			WithTitleTopCenter().
+			WithRightPadding(4).
+			WithLeftPadding(4).
+			WithBoxStyle(pterm.NewStyle(pterm.FgLightCyan))
+
+		appTokenExplain := "Please create a Domain Admin App in SpaceONE Console.\n" +
+			"This requires Domain Admin privilege.\n\n" +
+			"Or Please create a Workspace App in SpaceONE Console.\n" +
+			"This requires Workspace Owner privilege."
+
+		pterm.Info.Printf("Using endpoint: %s\n", endpoint)
+		headerBox.Println(appTokenExplain)
+		fmt.Println()
+
+		steps := []string{
+			"1. Go to SpaceONE Console",
+			"2. Navigate to either 'Admin > App Page' or specific 'Workspace > App page'",
+			"3. Click 'Create' to create your App",
+			"4. Copy value of either 'client_secret' from Client ID or 'token' from Spacectl (CLI)",
 		}
 
-		combinedJSON := fmt.Sprintf("{\"results\": [%s]}", strings.Join(allResponses, ","))
-		return []byte(combinedJSON), nil
+		yamlExample := pterm.DefaultBox.WithTitle("Config Example").
+			WithTitleTopCenter().
+			WithRightPadding(4).
+			WithLeftPadding(4).
+			Sprint(fmt.Sprintf("environment: %s\nenvironments:\n    %s:\n        endpoint: %s\n        proxy: true\n        token: %s",
+				currentEnv,
+				currentEnv,
+				endpoint,
+				pterm.FgLightCyan.Sprint("YOUR_COPIED_TOKEN")))
+
+		instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
+			WithTitleTopCenter().
+			WithRightPadding(4).
+			WithLeftPadding(4)
+
+		allSteps := append(steps,
+			fmt.Sprintf("5. Add the token under the proxy in your config file:\n%s", yamlExample),
+			"6. Run 'cfctl login' again")
+
+		instructionBox.Println(strings.Join(allSteps, "\n\n"))
+
+	} else if strings.HasSuffix(currentEnv, "-user") {
+		// User environment message
+		headerBox := pterm.DefaultBox.WithTitle("Authentication Required").
+			WithTitleTopCenter().
+			WithRightPadding(4).
+			WithLeftPadding(4).
+			WithBoxStyle(pterm.NewStyle(pterm.FgLightCyan))
+
+		authExplain := "Please login to SpaceONE Console first.\n" +
+			"This requires your SpaceONE credentials."
+
+		headerBox.Println(authExplain)
+		fmt.Println()
+
+		steps := []string{
+			"1. Run 'cfctl login'",
+			"2. Enter your credentials when prompted",
+			"3. Select your scope",
+			"4. Try your command again",
+		}
+
+		instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
+			WithTitleTopCenter().
+			WithRightPadding(4).
+			WithLeftPadding(4)
+
+		instructionBox.Println(strings.Join(steps, "\n\n"))
 	}
+}
 
-	// Regular unary call
-	err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg)
-	if err != nil {
-		if strings.Contains(err.Error(), "ERROR_AUTHENTICATE_FAILURE") ||
-			strings.Contains(err.Error(), "Token is invalid or expired") {
-
-			// Check if current environment is app type
-			if strings.HasSuffix(config.Environment, "-app") {
-				headerBox := pterm.DefaultBox.WithTitle("App Token Required").
-					WithTitleTopCenter().
-					WithRightPadding(4).
-					WithLeftPadding(4).
-					WithBoxStyle(pterm.NewStyle(pterm.FgLightRed))
-
-				appTokenExplain := "Please create a Domain Admin App in SpaceONE Console.\n" +
-					"This requires Domain Admin privilege.\n\n" +
-					"Or Please create a Workspace App in SpaceONE Console.\n" +
-					"This requires Workspace Owner privilege."
-
-				headerBox.Println(appTokenExplain)
-				fmt.Println()
+// printAuthenticationGuide explains how to refresh a rejected token and returns the error to report
+func printAuthenticationGuide(currentEnv string) error {
+	// Check if current environment is app type
+	if strings.HasSuffix(currentEnv, "-app") {
+		headerBox := pterm.DefaultBox.WithTitle("App Token Required").
+			WithTitleTopCenter().
+			WithRightPadding(4).
+			WithLeftPadding(4).
+			WithBoxStyle(pterm.NewStyle(pterm.FgLightRed))
+
+		appTokenExplain := "Please create a Domain Admin App in SpaceONE Console.\n" +
+			"This requires Domain Admin privilege.\n\n" +
+			"Or Please create a Workspace App in SpaceONE Console.\n" +
+			"This requires Workspace Owner privilege."
+
+		headerBox.Println(appTokenExplain)
+		fmt.Println()
+
+		steps := []string{
+			"1. Go to SpaceONE Console",
+			"2. Navigate to either 'Admin > App Page' or specific 'Workspace > App page'",
+			"3. Click 'Create' to create your App",
+			"4. Copy the generated App Token",
+			fmt.Sprintf("5. Update token in your config file:\n   Path: ~/.cfctl/setting.yaml\n   Environment: %s", currentEnv),
+		}
 
-				steps := []string{
-					"1. Go to SpaceONE Console",
-					"2. Navigate to either 'Admin > App Page' or specific 'Workspace > App page'",
-					"3. Click 'Create' to create your App",
-					"4. Copy the generated App Token",
-					fmt.Sprintf("5. Update token in your config file:\n   Path: ~/.cfctl/setting.yaml\n   Environment: %s", config.Environment),
-				}
+		instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
+			WithTitleTopCenter().
+			WithRightPadding(4).
+			WithLeftPadding(4)
 
-				instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
-					WithTitleTopCenter().
-					WithRightPadding(4).
-					WithLeftPadding(4)
+		instructionBox.Println(strings.Join(steps, "\n\n"))
 
-				instructionBox.Println(strings.Join(steps, "\n\n"))
+		return fmt.Errorf("app token required")
+	}
 
-				return nil, fmt.Errorf("app token required")
-			} else {
-				// Original user authentication error message
-				headerBox := pterm.DefaultBox.WithTitle("Authentication Error").
-					WithTitleTopCenter().
-					WithRightPadding(4).
-					WithLeftPadding(4).
-					WithBoxStyle(pterm.NewStyle(pterm.FgLightRed))
+	// Original user authentication error message
+	headerBox := pterm.DefaultBox.WithTitle("Authentication Error").
+		WithTitleTopCenter().
+		WithRightPadding(4).
+		WithLeftPadding(4).
+		WithBoxStyle(pterm.NewStyle(pterm.FgLightRed))
 
-				errorExplain := "Your authentication token has expired or is invalid.\n" +
-					"Please login again to refresh your credentials."
+	errorExplain := "Your authentication token has expired or is invalid.\n" +
+		"Please login again to refresh your credentials."
 
-				headerBox.Println(errorExplain)
-				fmt.Println()
+	headerBox.Println(errorExplain)
+	fmt.Println()
 
-				steps := []string{
-					"1. Run 'cfctl login'",
-					"2. Enter your credentials when prompted",
-					"3. Try your command again",
-				}
+	steps := []string{
+		"1. Run 'cfctl login'",
+		"2. Enter your credentials when prompted",
+		"3. Try your command again",
+	}
 
-				instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
-					WithTitleTopCenter().
-					WithRightPadding(4).
-					WithLeftPadding(4)
+	instructionBox := pterm.DefaultBox.WithTitle("Required Steps").
+		WithTitleTopCenter().
+		WithRightPadding(4).
+		WithLeftPadding(4)
 
-				instructionBox.Println(strings.Join(steps, "\n\n"))
+	instructionBox.Println(strings.Join(steps, "\n\n"))
 
-				return nil, fmt.Errorf("authentication required")
-			}
-		}
-		return nil, fmt.Errorf("failed to invoke method %s: %v", fullMethod, err)
-	}
+	return fmt.Errorf("authentication required")
+}
 
-	return respMsg.MarshalJSON()
+// promptForParameter prompts the user to enter a value for the given parameter
+func promptForParameter(paramName string) (string, error) {
+	prompt := fmt.Sprintf("Please enter value for '%s'", paramName)
+	result, err := pterm.DefaultInteractiveTextInput.WithDefaultText("").Show(prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %v", err)
+	}
+	return result, nil
 }
 
 func parseParameters(options *FetchOptions) (map[string]interface{}, error) {
@@ -746,7 +1101,13 @@ func parseParameters(options *FetchOptions) (map[string]interface{}, error) {
 
 	// Load from file parameter if provided
 	if options.FileParameter != "" {
-		data, err := os.ReadFile(options.FileParameter)
+		var data []byte
+		var err error
+		if options.FileParameter == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(options.FileParameter)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to read file parameter: %v", err)
 		}
@@ -798,28 +1159,6 @@ func parseParameters(options *FetchOptions) (map[string]interface{}, error) {
 	return parsed, nil
 }
 
-func discoverService(refClient *grpcreflect.Client, serviceName string, resourceName string) (string, error) {
-	services, err := refClient.ListServices()
-	if err != nil {
-		return "", fmt.Errorf("failed to list services: %v", err)
-	}
-
-	for _, service := range services {
-		if strings.Contains(service, ".plugin.") && strings.HasSuffix(service, resourceName) {
-			return service, nil
-		}
-	}
-
-	for _, service := range services {
-		if strings.Contains(service, fmt.Sprintf("spaceone.api.%s", serviceName)) &&
-			strings.HasSuffix(service, resourceName) {
-			return service, nil
-		}
-	}
-
-	return "", fmt.Errorf("service not found for %s.%s", serviceName, resourceName)
-}
-
 // WatchResource monitors a resource for changes and prints updates
 func WatchResource(serviceName, verb, resource string, options *FetchOptions) error {
 	ticker := time.NewTicker(2 * time.Second)
@@ -830,6 +1169,15 @@ func WatchResource(serviceName, verb, resource string, options *FetchOptions) er
 
 	seenItems := make(map[string]bool)
 
+	var query *format.Query
+	if options.Query != "" {
+		var err error
+		query, err = format.CompileQuery(options.Query)
+		if err != nil {
+			return err
+		}
+	}
+
 	initialData, err := FetchService(serviceName, verb, resource, &FetchOptions{
 		Parameters:      options.Parameters,
 		JSONParameter:   options.JSONParameter,
@@ -837,6 +1185,18 @@ func WatchResource(serviceName, verb, resource string, options *FetchOptions) er
 		APIVersion:      options.APIVersion,
 		OutputFormat:    "",
 		CopyToClipboard: false,
+		AllPages:        options.AllPages,
+		AllPageSize:     options.AllPageSize,
+		Filters:         options.Filters,
+		MaxAttempts:     options.MaxAttempts,
+		ForceRetry:      options.ForceRetry,
+		Headers:         options.Headers,
+		Token:           options.Token,
+		TokenFile:       options.TokenFile,
+		MaxRecvSize:     options.MaxRecvSize,
+		MaxSendSize:     options.MaxSendSize,
+		Compression:     options.Compression,
+		Authority:       options.Authority,
 	})
 	if err != nil {
 		return err
@@ -859,7 +1219,7 @@ func WatchResource(serviceName, verb, resource string, options *FetchOptions) er
 
 		if len(recentItems) > 0 {
 			fmt.Printf("Recent items:\n")
-			format.PrintNewItems(recentItems)
+			printWatchItems(recentItems, query)
 		}
 	}
 
@@ -875,9 +1235,30 @@ func WatchResource(serviceName, verb, resource string, options *FetchOptions) er
 				APIVersion:      options.APIVersion,
 				OutputFormat:    "",
 				CopyToClipboard: false,
+				AllPages:        options.AllPages,
+				AllPageSize:     options.AllPageSize,
+				Filters:         options.Filters,
+				MaxAttempts:     options.MaxAttempts,
+				ForceRetry:      options.ForceRetry,
+				Headers:         options.Headers,
+				Token:           options.Token,
+				TokenFile:       options.TokenFile,
+				MaxRecvSize:     options.MaxRecvSize,
+				MaxSendSize:     options.MaxSendSize,
+				Compression:     options.Compression,
+				Authority:       options.Authority,
 			})
 			if err != nil {
-				continue
+				if errors.Is(err, rpc.ErrInterrupted) {
+					fmt.Println("\nStopping watch...")
+					return nil
+				}
+				// Transient failures have already been retried; try again on the next tick
+				if client.IsKind(err, client.KindUnavailable) {
+					rpc.Logf(rpc.LevelInfo, "watch: poll failed: %v", err)
+					continue
+				}
+				return err
 			}
 
 			var newItems []map[string]interface{}
@@ -898,7 +1279,7 @@ func WatchResource(serviceName, verb, resource string, options *FetchOptions) er
 					len(newItems),
 					time.Now().Format("2006-01-02 15:04:05"))
 
-				format.PrintNewItems(newItems)
+				printWatchItems(newItems, query)
 				fmt.Println()
 			}
 
@@ -909,7 +1290,69 @@ func WatchResource(serviceName, verb, resource string, options *FetchOptions) er
 	}
 }
 
-func printData(data map[string]interface{}, options *FetchOptions, serviceName, verbName, resourceName string, refClient *grpcreflect.Client) {
+// printWatchItems prints a batch of watched items. A query sees the batch shaped like a
+// list response, so the same --query works for list and watch.
+func printWatchItems(items []map[string]interface{}, query *format.Query) {
+	if query == nil {
+		format.PrintNewItems(items)
+		return
+	}
+
+	results := make([]interface{}, len(items))
+	for i, item := range items {
+		results[i] = item
+	}
+
+	value, err := query.Apply(map[string]interface{}{"results": results})
+	if err != nil {
+		pterm.Error.Println(err)
+		return
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	rows := make([]map[string]interface{}, 0, len(values))
+	for _, v := range values {
+		row, ok := v.(map[string]interface{})
+		if !ok {
+			row = map[string]interface{}{"value": v}
+		}
+		rows = append(rows, row)
+	}
+	format.PrintNewItems(rows)
+}
+
+// printFormatted renders data with the Printer of a template or custom-columns output
+// format. It returns false for the built-in formats.
+func printFormatted(data interface{}, options *FetchOptions) bool {
+	printer, ok, err := format.NewPrinter(options.OutputFormat)
+	if !ok {
+		return false
+	}
+	if err != nil {
+		pterm.Error.Println(err)
+		return true
+	}
+
+	output, err := printer.Print(data)
+	if err != nil {
+		pterm.Error.Println(err)
+		return true
+	}
+	fmt.Print(output)
+
+	copyOutput(output, options)
+	return true
+}
+
+func printData(data map[string]interface{}, options *FetchOptions, serviceName, verbName, resourceName string, cli *client.Client) {
+	if printFormatted(data, options) {
+		return
+	}
+
 	var output string
 
 	switch options.OutputFormat {
@@ -939,10 +1382,15 @@ func printData(data map[string]interface{}, options *FetchOptions, serviceName,
 		}
 
 	case "table":
-		output = printTable(data, options, serviceName, verbName, resourceName, refClient)
+		output = printTable(data, options, serviceName, verbName, resourceName, cli)
+
+	case "csv", "tsv":
+		output = printCSV(data, options)
 
-	case "csv":
-		output = printCSV(data)
+	case "ndjson":
+		if err := printNDJSON(data, nil); err != nil {
+			pterm.Error.Println(err)
+		}
 
 	default:
 		output = printYAMLDoc(data)
@@ -950,6 +1398,11 @@ func printData(data map[string]interface{}, options *FetchOptions, serviceName,
 	}
 
 	// Copy to clipboard if requested
+	copyOutput(output, options)
+}
+
+// copyOutput copies the rendered output to the clipboard when --copy is set
+func copyOutput(output string, options *FetchOptions) {
 	if options.CopyToClipboard && output != "" {
 		if err := clipboard.WriteAll(output); err != nil {
 			log.Fatalf("Failed to copy to clipboard: %v", err)
@@ -958,6 +1411,77 @@ func printData(data map[string]interface{}, options *FetchOptions, serviceName,
 	}
 }
 
+// printQueryResult renders the value produced by --query. Objects are printed like a
+// response; lists are printed as-is in json and yaml and as rows in table and csv.
+func printQueryResult(value interface{}, options *FetchOptions, serviceName, verbName, resourceName string, cli *client.Client) {
+	if printFormatted(value, options) {
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		printData(v, options, serviceName, verbName, resourceName, cli)
+		return
+
+	case []interface{}:
+		switch options.OutputFormat {
+		case "table", "csv", "tsv":
+			rows := make([]interface{}, len(v))
+			for i, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					rows[i] = m
+				} else {
+					rows[i] = map[string]interface{}{"value": item}
+				}
+			}
+
+			// The query already picked the fields, so show every column it produced
+			queryOptions := *options
+			queryOptions.MinimalColumns = false
+			printData(map[string]interface{}{"results": rows}, &queryOptions, serviceName, verbName, resourceName, cli)
+			return
+		}
+	}
+
+	var output string
+	switch {
+	case options.OutputFormat == "json":
+		dataBytes, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal query result to JSON: %v", err)
+		}
+		output = string(dataBytes) + "\n"
+
+	case options.OutputFormat == "yaml":
+		if items, ok := value.([]interface{}); ok && len(items) > 0 {
+			var sb strings.Builder
+			for i, item := range items {
+				if i > 0 {
+					sb.WriteString("---\n")
+				}
+				sb.WriteString(printYAMLDoc(item))
+			}
+			output = sb.String()
+		} else {
+			output = printYAMLDoc(value)
+		}
+
+	default:
+		// Scalars are printed raw so they can be used in shell scripts
+		if str, ok := value.(string); ok {
+			output = str + "\n"
+		} else if value == nil {
+			output = "null\n"
+		} else {
+			dataBytes, _ := json.Marshal(value)
+			output = string(dataBytes) + "\n"
+		}
+	}
+	fmt.Print(output)
+
+	copyOutput(output, options)
+}
+
 func printYAMLDoc(v interface{}) string {
 	var buf bytes.Buffer
 	encoder := yaml.NewEncoder(&buf)
@@ -968,25 +1492,16 @@ func printYAMLDoc(v interface{}) string {
 	return buf.String()
 }
 
-func getMinimalFields(serviceName, resourceName string, refClient *grpcreflect.Client) []string {
+func getMinimalFields(serviceName, resourceName string, cli *client.Client) []string {
 	// Default minimal fields that should always be included if they exist
 	defaultFields := []string{"name", "created_at"}
 
-	// Try to get message descriptor for the resource
-	fullServiceName := fmt.Sprintf("spaceone.api.%s.v1.%s", serviceName, resourceName)
-	serviceDesc, err := refClient.ResolveService(fullServiceName)
-	if err != nil {
-		// Try v2 if v1 fails
-		fullServiceName = fmt.Sprintf("spaceone.api.%s.v2.%s", serviceName, resourceName)
-		serviceDesc, err = refClient.ResolveService(fullServiceName)
-		if err != nil {
-			return defaultFields
-		}
-	}
-
 	// Get list method descriptor
-	listMethod := serviceDesc.FindMethodByName("list")
-	if listMethod == nil {
+	ctx, cancel := rpc.Context()
+	defer cancel()
+
+	listMethod, err := cli.ResolveMethod(ctx, serviceName, resourceName, "list")
+	if err != nil {
 		return defaultFields
 	}
 
@@ -1044,7 +1559,7 @@ func getMinimalFields(serviceName, resourceName string, refClient *grpcreflect.C
 	return minimalFields
 }
 
-func printTable(data map[string]interface{}, options *FetchOptions, serviceName, verbName, resourceName string, refClient *grpcreflect.Client) string {
+func printTable(data map[string]interface{}, options *FetchOptions, serviceName, verbName, resourceName string, cli *client.Client) string {
 	if results, ok := data["results"].([]interface{}); ok {
 		// Set default page size if not specified and paging is enabled
 		if !options.NoPaging {
@@ -1056,17 +1571,6 @@ func printTable(data map[string]interface{}, options *FetchOptions, serviceName,
 			options.PageSize = len(results)
 		}
 
-		// Initialize keyboard
-		if err := keyboard.Open(); err != nil {
-			fmt.Println("Failed to initialize keyboard:", err)
-			return ""
-		}
-		defer keyboard.Close()
-
-		currentPage := 0
-		searchTerm := ""
-		filteredResults := results
-
 		// Extract headers
 		headers := make(map[string]bool)
 		for _, result := range results[:min(1000, len(results))] {
@@ -1086,7 +1590,7 @@ func printTable(data map[string]interface{}, options *FetchOptions, serviceName,
 
 		// Handle minimal columns
 		if options.MinimalColumns {
-			minimalFields := getMinimalFields(serviceName, resourceName, refClient)
+			minimalFields := getMinimalFields(serviceName, resourceName, cli)
 			var minimalHeaderSlice []string
 			for _, field := range minimalFields {
 				if headers[field] {
@@ -1098,6 +1602,39 @@ func printTable(data map[string]interface{}, options *FetchOptions, serviceName,
 			}
 		}
 
+		if !isInteractive(options) {
+			if len(results) == 0 {
+				fmt.Fprintln(os.Stderr, "No resources found.")
+				return ""
+			}
+
+			rows := make([][]string, 0, len(results))
+			for _, result := range results {
+				if row, ok := result.(map[string]interface{}); ok {
+					rowData := make([]string, len(headerSlice))
+					for i, key := range headerSlice {
+						rowData[i] = format.FormatValue(row[key])
+					}
+					rows = append(rows, rowData)
+				}
+			}
+
+			output := format.RenderStaticTable(headerSlice, rows, format.OutputWidth())
+			fmt.Print(output)
+			return output
+		}
+
+		// Initialize keyboard
+		if err := keyboard.Open(); err != nil {
+			fmt.Println("Failed to initialize keyboard:", err)
+			return ""
+		}
+		defer keyboard.Close()
+
+		currentPage := 0
+		searchTerm := ""
+		filteredResults := results
+
 		for {
 			if searchTerm != "" {
 				filteredResults = filterResults(results, searchTerm)
@@ -1178,6 +1715,17 @@ func printTable(data map[string]interface{}, options *FetchOptions, serviceName,
 	}
 	sort.Strings(headers)
 
+	if !isInteractive(options) {
+		rows := make([][]string, 0, len(headers))
+		for _, header := range headers {
+			rows = append(rows, []string{header, format.FormatValue(data[header])})
+		}
+
+		output := format.RenderStaticTable([]string{"Field", "Value"}, rows, format.OutputWidth())
+		fmt.Print(output)
+		return output
+	}
+
 	tableData := pterm.TableData{
 		{"Field", "Value"},
 	}
@@ -1191,6 +1739,12 @@ func printTable(data map[string]interface{}, options *FetchOptions, serviceName,
 	return ""
 }
 
+// isInteractive reports whether tables may page and read keys, which needs a terminal on
+// both ends and no --no-interactive
+func isInteractive(options *FetchOptions) bool {
+	return !options.NoInteractive && format.IsTerminal(os.Stdout) && format.IsTerminal(os.Stdin)
+}
+
 func filterResults(results []interface{}, searchTerm string) []interface{} {
 	var filtered []interface{}
 	searchTerm = strings.ToLower(searchTerm)
@@ -1242,69 +1796,100 @@ func FormatTableValue(val interface{}) string {
 	}
 }
 
-func printCSV(data map[string]interface{}) string {
-	writer := csv.NewWriter(os.Stdout)
-	defer writer.Flush()
+// printCSV writes data as CSV, or TSV when options.OutputFormat is tsv. Rows are flattened
+// into dot-path columns and the header is the union of the keys of every row.
+func printCSV(data map[string]interface{}, options *FetchOptions) string {
+	delimiter, err := csvDelimiter(options)
+	if err != nil {
+		pterm.Error.Println(err)
+		return ""
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
 
 	if results, ok := data["results"].([]interface{}); ok {
 		if len(results) == 0 {
 			return ""
 		}
 
-		headers := make([]string, 0)
-		if firstRow, ok := results[0].(map[string]interface{}); ok {
-			for key := range firstRow {
-				headers = append(headers, key)
+		rows := make([]map[string]interface{}, 0, len(results))
+		headerSet := make(map[string]bool)
+		for _, result := range results {
+			row, ok := result.(map[string]interface{})
+			if !ok {
+				row = map[string]interface{}{"value": result}
+			}
+			row = format.Flatten(row)
+			for key := range row {
+				headerSet[key] = true
 			}
-			sort.Strings(headers)
+			rows = append(rows, row)
+		}
+
+		headers := make([]string, 0, len(headerSet))
+		for key := range headerSet {
+			headers = append(headers, key)
+		}
+		sort.Strings(headers)
+
+		if !options.NoHeaders {
 			writer.Write(headers)
 		}
 
-		for _, result := range results {
-			if row, ok := result.(map[string]interface{}); ok {
-				rowData := make([]string, len(headers))
-				for i, header := range headers {
-					rowData[i] = FormatTableValue(row[header])
-				}
-				writer.Write(rowData)
+		for _, row := range rows {
+			rowData := make([]string, len(headers))
+			for i, header := range headers {
+				rowData[i] = format.FormatValue(row[header])
 			}
+			writer.Write(rowData)
 		}
 	} else {
-		headers := []string{"Field", "Value"}
-		writer.Write(headers)
+		if !options.NoHeaders {
+			writer.Write([]string{"Field", "Value"})
+		}
 
-		fields := make([]string, 0)
-		for field := range data {
+		flat := format.Flatten(data)
+		fields := make([]string, 0, len(flat))
+		for field := range flat {
 			fields = append(fields, field)
 		}
 		sort.Strings(fields)
 
 		for _, field := range fields {
-			row := []string{field, FormatTableValue(data[field])}
-			writer.Write(row)
+			writer.Write([]string{field, format.FormatValue(flat[field])})
 		}
 	}
 
-	return ""
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		pterm.Error.Printf("Failed to write CSV: %v\n", err)
+		return ""
+	}
+
+	output := buf.String()
+	fmt.Print(output)
+	return output
 }
 
-func formatCSVValue(val interface{}) string {
-	switch v := val.(type) {
-	case nil:
-		return ""
-	case string:
-		return v
-	case float64, float32, int, int32, int64, uint, uint32, uint64:
-		return fmt.Sprintf("%v", v)
-	case bool:
-		return fmt.Sprintf("%v", v)
-	case map[string]interface{}, []interface{}:
-		jsonBytes, err := json.Marshal(v)
-		if err != nil {
-			return fmt.Sprintf("%v", v)
+// csvDelimiter returns the field separator for csv and tsv output
+func csvDelimiter(options *FetchOptions) (rune, error) {
+	if options.CSVDelimiter == "" {
+		if options.OutputFormat == "tsv" {
+			return '\t', nil
 		}
-		return string(jsonBytes)
-	default:
-		return fmt.Sprintf("%v", v)
+		return ',', nil
+	}
+
+	delimiter := options.CSVDelimiter
+	if delimiter == `\t` {
+		delimiter = "\t"
+	}
+
+	runes := []rune(delimiter)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+		return 0, fmt.Errorf("invalid delimiter '%s': use a single character other than a quote or newline", options.CSVDelimiter)
 	}
+	return runes[0], nil
 }
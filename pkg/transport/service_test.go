@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/cloudforet-io/cfctl/pkg/format"
+)
+
+func TestCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		delimiter string
+		want      rune
+		wantErr   bool
+	}{
+		{name: "csv default", output: "csv", want: ','},
+		{name: "tsv default", output: "tsv", want: '\t'},
+		{name: "semicolon", output: "csv", delimiter: ";", want: ';'},
+		{name: "escaped tab", output: "csv", delimiter: `\t`, want: '\t'},
+		{name: "multibyte", output: "csv", delimiter: "│", want: '│'},
+		{name: "several characters", output: "csv", delimiter: ";;", wantErr: true},
+		{name: "quote", output: "csv", delimiter: `"`, wantErr: true},
+		{name: "newline", output: "tsv", delimiter: "\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := csvDelimiter(&FetchOptions{OutputFormat: tt.output, CSVDelimiter: tt.delimiter})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("csvDelimiter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("csvDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		options FetchOptions
+		want    string
+	}{
+		{
+			name:    "header union and nested fields",
+			data:    `{"results": [{"name": "web-1", "data": {"region": "us"}}, {"name": "web-2", "size": 2}]}`,
+			options: FetchOptions{OutputFormat: "csv"},
+			want:    "data.region,name,size\nus,web-1,\n,web-2,2\n",
+		},
+		{
+			name:    "quoting",
+			data:    `{"results": [{"name": "a,b", "note": "say \"hi\"", "zones": ["x", "y"]}]}`,
+			options: FetchOptions{OutputFormat: "csv"},
+			want:    "name,note,zones\n\"a,b\",\"say \"\"hi\"\"\",\"[\"\"x\"\",\"\"y\"\"]\"\n",
+		},
+		{
+			name:    "tsv",
+			data:    `{"results": [{"name": "web-1", "size": 3}]}`,
+			options: FetchOptions{OutputFormat: "tsv"},
+			want:    "name\tsize\nweb-1\t3\n",
+		},
+		{
+			name:    "no headers",
+			data:    `{"results": [{"name": "web-1"}, {"name": "web-2"}]}`,
+			options: FetchOptions{OutputFormat: "csv", NoHeaders: true},
+			want:    "web-1\nweb-2\n",
+		},
+		{
+			name:    "custom delimiter",
+			data:    `{"results": [{"name": "web-1", "size": 3}]}`,
+			options: FetchOptions{OutputFormat: "csv", CSVDelimiter: ";"},
+			want:    "name;size\nweb-1;3\n",
+		},
+		{
+			name:    "non-object results",
+			data:    `{"results": ["a", "b"]}`,
+			options: FetchOptions{OutputFormat: "csv"},
+			want:    "value\na\nb\n",
+		},
+		{
+			name:    "no results",
+			data:    `{"results": []}`,
+			options: FetchOptions{OutputFormat: "csv"},
+			want:    "",
+		},
+		{
+			name:    "single object",
+			data:    `{"name": "web-1", "data": {"region": "us"}}`,
+			options: FetchOptions{OutputFormat: "csv"},
+			want:    "Field,Value\ndata.region,us\nname,web-1\n",
+		},
+		{
+			name:    "invalid delimiter",
+			data:    `{"results": [{"name": "web-1"}]}`,
+			options: FetchOptions{OutputFormat: "csv", CSVDelimiter: "::"},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+				t.Fatalf("bad test input %s: %v", tt.data, err)
+			}
+			var got string
+			printed := captureStdout(t, func() { got = printCSV(data, &tt.options) })
+			if got != tt.want {
+				t.Errorf("printCSV() = %q, want %q", got, tt.want)
+			}
+			if printed != got {
+				t.Errorf("printCSV() printed %q but returned %q", printed, got)
+			}
+		})
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestPrintNDJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		query string
+		want  string
+	}{
+		{
+			name: "one line per result",
+			data: `{"results": [{"name": "web-1"}, {"name": "web-2", "tags": {"env": "dev"}}], "total_count": 2}`,
+			want: "{\"name\":\"web-1\"}\n{\"name\":\"web-2\",\"tags\":{\"env\":\"dev\"}}\n",
+		},
+		{
+			name: "single message",
+			data: `{"name": "web-1", "size": 3}`,
+			want: "{\"name\":\"web-1\",\"size\":3}\n",
+		},
+		{
+			name: "empty results",
+			data: `{"results": []}`,
+			want: "",
+		},
+		{
+			name:  "one line per query output",
+			data:  `{"results": [{"name": "web-1"}, {"name": "web-2"}]}`,
+			query: ".results[].name",
+			want:  "\"web-1\"\n\"web-2\"\n",
+		},
+		{
+			name:  "query on a single message",
+			data:  `{"name": "web-1", "size": 3}`,
+			query: "{name}",
+			want:  "{\"name\":\"web-1\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+				t.Fatalf("bad test input %s: %v", tt.data, err)
+			}
+			var query *format.Query
+			if tt.query != "" {
+				var err error
+				if query, err = format.CompileQuery(tt.query); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var err error
+			got := captureStdout(t, func() { err = printNDJSON(data, query) })
+			if err != nil {
+				t.Fatalf("printNDJSON() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("printNDJSON() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}